@@ -0,0 +1,55 @@
+package ratelimiter
+
+import "context"
+
+// Acquire hands out n permits over time, one signal on the returned channel per permit as soon as the
+// bucket allows it, so a streaming producer can interleave its work with acquisition instead of
+// blocking for the whole batch upfront:
+//
+//	for range tb.Acquire(ctx, len(records)) {
+//		// send the next record
+//	}
+//
+// The channel is closed after the last permit, or early if the context ends (check ctx.Err() to tell
+// which). Permits are taken one at a time as they're received, so a slow reader doesn't stockpile them.
+// Stop reading early only if the context gets cancelled, otherwise the background goroutine handing
+// out permits never exits
+func (tb *TokenBucket) Acquire(ctx context.Context, n int) <-chan struct{} {
+	permits := make(chan struct{})
+
+	go func() {
+		defer close(permits)
+
+		for range n {
+			if tb.Wait(ctx) != nil {
+				return
+			}
+
+			select {
+			case permits <- struct{}{}:
+			case <-ctx.Done():
+				tb.refund(1) // took a permit nobody will use
+				return
+			}
+		}
+	}()
+
+	return permits
+}
+
+// AcquireGroup blocks until the bucket has admitted every one of costs, in order, for fan-out work
+// that has to either fully start or not start at all. If the context ends partway through, the
+// tokens already taken for the group are given back, so a cancelled group costs nothing.
+// Unlike WaitN on the total, the group can cost more than the bucket holds at once
+// BLOCKING!! Blocks current goroutine
+func (tb *TokenBucket) AcquireGroup(ctx context.Context, costs []float64) error {
+	held := 0.0
+	for _, cost := range costs {
+		if err := tb.WaitN(ctx, cost); err != nil {
+			tb.refund(held)
+			return err
+		}
+		held += cost
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestAcquire tests that permits come one at a time at the bucket's pace
+func TestAcquire(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 1)
+
+	start := time.Now()
+	count := 0
+	for range tb.Acquire(context.Background(), 3) {
+		count++
+	}
+
+	if count != 3 {
+		t.Errorf("Expected 3 permits, got %d", count)
+	}
+	// 1 from the burst, then 2 more at 10/s
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected permits to be paced, took %v", elapsed)
+	}
+}
+
+// TestAcquire_ContextCancelled tests that the channel closes early when the context ends
+func TestAcquire_ContextCancelled(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	count := 0
+	for range tb.Acquire(ctx, 100) {
+		count++
+	}
+
+	if count < 1 || count > 3 {
+		t.Errorf("Expected only a couple of permits before cancellation, got %d", count)
+	}
+}
+
+// TestAcquireGroup tests that a group bigger than the bucket gets admitted over time
+func TestAcquireGroup(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 10)
+
+	start := time.Now()
+	if err := tb.AcquireGroup(context.Background(), []float64{5, 10, 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 from the burst, the other 10 at 100/s
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected the group to be paced, took %v", elapsed)
+	}
+}
+
+// TestAcquireGroup_Cancelled tests that a cancelled group gives back what it already took
+func TestAcquireGroup_Cancelled(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := tb.AcquireGroup(ctx, []float64{4, 4, 4}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+	if tokens := tb.Tokens(); tokens < 10 {
+		t.Errorf("Expected the partial hold to be given back, %v tokens left", tokens)
+	}
+}
@@ -0,0 +1,136 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+)
+
+// AdmissionController gates work on several budgets at once: a request rate, a number of
+// concurrency slots, and some estimated memory units. Work is only admitted if ALL budgets
+// have room, and nothing is taken if any of them come up short. Slots and memory are given
+// back when the work finishes and calls Release
+type AdmissionController struct {
+	mtx         sync.Mutex
+	rate        *TokenBucket  // request rate budget; nil means no rate limit
+	maxInFlight int           // maximum concurrent admissions; 0 means no concurrency limit
+	inFlight    int           // current number of admitted, unreleased pieces of work
+	maxMemory   float64       // maximum estimated memory units in use; 0 means no memory limit
+	memory      float64       // memory units currently held by admitted work
+	released    chan struct{} // closed (and replaced) whenever something is released, to wake up waiters
+}
+
+// Admission is a successful admission holding a concurrency slot and memory units until released
+type Admission struct {
+	ac     *AdmissionController
+	memory float64
+	once   sync.Once
+}
+
+// AdmissionController constructor; pass nil/0 for any budget you don't want to enforce
+func NewAdmissionController(rate *TokenBucket, maxInFlight int, maxMemory float64) *AdmissionController {
+	if maxInFlight < 0 || maxMemory < 0 {
+		panic("invalid admission controller parameters")
+	}
+
+	return &AdmissionController{
+		rate:        rate,
+		maxInFlight: maxInFlight,
+		maxMemory:   maxMemory,
+		released:    make(chan struct{}),
+	}
+}
+
+// TryAdmit admits work estimated to use the given memory units if every budget has room right now
+// NON-BLOCKING! Returns immediately; the second return value is false if any budget is short
+func (ac *AdmissionController) TryAdmit(memory float64) (*Admission, bool) {
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+
+	if !ac.take(memory).ok {
+		return nil, false
+	}
+	return &Admission{ac: ac, memory: memory}, true
+}
+
+// Admit blocks until every budget has room for work estimated to use the given memory units
+// Returns ErrBurstExceeded right away if memory is more than the controller can ever hold, and
+// whatever the rate bucket gives if it refuses outright (e.g. ErrPaused or ErrClosed)
+// BLOCKING!! Blocks current goroutine
+func (ac *AdmissionController) Admit(ctx context.Context, memory float64) (*Admission, error) {
+	if ac.maxMemory > 0 && memory > ac.maxMemory {
+		return nil, ErrBurstExceeded
+	}
+
+	err := waitMulti(ctx, func() takeResult {
+		ac.mtx.Lock()
+		defer ac.mtx.Unlock()
+		return ac.take(memory)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Admission{ac: ac, memory: memory}, nil
+}
+
+// SetMaxInFlight changes the concurrency limit on the fly; 0 means no concurrency limit.
+// Lowering it never kicks out admitted work, it just stops new admissions until enough is released
+func (ac *AdmissionController) SetMaxInFlight(n int) {
+	if n < 0 {
+		panic("invalid admission controller parameters")
+	}
+
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+
+	ac.maxInFlight = n
+
+	// Wake up waiters in case the limit went up and they can get in now
+	close(ac.released)
+	ac.released = make(chan struct{})
+}
+
+// InFlight returns how many admissions are currently held
+func (ac *AdmissionController) InFlight() int {
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+	return ac.inFlight
+}
+
+// Internal helper that takes from all budgets at once if they all have room. If a concurrency
+// slot or memory is short, the result wakes up on the next release; otherwise the rate bucket says
+// how long until it refills
+// Caller must hold the lock
+func (ac *AdmissionController) take(memory float64) takeResult {
+	if ac.maxInFlight > 0 && ac.inFlight >= ac.maxInFlight {
+		return takeResult{wake: ac.released}
+	}
+	if ac.maxMemory > 0 && ac.memory+memory > ac.maxMemory {
+		return takeResult{wake: ac.released}
+	}
+
+	if ac.rate != nil {
+		if r := tryTakeMulti([]*TokenBucket{ac.rate}, []float64{1}); !r.ok {
+			return r
+		}
+	}
+
+	ac.inFlight++
+	ac.memory += memory
+	return takeResult{ok: true}
+}
+
+// Release gives the admission's concurrency slot and memory back. Safe to call more than once
+func (a *Admission) Release() {
+	a.once.Do(func() {
+		ac := a.ac
+		ac.mtx.Lock()
+		defer ac.mtx.Unlock()
+
+		ac.inFlight--
+		ac.memory -= a.memory
+
+		// Wake up everyone waiting so they can try again
+		close(ac.released)
+		ac.released = make(chan struct{})
+	})
+}
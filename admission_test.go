@@ -0,0 +1,133 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestAdmissionController_Concurrency tests that concurrency slots are enforced and given back
+func TestAdmissionController_Concurrency(t *testing.T) {
+	ac := NewAdmissionController(nil, 2, 0)
+
+	a1, ok1 := ac.TryAdmit(0)
+	_, ok2 := ac.TryAdmit(0)
+	if !ok1 || !ok2 {
+		t.Fatal("Expected first 2 admissions to succeed")
+	}
+	if _, ok := ac.TryAdmit(0); ok {
+		t.Fatal("Expected third admission to be denied with no slots left")
+	}
+
+	a1.Release()
+	a1.Release() // double release shouldn't free up an extra slot
+
+	if _, ok := ac.TryAdmit(0); !ok {
+		t.Error("Expected admission to succeed after a release")
+	}
+	if _, ok := ac.TryAdmit(0); ok {
+		t.Error("Expected double release to only free one slot")
+	}
+}
+
+// TestAdmissionController_AllOrNone tests that a denied admission doesn't take from any budget
+func TestAdmissionController_AllOrNone(t *testing.T) {
+	// 1 rate token, plenty of slots, 100 memory units
+	ac := NewAdmissionController(NewTokenBucket(1, time.Hour, 1), 10, 100)
+
+	// Too much memory, so the rate token must NOT be used up
+	if _, ok := ac.TryAdmit(150); ok {
+		t.Fatal("Expected admission over the memory budget to be denied")
+	}
+	if _, ok := ac.TryAdmit(50); !ok {
+		t.Error("Expected rate token to be untouched by the denied admission")
+	}
+	if ac.InFlight() != 1 {
+		t.Errorf("Expected 1 admission in flight, got %d", ac.InFlight())
+	}
+}
+
+// TestAdmissionController_Memory tests that memory units are held until released
+func TestAdmissionController_Memory(t *testing.T) {
+	ac := NewAdmissionController(nil, 0, 100)
+
+	a, _ := ac.TryAdmit(70)
+	if _, ok := ac.TryAdmit(40); ok {
+		t.Fatal("Expected admission to be denied with only 30 memory units left")
+	}
+
+	a.Release()
+	if _, ok := ac.TryAdmit(40); !ok {
+		t.Error("Expected memory to be available again after release")
+	}
+}
+
+// TestAdmissionController_AdmitWaitsForRelease tests that Admit wakes up when a slot is released
+func TestAdmissionController_AdmitWaitsForRelease(t *testing.T) {
+	ac := NewAdmissionController(nil, 1, 0)
+	a, _ := ac.TryAdmit(0)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		a.Release()
+	}()
+
+	start := time.Now()
+	if _, err := ac.Admit(context.Background(), 0); err != nil {
+		t.Fatalf("Admit() returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Admit() returned before the slot was released: %v", elapsed)
+	}
+}
+
+// TestAdmissionController_AdmitErrors tests context cancellation and impossible memory requests
+func TestAdmissionController_AdmitErrors(t *testing.T) {
+	ac := NewAdmissionController(nil, 1, 100)
+	ac.TryAdmit(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ac.Admit(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+
+	if _, err := ac.Admit(context.Background(), 101); err != ErrBurstExceeded {
+		t.Errorf("Expected ErrBurstExceeded, got: %v", err)
+	}
+}
+
+// TestAdmissionController_SetMaxInFlight tests that raising the limit lets new work in
+func TestAdmissionController_SetMaxInFlight(t *testing.T) {
+	ac := NewAdmissionController(nil, 1, 0)
+	ac.TryAdmit(0)
+
+	if _, ok := ac.TryAdmit(0); ok {
+		t.Fatal("Expected second admission to be denied at a limit of 1")
+	}
+
+	ac.SetMaxInFlight(2)
+	if _, ok := ac.TryAdmit(0); !ok {
+		t.Error("Expected admission to succeed after raising the limit")
+	}
+}
+
+// TestAdmissionController_PausedRate tests that a paused rate bucket stops admissions without taking a slot
+func TestAdmissionController_PausedRate(t *testing.T) {
+	rate := NewTokenBucket(10, time.Second, 10)
+	ac := NewAdmissionController(rate, 1, 0)
+	rate.Pause()
+
+	if _, ok := ac.TryAdmit(0); ok {
+		t.Error("Expected nothing admitted while the rate bucket is paused")
+	}
+	if _, err := ac.Admit(context.Background(), 0); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused, got: %v", err)
+	}
+
+	rate.Resume()
+	if _, ok := ac.TryAdmit(0); !ok {
+		t.Error("Expected the slot to still be free after the paused attempts")
+	}
+}
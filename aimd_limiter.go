@@ -0,0 +1,73 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AIMDLimiter is a rate limiter that tunes itself from the outcomes the caller reports with OnResult:
+// every success adds a fixed step to the rate, and every failure or throttle multiplies it by a
+// backoff factor (additive increase, multiplicative decrease, like TCP congestion control). That
+// backs off fast when an upstream's capacity drops and creeps back up carefully when it recovers
+type AIMDLimiter struct {
+	mtx      sync.Mutex
+	tb       *TokenBucket // the bucket whose rate we adapt
+	minRate  float64      // lowest rate we go to, per second
+	maxRate  float64      // highest rate we go to, per second
+	increase float64      // rate added per success, per second
+	backoff  float64      // factor the rate is multiplied by per failure
+	rate     float64      // current rate, per second
+}
+
+// AIMDLimiter constructor; the rate moves between minOps and maxOps per `per` (starting at maxOps), with
+// bursts up to burst. Every success adds increase ops per `per`, and every failure multiplies the rate
+// by backoff (e.g. 0.5 to halve it)
+func NewAIMDLimiter(minOps int, maxOps int, per time.Duration, burst int, increase float64, backoff float64) *AIMDLimiter {
+	if minOps <= 0 || maxOps < minOps || increase <= 0 || backoff <= 0 || backoff >= 1 {
+		panic("invalid AIMD limiter parameters")
+	}
+	tb := NewTokenBucket(maxOps, per, burst)
+
+	return &AIMDLimiter{
+		tb:       tb,
+		minRate:  float64(minOps) / per.Seconds(),
+		maxRate:  tb.rate,
+		increase: increase / per.Seconds(),
+		backoff:  backoff,
+		rate:     tb.rate,
+	}
+}
+
+// Implements Allow RateLimiter method at the current rate
+// NON-BLOCKING! Returns immediately
+func (al *AIMDLimiter) Allow() bool {
+	return al.tb.Allow()
+}
+
+// Implements Wait RateLimiter method at the current rate
+// BLOCKING!! Blocks current goroutine
+func (al *AIMDLimiter) Wait(ctx context.Context) error {
+	return al.tb.Wait(ctx)
+}
+
+// OnResult reports the outcome of a piece of admitted work: ok for success, false for a failure or
+// throttle from the upstream (e.g. a 429 or 503), and adjusts the rate accordingly
+func (al *AIMDLimiter) OnResult(ok bool) {
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+
+	if ok {
+		al.rate = min(al.rate+al.increase, al.maxRate)
+	} else {
+		al.rate = max(al.rate*al.backoff, al.minRate)
+	}
+	al.tb.setRate(al.rate, al.tb.capacity())
+}
+
+// Rate returns the current rate in operations per second
+func (al *AIMDLimiter) Rate() float64 {
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+	return al.rate
+}
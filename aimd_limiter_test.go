@@ -0,0 +1,80 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAIMDLimiter_Decrease tests that failures cut the rate multiplicatively, down to the floor
+func TestAIMDLimiter_Decrease(t *testing.T) {
+	al := NewAIMDLimiter(10, 100, time.Second, 10, 1, 0.5)
+
+	al.OnResult(false)
+	if rate := al.Rate(); rate != 50 {
+		t.Errorf("Expected rate to halve to 50/s, got %v", rate)
+	}
+
+	for i := 0; i < 10; i++ {
+		al.OnResult(false)
+	}
+	if rate := al.Rate(); rate != 10 {
+		t.Errorf("Expected rate to bottom out at 10/s, got %v", rate)
+	}
+}
+
+// TestAIMDLimiter_Increase tests that successes add to the rate, up to the max
+func TestAIMDLimiter_Increase(t *testing.T) {
+	al := NewAIMDLimiter(10, 100, time.Second, 10, 2, 0.5)
+	al.OnResult(false) // 50/s
+
+	for i := 0; i < 5; i++ {
+		al.OnResult(true)
+	}
+	if rate := al.Rate(); math.Abs(rate-60) > 1e-9 {
+		t.Errorf("Expected rate to grow to 60/s, got %v", rate)
+	}
+
+	for i := 0; i < 100; i++ {
+		al.OnResult(true)
+	}
+	if rate := al.Rate(); rate != 100 {
+		t.Errorf("Expected rate to top out at 100/s, got %v", rate)
+	}
+}
+
+// TestAIMDLimiter_AppliesRate tests that the bucket actually refills at the adapted rate
+func TestAIMDLimiter_AppliesRate(t *testing.T) {
+	al := NewAIMDLimiter(1, 100, time.Second, 1, 1, 0.1)
+	al.Allow()
+	al.OnResult(false) // 10/s, so a token every 100ms
+
+	time.Sleep(50 * time.Millisecond)
+	if al.Allow() {
+		t.Error("Expected no token after 50ms at 10/s")
+	}
+	time.Sleep(70 * time.Millisecond)
+	if !al.Allow() {
+		t.Error("Expected a token after 120ms at 10/s")
+	}
+}
+
+// TestAIMDLimiter_ConcurrentWaitAndResult tests that waiting while results adjust the rate is safe (run with -race)
+func TestAIMDLimiter_ConcurrentWaitAndResult(t *testing.T) {
+	al := NewAIMDLimiter(100, 1000, time.Second, 10, 10, 0.5)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 20 {
+				al.Wait(context.Background())
+				al.OnResult(i%3 != 0)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,96 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// BackoffPolicy decides how long to wait before a retry, given which retry this is (1 for the first
+// retry) and how long we waited before the previous one (0 before the first retry)
+type BackoffPolicy func(retry int, prev time.Duration) time.Duration
+
+// ConstantBackoff waits the same amount of time before every retry
+func ConstantBackoff(d time.Duration) BackoffPolicy {
+	return func(int, time.Duration) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff doubles the wait with every retry, starting at base and capped at maxDelay
+func ExponentialBackoff(base time.Duration, maxDelay time.Duration) BackoffPolicy {
+	return func(retry int, _ time.Duration) time.Duration {
+		d := base
+		for i := 1; i < retry && d < maxDelay; i++ {
+			d *= 2
+		}
+		return min(d, maxDelay)
+	}
+}
+
+// DecorrelatedJitterBackoff picks a random wait between base and 3x the previous wait, capped at
+// maxDelay. The randomness spreads retrying clients out so they don't all come back at the same moment
+func DecorrelatedJitterBackoff(base time.Duration, maxDelay time.Duration) BackoffPolicy {
+	return func(_ int, prev time.Duration) time.Duration {
+		upper := max(prev*3, base)
+		d := base + rand.N(upper-base+1)
+		return min(d, maxDelay)
+	}
+}
+
+// DoWithRetry calls fn up to maxAttempts times until it succeeds, going through the limiter before every
+// attempt and backing off between them according to policy. Because the backoff is slept first and then
+// the limiter is waited on (and has been refilling the whole time), the effective delay before a retry
+// is the larger of the two rather than their sum, so there's no need to compose them by hand.
+// Returns nil on success, ErrWaitCancelled or ErrWaitDeadline (wrapping the context's error) if ctx
+// ends first, or fn's last error.
+// fn can wrap an error with Permanent to stop retrying right away
+func DoWithRetry(ctx context.Context, limiter RateLimiter, policy BackoffPolicy, maxAttempts int, fn func(ctx context.Context) error) error {
+	if limiter == nil || policy == nil || maxAttempts <= 0 {
+		panic("invalid retry parameters")
+	}
+
+	var err error
+	var delay time.Duration
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		// Back off before every retry (but not before the first attempt)
+		if attempt > 1 {
+			delay = policy(attempt-1, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return waitError(ctx)
+			}
+		}
+
+		if waitErr := limiter.Wait(ctx); waitErr != nil {
+			return waitErr
+		}
+
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+
+		// No point retrying something that will never succeed
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+	}
+	return err
+}
+
+// Permanent wraps an error to tell DoWithRetry not to retry it (e.g. a 400 Bad Request).
+// DoWithRetry returns the original, unwrapped error
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Error wrapper marking an error as not worth retrying
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
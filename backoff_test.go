@@ -0,0 +1,124 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestExponentialBackoff tests that delays double and then cap out
+func TestExponentialBackoff(t *testing.T) {
+	policy := ExponentialBackoff(100*time.Millisecond, time.Second)
+
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, want := range expected {
+		if got := policy(i+1, 0); got != want*time.Millisecond {
+			t.Errorf("Retry %d: expected %v, got %v", i+1, want*time.Millisecond, got)
+		}
+	}
+}
+
+// TestDecorrelatedJitterBackoff tests that delays stay between base and the cap
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	policy := DecorrelatedJitterBackoff(10*time.Millisecond, time.Second)
+
+	var prev time.Duration
+	for i := range 50 {
+		d := policy(i+1, prev)
+		if d < 10*time.Millisecond || d > time.Second || d > max(prev*3, 10*time.Millisecond) {
+			t.Fatalf("Retry %d: delay %v out of range (prev %v)", i+1, d, prev)
+		}
+		prev = d
+	}
+}
+
+// TestDoWithRetry_SucceedsAfterFailures tests that fn is retried until it succeeds
+func TestDoWithRetry_SucceedsAfterFailures(t *testing.T) {
+	limiter := NewTokenBucket(100, time.Second, 10)
+
+	calls := 0
+	err := DoWithRetry(context.Background(), limiter, ConstantBackoff(time.Millisecond), 5, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("Expected success, got: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+// TestDoWithRetry_GivesUp tests that the last error is returned after maxAttempts
+func TestDoWithRetry_GivesUp(t *testing.T) {
+	limiter := NewTokenBucket(100, time.Second, 10)
+	failure := errors.New("permanent failure")
+
+	calls := 0
+	err := DoWithRetry(context.Background(), limiter, ConstantBackoff(time.Millisecond), 3, func(context.Context) error {
+		calls++
+		return failure
+	})
+
+	if err != failure {
+		t.Errorf("Expected the last error, got: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+// TestDoWithRetry_DelayIsMaxNotSum tests that backoff and limiter waits overlap instead of adding up
+func TestDoWithRetry_DelayIsMaxNotSum(t *testing.T) {
+	// Limiter with 1 token refilling every 100ms, and a 100ms backoff
+	limiter := NewTokenBucket(10, time.Second, 1)
+
+	calls := 0
+	start := time.Now()
+	DoWithRetry(context.Background(), limiter, ConstantBackoff(100*time.Millisecond), 2, func(context.Context) error {
+		calls++
+		return errors.New("failure")
+	})
+	elapsed := time.Since(start)
+
+	// Retry needs both the 100ms backoff and a refilled token, which overlap to ~100ms (not 200ms)
+	if elapsed < 90*time.Millisecond || elapsed > 180*time.Millisecond {
+		t.Errorf("Expected retry delay of ~100ms, took %v", elapsed)
+	}
+}
+
+// TestDoWithRetry_ContextCancelled tests that cancellation stops retrying
+func TestDoWithRetry_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := DoWithRetry(ctx, NewTokenBucket(100, time.Second, 10), ConstantBackoff(time.Second), 5, func(context.Context) error {
+		return errors.New("failure")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrWaitDeadline) {
+		t.Errorf("Expected ErrWaitDeadline and DeadlineExceeded, got: %v", err)
+	}
+}
+
+// TestDoWithRetry_Permanent tests that permanent errors stop retrying right away
+func TestDoWithRetry_Permanent(t *testing.T) {
+	failure := errors.New("bad request")
+
+	calls := 0
+	err := DoWithRetry(context.Background(), NewTokenBucket(100, time.Second, 10), ConstantBackoff(time.Millisecond), 5, func(context.Context) error {
+		calls++
+		return Permanent(failure)
+	})
+
+	if err != failure {
+		t.Errorf("Expected the unwrapped error, got: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
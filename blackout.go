@@ -0,0 +1,171 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// BlackoutWindow describes a recurring time-of-day interval (e.g. a nightly maintenance window)
+// during which traffic should be denied or shaped. Start and End are offsets from local midnight
+// in Location, so "02:00 to 04:00 America/New_York" stays correct across DST changes
+type BlackoutWindow struct {
+	Start    time.Duration  // offset from local midnight when the window opens (e.g. 2*time.Hour)
+	End      time.Duration  // offset from local midnight when the window closes; End < Start wraps past midnight
+	Location *time.Location // timezone the offsets are interpreted in; nil means UTC
+	Weekdays []time.Weekday // days the window opens on; empty means every day
+}
+
+// Internal helper that reports whether t falls inside the window, and if so, when the window closes
+func (w BlackoutWindow) active(t time.Time) (bool, time.Time) {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+
+	// Offset of t from local midnight, based on the wall clock so DST shifts don't skew it
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+
+	day := t // the day the window opened on
+	if w.Start <= w.End {
+		if offset < w.Start || offset >= w.End {
+			return false, time.Time{}
+		}
+	} else {
+		// Window wraps past midnight, so we're either in the evening part or the early morning part
+		switch {
+		case offset >= w.Start:
+			// Evening part; the window closes tomorrow
+		case offset < w.End:
+			// Early morning part; the window opened yesterday
+			day = t.AddDate(0, 0, -1)
+		default:
+			return false, time.Time{}
+		}
+	}
+
+	if !w.opensOn(day.Weekday()) {
+		return false, time.Time{}
+	}
+
+	// Work out the wall clock time the window closes at
+	closeDay := day
+	if w.Start > w.End {
+		closeDay = day.AddDate(0, 0, 1)
+	}
+	h, m, s := int(w.End/time.Hour), int(w.End%time.Hour/time.Minute), int(w.End%time.Minute/time.Second)
+	end := time.Date(closeDay.Year(), closeDay.Month(), closeDay.Day(), h, m, s, int(w.End%time.Second), loc)
+
+	return true, end
+}
+
+// Internal helper to check if the window is scheduled to open on the given weekday
+func (w BlackoutWindow) opensOn(day time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Blackout wraps a RateLimiter and applies calendar based blackout windows on top of it.
+// During a window, traffic is either denied outright or shaped through a separate (usually stricter) limiter
+type Blackout struct {
+	limiter RateLimiter      // limiter used outside of blackout windows
+	shaped  RateLimiter      // limiter used inside blackout windows; nil means deny everything
+	windows []BlackoutWindow // configured blackout windows
+}
+
+// Blackout constructor; pass a nil shaped limiter to deny all traffic during the windows,
+// or a stricter limiter to shape traffic through it instead
+func NewBlackout(limiter RateLimiter, shaped RateLimiter, windows ...BlackoutWindow) *Blackout {
+	if limiter == nil {
+		panic("invalid blackout parameters")
+	}
+	for _, w := range windows {
+		// Offsets have to fall within a day, and a window that opens and closes at the same time would never be active
+		if w.Start < 0 || w.Start > 24*time.Hour || w.End < 0 || w.End > 24*time.Hour || w.Start == w.End {
+			panic("invalid blackout parameters")
+		}
+	}
+
+	return &Blackout{
+		limiter: limiter,
+		shaped:  shaped,
+		windows: windows,
+	}
+}
+
+// Implements Allow RateLimiter method; denies (or shapes) the request if we're inside a blackout window
+// NON-BLOCKING! Returns immediately
+func (b *Blackout) Allow() bool {
+	if in, _ := b.current(time.Now()); in {
+		if b.shaped == nil {
+			return false
+		}
+		return b.shaped.Allow()
+	}
+	return b.limiter.Allow()
+}
+
+// Implements Wait RateLimiter method; in deny mode it blocks until the blackout window closes,
+// and in shaping mode it waits on the shaped limiter instead
+// BLOCKING!! Blocks current goroutine
+func (b *Blackout) Wait(ctx context.Context) error {
+	for {
+		in, end := b.current(time.Now())
+		if !in {
+			return b.limiter.Wait(ctx)
+		}
+		if b.shaped != nil {
+			return b.shaped.Wait(ctx)
+		}
+
+		// Sleep until the window closes, then check again in case another window follows right after
+		select {
+		case <-time.After(time.Until(end)):
+			continue
+		case <-ctx.Done():
+			return waitError(ctx)
+		}
+	}
+}
+
+// RetryAfter returns how long until the current blackout window closes and service resumes,
+// or 0 if we're not in a blackout window right now
+func (b *Blackout) RetryAfter() time.Duration {
+	in, end := b.current(time.Now())
+	if !in {
+		return 0
+	}
+	return time.Until(end)
+}
+
+// Internal helper that reports whether t falls inside any blackout window, and when service resumes.
+// If windows overlap or are back to back, the resume time is the latest close time among them.
+// Windows that together cover the whole day would chain forever, so we give up after a week's worth
+// of them and report the resume time as a week out
+func (b *Blackout) current(t time.Time) (bool, time.Time) {
+	var in bool
+	var end time.Time
+
+	for range 7*len(b.windows) + 1 {
+		found := false
+		for _, w := range b.windows {
+			if ok, e := w.active(t); ok && e.After(end) {
+				in, end, found = true, e, true
+			}
+		}
+		if !found {
+			return in, end
+		}
+		// Check if another window is still active right when this one closes
+		t = end
+	}
+	return in, end
+}
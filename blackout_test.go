@@ -0,0 +1,199 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBlackoutWindow_Active tests that a simple daytime window is detected correctly
+func TestBlackoutWindow_Active(t *testing.T) {
+	w := BlackoutWindow{Start: 2 * time.Hour, End: 4 * time.Hour}
+
+	// 03:00 UTC is inside the window, which closes at 04:00 the same day
+	in, end := w.active(time.Date(2024, 3, 5, 3, 0, 0, 0, time.UTC))
+	if !in {
+		t.Fatal("Expected 03:00 to be inside the 02:00-04:00 window")
+	}
+	if want := time.Date(2024, 3, 5, 4, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("Expected window to close at %v, got %v", want, end)
+	}
+
+	// 04:00 is the end boundary and should NOT be inside the window
+	if in, _ := w.active(time.Date(2024, 3, 5, 4, 0, 0, 0, time.UTC)); in {
+		t.Error("Expected 04:00 to be outside the 02:00-04:00 window")
+	}
+}
+
+// TestBlackoutWindow_WrapsMidnight tests windows that start in the evening and end the next morning
+func TestBlackoutWindow_WrapsMidnight(t *testing.T) {
+	w := BlackoutWindow{Start: 23 * time.Hour, End: 1 * time.Hour}
+
+	// 23:30 should close at 01:00 the next day
+	in, end := w.active(time.Date(2024, 3, 5, 23, 30, 0, 0, time.UTC))
+	if !in || !end.Equal(time.Date(2024, 3, 6, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 23:30 to be inside the window closing next day at 01:00, got %v %v", in, end)
+	}
+
+	// 00:30 should close at 01:00 the same day
+	in, end = w.active(time.Date(2024, 3, 6, 0, 30, 0, 0, time.UTC))
+	if !in || !end.Equal(time.Date(2024, 3, 6, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 00:30 to be inside the window closing at 01:00, got %v %v", in, end)
+	}
+
+	// Noon is outside
+	if in, _ := w.active(time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)); in {
+		t.Error("Expected noon to be outside the window")
+	}
+}
+
+// TestBlackoutWindow_Timezone tests that offsets are interpreted in the configured timezone
+func TestBlackoutWindow_Timezone(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	w := BlackoutWindow{Start: 2 * time.Hour, End: 4 * time.Hour, Location: loc}
+
+	// 08:00 UTC is 03:00 in UTC-5, so we should be inside the window
+	if in, _ := w.active(time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)); !in {
+		t.Error("Expected 08:00 UTC to be inside a 02:00-04:00 UTC-5 window")
+	}
+
+	// 03:00 UTC is 22:00 the day before in UTC-5, so we should be outside
+	if in, _ := w.active(time.Date(2024, 3, 5, 3, 0, 0, 0, time.UTC)); in {
+		t.Error("Expected 03:00 UTC to be outside a 02:00-04:00 UTC-5 window")
+	}
+}
+
+// TestBlackoutWindow_Weekdays tests that windows only open on configured days
+func TestBlackoutWindow_Weekdays(t *testing.T) {
+	// Window runs Saturday night into Sunday morning
+	w := BlackoutWindow{Start: 22 * time.Hour, End: 2 * time.Hour, Weekdays: []time.Weekday{time.Saturday}}
+
+	// 2024-03-09 is a Saturday
+	if in, _ := w.active(time.Date(2024, 3, 9, 23, 0, 0, 0, time.UTC)); !in {
+		t.Error("Expected Saturday 23:00 to be inside the window")
+	}
+	// Sunday 01:00 is still part of Saturday's window
+	if in, _ := w.active(time.Date(2024, 3, 10, 1, 0, 0, 0, time.UTC)); !in {
+		t.Error("Expected Sunday 01:00 to be inside Saturday's window")
+	}
+	// Sunday 23:00 is a new window that isn't scheduled
+	if in, _ := w.active(time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC)); in {
+		t.Error("Expected Sunday 23:00 to be outside the window")
+	}
+}
+
+// TestBlackout_BackToBackWindows tests that the resume time skips over windows that follow each other
+func TestBlackout_BackToBackWindows(t *testing.T) {
+	b := NewBlackout(NewTokenBucket(10, time.Second, 10), nil,
+		BlackoutWindow{Start: 1 * time.Hour, End: 2 * time.Hour},
+		BlackoutWindow{Start: 2 * time.Hour, End: 3 * time.Hour},
+	)
+
+	in, end := b.current(time.Date(2024, 3, 5, 1, 30, 0, 0, time.UTC))
+	if !in || !end.Equal(time.Date(2024, 3, 5, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected service to resume at 03:00, got %v %v", in, end)
+	}
+}
+
+// Internal test helper that builds a window covering the current moment
+func windowAroundNow() BlackoutWindow {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	offset := now.Sub(midnight)
+	return BlackoutWindow{Start: max(offset-time.Minute, 0), End: min(offset+time.Minute, 24*time.Hour)}
+}
+
+// TestBlackout_FullDay tests that windows covering the whole day don't chain forever
+func TestBlackout_FullDay(t *testing.T) {
+	for _, windows := range [][]BlackoutWindow{
+		{{Start: 0, End: 24 * time.Hour}},
+		{{Start: 0, End: 12 * time.Hour}, {Start: 12 * time.Hour, End: 24 * time.Hour}},
+	} {
+		b := NewBlackout(NewTokenBucket(10, time.Second, 10), nil, windows...)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if b.Allow() {
+				t.Error("Expected Allow() to be denied all day")
+			}
+			if retryAfter := b.RetryAfter(); retryAfter < 6*24*time.Hour {
+				t.Errorf("Expected RetryAfter of about a week, got %v", retryAfter)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Expected Allow() and RetryAfter() to return with full day windows")
+		}
+	}
+}
+
+// TestNewBlackout_InvalidWindows tests that windows outside a day or with no length are rejected
+func TestNewBlackout_InvalidWindows(t *testing.T) {
+	for _, w := range []BlackoutWindow{
+		{Start: time.Hour, End: time.Hour},
+		{Start: -time.Hour, End: time.Hour},
+		{Start: time.Hour, End: 25 * time.Hour},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected window %v to panic", w)
+				}
+			}()
+			NewBlackout(NewTokenBucket(10, time.Second, 10), nil, w)
+		}()
+	}
+}
+
+// TestBlackout_Deny tests that Allow is denied and RetryAfter is reported during a window
+func TestBlackout_Deny(t *testing.T) {
+	b := NewBlackout(NewTokenBucket(10, time.Second, 10), nil, windowAroundNow())
+
+	if b.Allow() {
+		t.Error("Expected Allow() to be denied during a blackout window")
+	}
+
+	retryAfter := b.RetryAfter()
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("Expected RetryAfter within a minute, got %v", retryAfter)
+	}
+
+	// Wait should block until the context gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+}
+
+// TestBlackout_Shape tests that traffic goes through the shaped limiter during a window
+func TestBlackout_Shape(t *testing.T) {
+	b := NewBlackout(NewTokenBucket(10, time.Second, 10), NewTokenBucket(1, time.Minute, 1), windowAroundNow())
+
+	// Shaped limiter only has 1 token
+	if !b.Allow() {
+		t.Error("Expected first Allow() to succeed through the shaped limiter")
+	}
+	if b.Allow() {
+		t.Error("Expected second Allow() to be denied by the shaped limiter")
+	}
+}
+
+// TestBlackout_OutsideWindow tests that the regular limiter is used outside of any window
+func TestBlackout_OutsideWindow(t *testing.T) {
+	b := NewBlackout(NewTokenBucket(10, time.Second, 1), nil)
+
+	if !b.Allow() {
+		t.Error("Expected Allow() to succeed outside of a blackout window")
+	}
+	if b.Allow() {
+		t.Error("Expected Allow() to be limited by the regular limiter")
+	}
+	if b.RetryAfter() != 0 {
+		t.Error("Expected RetryAfter to be 0 outside of a blackout window")
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimiter
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+)
+
+// NoClientCert is the key the client certificate KeyFuncs map requests without a verified client
+// certificate to, so they all share one bucket
+const NoClientCert = "no-client-cert"
+
+// ClientCertSPIFFEID is a KeyFunc that keys requests by the SPIFFE ID (the spiffe:// URI SAN) of the
+// verified TLS client certificate, for service-to-service traffic where IPs are meaningless behind
+// load balancers. Certificates without a SPIFFE ID fall back to their fingerprint
+func ClientCertSPIFFEID(r *http.Request) string {
+	cert := clientCert(r)
+	if cert == nil {
+		return NoClientCert
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	return certFingerprint(cert)
+}
+
+// ClientCertSAN is a KeyFunc that keys requests by the first DNS name (or else email address) in the
+// verified TLS client certificate's SANs. Certificates without either fall back to their fingerprint
+func ClientCertSAN(r *http.Request) string {
+	cert := clientCert(r)
+	switch {
+	case cert == nil:
+		return NoClientCert
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+	return certFingerprint(cert)
+}
+
+// ClientCertFingerprint is a KeyFunc that keys requests by the SHA-256 fingerprint of the verified
+// TLS client certificate, so every certificate gets its own budget even if names are reused
+func ClientCertFingerprint(r *http.Request) string {
+	cert := clientCert(r)
+	if cert == nil {
+		return NoClientCert
+	}
+	return certFingerprint(cert)
+}
+
+// Internal helper that returns the client's leaf certificate, if the server verified one.
+// Certificates the server didn't verify (e.g. with tls.RequestClientCert) are ignored, since
+// anyone could present them
+func clientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// Internal helper that returns the hex SHA-256 fingerprint of a certificate
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,53 @@
+package ratelimiter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Helper that builds a request carrying a verified client certificate
+func certRequest(cert *x509.Certificate) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return req
+}
+
+// TestClientCertKeys tests keying by the different certificate attributes
+func TestClientCertKeys(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	withIDs := &x509.Certificate{Raw: []byte("a"), URIs: []*url.URL{spiffe}, DNSNames: []string{"billing.internal"}}
+	bare := &x509.Certificate{Raw: []byte("b")}
+
+	if got := ClientCertSPIFFEID(certRequest(withIDs)); got != "spiffe://example.org/billing" {
+		t.Errorf("Expected SPIFFE ID, got %q", got)
+	}
+	if got := ClientCertSAN(certRequest(withIDs)); got != "billing.internal" {
+		t.Errorf("Expected DNS SAN, got %q", got)
+	}
+
+	// Certificates without the attribute fall back to the fingerprint
+	fingerprint := ClientCertFingerprint(certRequest(bare))
+	if len(fingerprint) != 64 || fingerprint == ClientCertFingerprint(certRequest(withIDs)) {
+		t.Errorf("Expected distinct SHA-256 fingerprints, got %q", fingerprint)
+	}
+	if ClientCertSPIFFEID(certRequest(bare)) != fingerprint || ClientCertSAN(certRequest(bare)) != fingerprint {
+		t.Error("Expected fallback to the fingerprint")
+	}
+}
+
+// TestClientCertKeys_Unverified tests that requests without a verified certificate share one key
+func TestClientCertKeys_Unverified(t *testing.T) {
+	plain := httptest.NewRequest(http.MethodGet, "/", nil)
+	unverified := httptest.NewRequest(http.MethodGet, "/", nil)
+	unverified.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Raw: []byte("a")}}}
+
+	for _, req := range []*http.Request{plain, unverified} {
+		if got := ClientCertFingerprint(req); got != NoClientCert {
+			t.Errorf("Expected %q, got %q", NoClientCert, got)
+		}
+	}
+}
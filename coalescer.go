@@ -0,0 +1,82 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrCoalescedPanic is returned to callers sharing the result of an operation that panicked instead
+// of returning; the panic itself carries on in the goroutine that ran it
+var ErrCoalescedPanic = errors.New("ratelimiter: coalesced operation panicked")
+
+// Coalescer runs idempotent keyed operations through a limiter, and when one gets denied, lets it
+// share the result of an identical operation (same key) that's already in flight instead of failing
+// or retrying. That cuts duplicate load exactly when the limiter says capacity is scarce
+type Coalescer[T any] struct {
+	limiter RateLimiter
+	mtx     sync.Mutex
+	calls   map[string]*coalescedCall[T] // latest in flight call per key
+}
+
+// An in flight operation and, once done is closed, its result
+type coalescedCall[T any] struct {
+	done   chan struct{}
+	result T
+	err    error
+}
+
+// Coalescer constructor
+func NewCoalescer[T any](limiter RateLimiter) *Coalescer[T] {
+	if limiter == nil {
+		panic("invalid coalescer parameters")
+	}
+	return &Coalescer[T]{limiter: limiter, calls: make(map[string]*coalescedCall[T])}
+}
+
+// Do runs fn if the limiter allows it. If it doesn't and an operation with the same key is in flight,
+// Do waits for that operation and returns its result instead, with shared set to true. If it doesn't
+// and nothing is in flight, Do fails with ErrRateLimited. If fn panics, callers sharing its result
+// get ErrCoalescedPanic
+// BLOCKING!! Blocks current goroutine while fn runs or while waiting on a shared result
+func (c *Coalescer[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (result T, shared bool, err error) {
+	c.mtx.Lock()
+	if !c.limiter.Allow() {
+		call, ok := c.calls[key]
+		c.mtx.Unlock()
+		if !ok {
+			return result, false, ErrRateLimited
+		}
+
+		select {
+		case <-call.done:
+			return call.result, true, call.err
+		case <-ctx.Done():
+			return result, false, waitError(ctx)
+		}
+	}
+
+	// Allowed; run it ourselves, and let denied callers with the same key share our result
+	call := &coalescedCall[T]{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mtx.Unlock()
+
+	returned := false
+	defer func() {
+		// fn never returned, so there's no result to share; tell the callers waiting on it why
+		if !returned {
+			call.err = ErrCoalescedPanic
+		}
+
+		c.mtx.Lock()
+		if c.calls[key] == call {
+			delete(c.calls, key)
+		}
+		c.mtx.Unlock()
+		close(call.done)
+	}()
+
+	call.result, call.err = fn(ctx)
+	returned = true
+	return call.result, false, call.err
+}
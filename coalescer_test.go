@@ -0,0 +1,102 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCoalescer_SharesResult tests that a denied call shares the result of an in flight one
+func TestCoalescer_SharesResult(t *testing.T) {
+	c := NewCoalescer[string](NewTokenBucket(1, time.Hour, 1))
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go c.Do(context.Background(), "report", func(context.Context) (string, error) {
+		close(started)
+		<-release
+		return "done", nil
+	})
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+
+	result, shared, err := c.Do(context.Background(), "report", func(context.Context) (string, error) {
+		t.Error("Expected denied call not to run")
+		return "", nil
+	})
+	if err != nil || !shared || result != "done" {
+		t.Errorf("Expected shared result %q, got %q shared=%v err=%v", "done", result, shared, err)
+	}
+}
+
+// TestCoalescer_Denied tests that a denied call with nothing to share fails
+func TestCoalescer_Denied(t *testing.T) {
+	c := NewCoalescer[int](NewTokenBucket(1, time.Hour, 1))
+
+	result, shared, err := c.Do(context.Background(), "a", func(context.Context) (int, error) { return 1, nil })
+	if err != nil || shared || result != 1 {
+		t.Errorf("Expected allowed call to run, got %d shared=%v err=%v", result, shared, err)
+	}
+
+	// Out of budget and nothing in flight for the key
+	if _, _, err := c.Do(context.Background(), "a", func(context.Context) (int, error) { return 2, nil }); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited error, got: %v", err)
+	}
+}
+
+// TestCoalescer_ContextCancelled tests that waiting on a shared result respects the context
+func TestCoalescer_ContextCancelled(t *testing.T) {
+	c := NewCoalescer[int](NewTokenBucket(1, time.Hour, 1))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	go c.Do(context.Background(), "a", func(context.Context) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.Do(ctx, "a", func(context.Context) (int, error) { return 2, nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+}
+
+// TestCoalescer_Panic tests that callers sharing an operation that panics get an error rather than
+// a zero result, while the panic still reaches the caller that ran it
+func TestCoalescer_Panic(t *testing.T) {
+	c := NewCoalescer[int](NewTokenBucket(1, time.Hour, 1))
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	recovered := make(chan any)
+	go func() {
+		defer func() { recovered <- recover() }()
+		c.Do(context.Background(), "a", func(context.Context) (int, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+
+	if _, shared, err := c.Do(context.Background(), "a", func(context.Context) (int, error) { return 0, nil }); !shared || !errors.Is(err, ErrCoalescedPanic) {
+		t.Errorf("Expected shared ErrCoalescedPanic, got shared=%v err=%v", shared, err)
+	}
+	if r := <-recovered; r != "boom" {
+		t.Errorf("Expected the panic to reach the caller that ran it, got %v", r)
+	}
+}
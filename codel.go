@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"math"
+	"time"
+)
+
+// WithCoDel applies CoDel (Controlled Delay) queue management to Wait. If waiters keep spending
+// longer than target in the queue for at least a whole interval, some of them start getting shed
+// with ErrWaitShed instead of being served, more and more often until the wait time drops back
+// under target. This keeps wait latency bounded under sustained overload instead of growing forever.
+// Typical values are a target of ~5% of interval, e.g. 50ms and 1s
+func WithCoDel(target time.Duration, interval time.Duration) TokenBucketOption {
+	if target <= 0 || interval <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+	return func(tb *TokenBucket) {
+		tb.codel = &codel{target: target, interval: interval}
+	}
+}
+
+// Internal CoDel state, following the algorithm from RFC 8289. Decisions are made as waiters are
+// about to be served (dequeued), based on how long they spent waiting (their sojourn time)
+type codel struct {
+	target         time.Duration // acceptable standing queue delay
+	interval       time.Duration // how long the delay has to stay above target before we start shedding
+	firstAboveTime time.Time     // when we'll start shedding if delay stays above target; zero if it's below
+	dropping       bool          // whether we're currently in the shedding state
+	dropNext       time.Time     // when the next waiter gets shed while in the shedding state
+	count          int           // waiters shed since entering the shedding state
+	lastCount      int           // count when we last left the shedding state
+}
+
+// Internal helper that decides whether the waiter being served now should be shed instead
+// Caller must hold the bucket's lock
+func (c *codel) shouldDrop(now time.Time, sojourn time.Duration) bool {
+	okToDrop := false
+	if sojourn < c.target {
+		// Queue delay is fine, reset the clock
+		c.firstAboveTime = time.Time{}
+	} else if c.firstAboveTime.IsZero() {
+		// Just went above target; give it an interval to sort itself out
+		c.firstAboveTime = now.Add(c.interval)
+	} else if !now.Before(c.firstAboveTime) {
+		okToDrop = true
+	}
+
+	if c.dropping {
+		if !okToDrop {
+			// Delay is back under control
+			c.dropping = false
+			return false
+		}
+		if !now.Before(c.dropNext) {
+			// Shed again, and schedule the next one sooner
+			c.count++
+			c.dropNext = c.controlLaw(c.dropNext)
+			return true
+		}
+		return false
+	}
+
+	if okToDrop {
+		c.dropping = true
+
+		// If we were shedding recently, pick up near where we left off instead of starting over
+		delta := c.count - c.lastCount
+		if delta > 1 && now.Sub(c.dropNext) < 16*c.interval {
+			c.count = delta
+		} else {
+			c.count = 1
+		}
+		c.lastCount = c.count
+		c.dropNext = c.controlLaw(now)
+		return true
+	}
+	return false
+}
+
+// Internal helper implementing CoDel's control law; the gap between sheds shrinks with
+// the square root of how many we've shed so far
+func (c *codel) controlLaw(t time.Time) time.Time {
+	return t.Add(time.Duration(float64(c.interval) / math.Sqrt(float64(c.count))))
+}
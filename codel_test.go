@@ -0,0 +1,83 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCoDel_NoDropUnderTarget tests that waiters under the target delay are never shed
+func TestCoDel_NoDropUnderTarget(t *testing.T) {
+	c := &codel{target: 10 * time.Millisecond, interval: 100 * time.Millisecond}
+	now := time.Now()
+
+	for i := range 100 {
+		if c.shouldDrop(now.Add(time.Duration(i)*10*time.Millisecond), 5*time.Millisecond) {
+			t.Fatal("Expected no drops while sojourn time stays under target")
+		}
+	}
+}
+
+// TestCoDel_DropsAfterInterval tests that shedding only starts once delay stays high for a whole interval,
+// then speeds up, and stops once delay recovers
+func TestCoDel_DropsAfterInterval(t *testing.T) {
+	c := &codel{target: 10 * time.Millisecond, interval: 100 * time.Millisecond}
+	now := time.Now()
+
+	// Delay goes above target, but we give it an interval before shedding anything
+	if c.shouldDrop(now, 50*time.Millisecond) {
+		t.Fatal("Expected no drop right after going above target")
+	}
+	if c.shouldDrop(now.Add(50*time.Millisecond), 50*time.Millisecond) {
+		t.Fatal("Expected no drop before a full interval above target")
+	}
+
+	// A full interval later we start shedding
+	if !c.shouldDrop(now.Add(100*time.Millisecond), 50*time.Millisecond) {
+		t.Fatal("Expected a drop after a full interval above target")
+	}
+
+	// Count drops over the next second of sustained overload, checking every 10ms
+	drops := 0
+	for i := 1; i <= 100; i++ {
+		if c.shouldDrop(now.Add(100*time.Millisecond+time.Duration(i)*10*time.Millisecond), 50*time.Millisecond) {
+			drops++
+		}
+	}
+	// Control law spaces drops at interval/sqrt(count), so we should see more than one per interval
+	if drops <= 10 {
+		t.Errorf("Expected drops to speed up under sustained overload, got %d in 10 intervals", drops)
+	}
+
+	// Once delay drops under target we leave the shedding state
+	if c.shouldDrop(now.Add(2*time.Second), time.Millisecond) || c.dropping {
+		t.Error("Expected shedding to stop once delay is back under target")
+	}
+}
+
+// TestWait_CoDelSheds tests that sustained overload makes Wait shed some waiters
+func TestWait_CoDelSheds(t *testing.T) {
+	// 100 tokens per second with no burst, and CoDel with a tight target
+	tb := NewTokenBucket(100, time.Second, 1, WithCoDel(5*time.Millisecond, 20*time.Millisecond))
+	tb.Allow()
+
+	// 30 waiters piling up on a limiter that serves 1 per 10ms means long queue delays
+	var mtx sync.Mutex
+	shed := 0
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Go(func() {
+			if err := tb.Wait(context.Background()); err == ErrWaitShed {
+				mtx.Lock()
+				shed++
+				mtx.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if shed == 0 {
+		t.Error("Expected some waiters to be shed under sustained overload")
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimiter
+
+import "context"
+
+// ConcurrencyLimiter caps how many operations can be outstanding at once, no matter how fast they
+// come in. A rate limit alone lets work pile up when individual operations get slow; this keeps the
+// number in flight bounded instead. Every successful Acquire (or Allow/Wait, which it also implements
+// so it can be used anywhere a RateLimiter is expected) must be paired with a Release
+type ConcurrencyLimiter struct {
+	slots chan struct{} // one buffered entry per operation in flight
+}
+
+// ConcurrencyLimiter constructor; allows up to maxInFlight operations at once
+func NewConcurrencyLimiter(maxInFlight int) *ConcurrencyLimiter {
+	if maxInFlight <= 0 {
+		panic("invalid concurrency limiter parameters")
+	}
+
+	return &ConcurrencyLimiter{slots: make(chan struct{}, maxInFlight)}
+}
+
+// TryAcquire takes a slot if one is free
+// NON-BLOCKING! Returns immediately
+func (cl *ConcurrencyLimiter) TryAcquire() bool {
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Acquire blocks until a slot is free and takes it
+// BLOCKING!! Blocks current goroutine
+func (cl *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	select {
+	case cl.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return waitError(ctx)
+	}
+}
+
+// Release gives back a slot taken by Acquire, TryAcquire, Allow or Wait
+func (cl *ConcurrencyLimiter) Release() {
+	select {
+	case <-cl.slots:
+	default:
+		panic("ratelimiter: Release without Acquire")
+	}
+}
+
+// InFlight returns how many slots are currently taken
+func (cl *ConcurrencyLimiter) InFlight() int {
+	return len(cl.slots)
+}
+
+// Implements Allow RateLimiter method; same as TryAcquire, so an allowed request must call Release
+// NON-BLOCKING! Returns immediately
+func (cl *ConcurrencyLimiter) Allow() bool {
+	return cl.TryAcquire()
+}
+
+// Implements Wait RateLimiter method; same as Acquire, so a successful Wait must call Release
+// BLOCKING!! Blocks current goroutine
+func (cl *ConcurrencyLimiter) Wait(ctx context.Context) error {
+	return cl.Acquire(ctx)
+}
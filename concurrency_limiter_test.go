@@ -0,0 +1,72 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestConcurrencyLimiter_Cap tests that no more than maxInFlight slots can be held at once
+func TestConcurrencyLimiter_Cap(t *testing.T) {
+	cl := NewConcurrencyLimiter(2)
+
+	if !cl.TryAcquire() || !cl.TryAcquire() {
+		t.Fatal("Expected the first 2 acquires to succeed")
+	}
+	if cl.TryAcquire() {
+		t.Error("Expected the 3rd acquire to fail while 2 are in flight")
+	}
+
+	cl.Release()
+	if !cl.TryAcquire() {
+		t.Error("Expected acquire to succeed after a release")
+	}
+	if inFlight := cl.InFlight(); inFlight != 2 {
+		t.Errorf("Expected 2 in flight, got %d", inFlight)
+	}
+}
+
+// TestConcurrencyLimiter_AcquireWaitsForRelease tests that Acquire blocks until a slot is released
+func TestConcurrencyLimiter_AcquireWaitsForRelease(t *testing.T) {
+	cl := NewConcurrencyLimiter(1)
+	cl.Acquire(context.Background())
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cl.Release()
+	}()
+
+	start := time.Now()
+	if err := cl.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected Acquire to wait for the release, took %v", elapsed)
+	}
+}
+
+// TestConcurrencyLimiter_AcquireCancelled tests that Acquire gives up when the context ends
+func TestConcurrencyLimiter_AcquireCancelled(t *testing.T) {
+	cl := NewConcurrencyLimiter(1)
+	cl.Acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := cl.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+	if inFlight := cl.InFlight(); inFlight != 1 {
+		t.Errorf("Expected the cancelled acquire not to take a slot, got %d in flight", inFlight)
+	}
+}
+
+// TestConcurrencyLimiter_ReleaseWithoutAcquire tests that an unmatched Release panics
+func TestConcurrencyLimiter_ReleaseWithoutAcquire(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected Release without Acquire to panic")
+		}
+	}()
+	NewConcurrencyLimiter(1).Release()
+}
@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Default factor the tuner lets the limit grow by when the system isn't queueing
+const defaultTunerHeadroom = 1.5
+
+// ConcurrencyTuner continuously derives an AdmissionController's concurrency limit using Little's law
+// (concurrency = throughput * latency), so operators don't have to hand-tune the in-flight cap.
+//
+// Every interval it looks at the throughput and the fastest latency it saw (the latency of work that
+// didn't have to queue), and sets the limit to throughput * minLatency * headroom. If latency starts
+// inflating because the backend is queueing, the limit comes down; if it isn't, the headroom lets the
+// limit keep growing. The limit always stays between the configured min and max
+type ConcurrencyTuner struct {
+	mtx        sync.Mutex
+	ac         *AdmissionController // controller whose concurrency limit we tune
+	minLimit   int                  // lower bound for the limit
+	maxLimit   int                  // upper bound for the limit
+	interval   time.Duration        // how often the limit is recomputed
+	headroom   float64              // how much room to grow we leave on top of the measured concurrency
+	limit      int                  // current limit
+	windowFrom time.Time            // start of the current measurement window
+	completed  int                  // work completed in the current window
+	minLatency time.Duration        // fastest latency seen in the current window
+}
+
+// ConcurrencyTuner constructor; starts the controller's limit at minLimit
+func NewConcurrencyTuner(ac *AdmissionController, minLimit int, maxLimit int, interval time.Duration) *ConcurrencyTuner {
+	if ac == nil || minLimit <= 0 || maxLimit < minLimit || interval <= 0 {
+		panic("invalid concurrency tuner parameters")
+	}
+
+	ac.SetMaxInFlight(minLimit)
+	return &ConcurrencyTuner{
+		ac:         ac,
+		minLimit:   minLimit,
+		maxLimit:   maxLimit,
+		interval:   interval,
+		headroom:   defaultTunerHeadroom,
+		limit:      minLimit,
+		windowFrom: time.Now(),
+	}
+}
+
+// Observe records the latency of a piece of admitted work once it completes, and recomputes the
+// limit if the current measurement window is over
+func (ct *ConcurrencyTuner) Observe(latency time.Duration) {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+
+	ct.completed++
+	if ct.minLatency == 0 || latency < ct.minLatency {
+		ct.minLatency = latency
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(ct.windowFrom)
+	if elapsed < ct.interval {
+		return
+	}
+
+	// Little's law: L = λW
+	throughput := float64(ct.completed) / elapsed.Seconds()
+	limit := int(math.Ceil(throughput * ct.minLatency.Seconds() * ct.headroom))
+	limit = min(max(limit, ct.minLimit), ct.maxLimit)
+
+	if limit != ct.limit {
+		ct.limit = limit
+		ct.ac.SetMaxInFlight(limit)
+	}
+
+	// Start a fresh window
+	ct.windowFrom = now
+	ct.completed = 0
+	ct.minLatency = 0
+}
+
+// Limit returns the concurrency limit the tuner has currently settled on
+func (ct *ConcurrencyTuner) Limit() int {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	return ct.limit
+}
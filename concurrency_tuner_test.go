@@ -0,0 +1,47 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestConcurrencyTuner_Grows tests that the limit grows when work completes quickly at high throughput
+func TestConcurrencyTuner_Grows(t *testing.T) {
+	ac := NewAdmissionController(nil, 0, 0)
+	ct := NewConcurrencyTuner(ac, 2, 50, 50*time.Millisecond)
+
+	// ~1000 completions/second at 20ms each means ~20 in flight, so the limit should go well past the minimum
+	for range 60 {
+		ct.Observe(20 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+
+	if limit := ct.Limit(); limit <= 2 {
+		t.Errorf("Expected limit to grow above the minimum, got %d", limit)
+	}
+	if ac.maxInFlight != ct.Limit() {
+		t.Errorf("Expected controller limit %d to match tuner limit %d", ac.maxInFlight, ct.Limit())
+	}
+}
+
+// TestConcurrencyTuner_Bounds tests that the limit stays between min and max
+func TestConcurrencyTuner_Bounds(t *testing.T) {
+	ac := NewAdmissionController(nil, 0, 0)
+	ct := NewConcurrencyTuner(ac, 2, 5, 20*time.Millisecond)
+
+	// Huge latency * throughput would suggest way more than 5
+	for range 30 {
+		ct.Observe(time.Second)
+		time.Sleep(time.Millisecond)
+	}
+	if limit := ct.Limit(); limit != 5 {
+		t.Errorf("Expected limit capped at 5, got %d", limit)
+	}
+
+	// Tiny latency suggests less than 1, so we should bottom out at the minimum
+	time.Sleep(20 * time.Millisecond)
+	ct.Observe(time.Microsecond)
+	if limit := ct.Limit(); limit != 2 {
+		t.Errorf("Expected limit floored at 2, got %d", limit)
+	}
+}
@@ -0,0 +1,128 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// DeadlinePacer paces a job with a known amount of work (e.g. a backfill against a rate limited API)
+// so it finishes right around a target time instead of racing ahead or falling behind. The pace is
+// recalculated on every admission from the work left and the time left, so it speeds up if the job
+// falls behind and slows down if it gets ahead, but never goes over the ceiling rate
+type DeadlinePacer struct {
+	mtx       sync.Mutex
+	ceiling   *TokenBucket // hard cap on the pace, no matter how far behind we are
+	deadline  time.Time    // when we're aiming to be done
+	remaining int          // units of work left to admit
+	next      time.Time    // earliest time the next unit should be admitted
+}
+
+// DeadlinePacer constructor; paces `remaining` units of work to finish by deadline, never going
+// faster than maxOps per `per` (with bursts up to burst)
+func NewDeadlinePacer(remaining int, deadline time.Time, maxOps int, per time.Duration, burst int) *DeadlinePacer {
+	if remaining < 0 {
+		panic("invalid rate limiter parameters")
+	}
+
+	return &DeadlinePacer{
+		ceiling:   NewTokenBucket(maxOps, per, burst),
+		deadline:  deadline,
+		remaining: remaining,
+		next:      time.Now(),
+	}
+}
+
+// Implements Allow RateLimiter method; returns true if the next unit of work is due
+// NON-BLOCKING! Returns immediately
+func (p *DeadlinePacer) Allow() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := time.Now()
+	if now.Before(p.next) || !p.ceiling.Allow() {
+		return false
+	}
+	p.admit(now)
+	return true
+}
+
+// Implements Wait RateLimiter method; blocks until the next unit of work is due
+// BLOCKING!! Blocks current goroutine
+func (p *DeadlinePacer) Wait(ctx context.Context) error {
+	for {
+		p.mtx.Lock()
+		now := time.Now()
+		if !now.Before(p.next) {
+			// Our turn; claim the slot now so the pace moves on, then go through the ceiling
+			p.admit(now)
+			p.mtx.Unlock()
+
+			if err := p.ceiling.Wait(ctx); err != nil {
+				// Didn't do the work after all, so it's still left to do
+				p.mtx.Lock()
+				p.remaining++
+				p.mtx.Unlock()
+				return err
+			}
+			return nil
+		}
+		waitDuration := p.next.Sub(now)
+		p.mtx.Unlock()
+
+		// Loop again afterwards, since the remaining work may have changed the pace in the meantime
+		select {
+		case <-time.After(waitDuration):
+			continue
+		case <-ctx.Done():
+			return waitError(ctx)
+		}
+	}
+}
+
+// SetRemaining updates how much work is left (e.g. when the job discovers more records to backfill),
+// which changes the pace from the next admission on
+func (p *DeadlinePacer) SetRemaining(remaining int) {
+	if remaining < 0 {
+		panic("invalid rate limiter parameters")
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.remaining = remaining
+}
+
+// Remaining returns how many units of work are left to admit
+func (p *DeadlinePacer) Remaining() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.remaining
+}
+
+// Rate returns the pace (in admissions per second) needed right now to finish on time, before the
+// ceiling is applied. Once the deadline has passed this is +Inf, meaning "as fast as the ceiling allows".
+// Once all the work has been admitted, anything further is only held back by the ceiling
+func (p *DeadlinePacer) Rate() float64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	left := time.Until(p.deadline).Seconds()
+	switch {
+	case p.remaining == 0:
+		return 0
+	case left <= 0:
+		return math.Inf(1)
+	}
+	return float64(p.remaining) / left
+}
+
+// Internal helper that admits one unit of work and schedules the next one so the work left is
+// spread evenly over the time left
+// Caller must hold the lock
+func (p *DeadlinePacer) admit(now time.Time) {
+	if p.remaining > 0 {
+		p.next = now.Add(max(0, p.deadline.Sub(now)) / time.Duration(p.remaining))
+		p.remaining--
+	}
+}
@@ -0,0 +1,92 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestDeadlinePacer_FinishesOnTime tests that the work gets spread out to finish around the deadline
+func TestDeadlinePacer_FinishesOnTime(t *testing.T) {
+	start := time.Now()
+	p := NewDeadlinePacer(5, start.Add(250*time.Millisecond), 1000, time.Second, 10)
+
+	for i := 0; i < 5; i++ {
+		if err := p.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 5 admissions spread over 250ms start at 0, 50, ..., 200ms
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond || elapsed > 260*time.Millisecond {
+		t.Errorf("Expected the last admission around 200ms, got %v", elapsed)
+	}
+	if p.Remaining() != 0 {
+		t.Errorf("Expected no work remaining, got %d", p.Remaining())
+	}
+}
+
+// TestDeadlinePacer_Ceiling tests that the pace never goes over the ceiling, even past the deadline
+func TestDeadlinePacer_Ceiling(t *testing.T) {
+	p := NewDeadlinePacer(100, time.Now().Add(-time.Second), 10, time.Second, 1)
+
+	if !math.IsInf(p.Rate(), 1) {
+		t.Errorf("Expected +Inf rate past the deadline, got %v", p.Rate())
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		p.Wait(context.Background())
+	}
+
+	// 1 from the burst, then 2 more at 10/s
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected the ceiling to hold us to 10/s, took %v", elapsed)
+	}
+}
+
+// TestDeadlinePacer_Allow tests that Allow only admits work once it's due
+func TestDeadlinePacer_Allow(t *testing.T) {
+	p := NewDeadlinePacer(2, time.Now().Add(200*time.Millisecond), 1000, time.Second, 10)
+
+	if !p.Allow() {
+		t.Error("Expected the first unit of work to be allowed right away")
+	}
+	if p.Allow() {
+		t.Error("Expected the second unit of work to not be due yet")
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	if !p.Allow() {
+		t.Error("Expected the second unit of work to be due")
+	}
+}
+
+// TestDeadlinePacer_SetRemaining tests that more work speeds up the pace
+func TestDeadlinePacer_SetRemaining(t *testing.T) {
+	p := NewDeadlinePacer(10, time.Now().Add(10*time.Second), 1000, time.Second, 10)
+
+	before := p.Rate()
+	p.SetRemaining(100)
+	if after := p.Rate(); after < before*9 {
+		t.Errorf("Expected the rate to go up roughly tenfold, went from %v to %v", before, after)
+	}
+}
+
+// TestDeadlinePacer_ContextCancelled tests that a cancelled wait gives its unit of work back
+func TestDeadlinePacer_ContextCancelled(t *testing.T) {
+	p := NewDeadlinePacer(2, time.Now().Add(time.Hour), 1000, time.Second, 10)
+	p.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := p.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+	if p.Remaining() != 1 {
+		t.Errorf("Expected 1 unit of work remaining, got %d", p.Remaining())
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decision records what a limiter decided about a request, so handlers, logs, and downstream
+// services several hops later can explain why the request was slow or rejected
+type Decision struct {
+	Rule      string        // which limit applied (e.g. "api:per-user")
+	Allowed   bool          // whether the request got through
+	Remaining float64       // budget left after the decision
+	Waited    time.Duration // how long the request was held back before the decision
+}
+
+// Context key type, unexported so nobody else can collide with it
+type decisionKey struct{}
+
+// Baggage keys a Decision is carried under (W3C baggage header)
+const (
+	baggageRule      = "ratelimit.rule"
+	baggageAllowed   = "ratelimit.allowed"
+	baggageRemaining = "ratelimit.remaining"
+	baggageWaited    = "ratelimit.waited_ms"
+)
+
+// WithDecision returns a copy of ctx carrying the decision
+func WithDecision(ctx context.Context, d Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, d)
+}
+
+// DecisionFromContext returns the decision recorded with WithDecision, if any
+func DecisionFromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(Decision)
+	return d, ok
+}
+
+// AppendBaggage adds the decision to the W3C "baggage" header of an outgoing request, keeping any
+// baggage already there, so downstream services (and OpenTelemetry baggage propagation) can see it
+func (d Decision) AppendBaggage(h http.Header) {
+	members := []string{
+		baggageRule + "=" + url.PathEscape(d.Rule),
+		baggageAllowed + "=" + strconv.FormatBool(d.Allowed),
+		baggageRemaining + "=" + strconv.FormatFloat(d.Remaining, 'f', -1, 64),
+		baggageWaited + "=" + strconv.FormatInt(d.Waited.Milliseconds(), 10),
+	}
+	if existing := h.Get("Baggage"); existing != "" {
+		members = append([]string{existing}, members...)
+	}
+	h.Set("Baggage", strings.Join(members, ","))
+}
+
+// DecisionFromBaggage reads a decision an upstream service added with AppendBaggage.
+// Returns false if the header doesn't carry one
+func DecisionFromBaggage(h http.Header) (Decision, bool) {
+	var d Decision
+	found := false
+	for _, header := range h.Values("Baggage") {
+		for _, member := range strings.Split(header, ",") {
+			// Members look like "key=value;property", and we don't use properties
+			key, value, _ := strings.Cut(member, "=")
+			value, _, _ = strings.Cut(value, ";")
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+			switch key {
+			case baggageRule:
+				d.Rule, _ = url.PathUnescape(value)
+			case baggageAllowed:
+				d.Allowed, _ = strconv.ParseBool(value)
+			case baggageRemaining:
+				d.Remaining, _ = strconv.ParseFloat(value, 64)
+			case baggageWaited:
+				ms, _ := strconv.ParseInt(value, 10, 64)
+				d.Waited = time.Duration(ms) * time.Millisecond
+			default:
+				continue
+			}
+			found = true
+		}
+	}
+	return d, found
+}
@@ -0,0 +1,44 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestDecisionContext tests that a decision can be stored in and read back from a context
+func TestDecisionContext(t *testing.T) {
+	if _, ok := DecisionFromContext(context.Background()); ok {
+		t.Error("Expected no decision in an empty context")
+	}
+
+	want := Decision{Rule: "api", Allowed: true, Remaining: 4, Waited: 20 * time.Millisecond}
+	got, ok := DecisionFromContext(WithDecision(context.Background(), want))
+	if !ok || got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+// TestDecisionBaggage tests that a decision survives a round trip through the baggage header
+// without clobbering baggage that was already there
+func TestDecisionBaggage(t *testing.T) {
+	h := http.Header{}
+	h.Set("Baggage", "userId=alice")
+
+	want := Decision{Rule: "api:per user", Allowed: false, Remaining: 0.5, Waited: 150 * time.Millisecond}
+	want.AppendBaggage(h)
+
+	if got := h.Get("Baggage"); got[:len("userId=alice,")] != "userId=alice," {
+		t.Errorf("Expected existing baggage to be kept, got %q", got)
+	}
+
+	got, ok := DecisionFromBaggage(h)
+	if !ok || got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if _, ok := DecisionFromBaggage(http.Header{"Baggage": {"userId=alice"}}); ok {
+		t.Error("Expected no decision in unrelated baggage")
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrDelayBudgetExceeded is returned by Wait when waiting any longer would take the request past the
+// delay budget set with WithDelayBudget. It's the cause of the wait ending, so ErrWaitDeadline and
+// context.DeadlineExceeded match the error too
+var ErrDelayBudgetExceeded = errors.New("ratelimiter: delay budget exceeded")
+
+// Context key types, unexported so nobody else can collide with them
+type delayBudgetKey struct{}
+type delayBudgetAppliedKey struct{}
+
+// Total delay a request chain may spend waiting on limiters, and how much of it is used up
+type delayBudget struct {
+	mtx   sync.Mutex
+	limit time.Duration
+	spent time.Duration
+}
+
+// WithDelayBudget returns a copy of ctx that caps the total time the request may spend waiting on
+// limiters, across every limiter it passes through on the way (client transport, middleware, pacing of
+// downstream calls, ...), so layered limits can't quietly add up to seconds of extra latency.
+// TokenBucket's Wait, WaitN and WaitPriority (and wrappers that pass straight through to them, like
+// Swappable or Instrument) count their delay against the budget and give up with ErrDelayBudgetExceeded
+// rather than go over it, as do DualLimiter, MultiWindowLimiter, ChildBucket, TwoRatePolicer and
+// AdmissionController. Any other limiter has to be waited on through WaitWithinBudget.
+// A budget already in ctx is replaced
+func WithDelayBudget(ctx context.Context, limit time.Duration) context.Context {
+	if limit < 0 {
+		panic("invalid delay budget parameters")
+	}
+	return context.WithValue(ctx, delayBudgetKey{}, &delayBudget{limit: limit})
+}
+
+// DelaySpent returns how much of the delay budget in ctx limiters have used up so far, and false if
+// ctx has no budget
+func DelaySpent(ctx context.Context) (time.Duration, bool) {
+	b, ok := ctx.Value(delayBudgetKey{}).(*delayBudget)
+	if !ok {
+		return 0, false
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.spent, true
+}
+
+// WaitWithinBudget waits on limiter, counting the delay against the budget in ctx (if there is one)
+// and giving up with ErrDelayBudgetExceeded instead of going over it. A request the limiter lets
+// straight through costs nothing, even with the budget used up
+// BLOCKING!! Blocks current goroutine
+func WaitWithinBudget(ctx context.Context, limiter RateLimiter) error {
+	if ok, err := waitWithinBudget(ctx, limiter.Allow, limiter.Wait); ok {
+		return err
+	}
+	return limiter.Wait(ctx)
+}
+
+// Internal helper that runs wait bounded by the delay budget in ctx, after trying allow first so
+// requests that don't have to wait don't need any budget. Returns false if ctx has no budget, or if
+// an outer call is already counting this wait against it (so wrapped limiters aren't charged twice)
+func waitWithinBudget(ctx context.Context, allow func() bool, wait func(context.Context) error) (bool, error) {
+	b, ok := ctx.Value(delayBudgetKey{}).(*delayBudget)
+	if !ok || ctx.Value(delayBudgetAppliedKey{}) == b {
+		return false, nil
+	}
+	if ctx.Err() != nil {
+		return true, waitError(ctx)
+	}
+	if allow() {
+		return true, nil
+	}
+
+	b.mtx.Lock()
+	remaining := b.limit - b.spent
+	b.mtx.Unlock()
+	if remaining <= 0 {
+		// Same shape as a wait that ran out of budget part way through
+		return true, fmt.Errorf("%w: %w: %w", ErrWaitDeadline, context.DeadlineExceeded, ErrDelayBudgetExceeded)
+	}
+
+	budgetCtx, cancel := context.WithTimeoutCause(ctx, remaining, ErrDelayBudgetExceeded)
+	defer cancel()
+	budgetCtx = context.WithValue(budgetCtx, delayBudgetAppliedKey{}, b)
+
+	start := time.Now()
+	err := wait(budgetCtx)
+
+	b.mtx.Lock()
+	b.spent += time.Since(start)
+	b.mtx.Unlock()
+	return true, err
+}
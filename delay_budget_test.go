@@ -0,0 +1,87 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDelayBudget_AcrossLimiters tests that delay from several limiters adds up against one budget
+func TestDelayBudget_AcrossLimiters(t *testing.T) {
+	ctx := WithDelayBudget(context.Background(), 150*time.Millisecond)
+
+	// Two limiters that each hold the request back ~100ms
+	first := NewTokenBucket(10, time.Second, 1)
+	second := NewTokenBucket(10, time.Second, 1)
+	first.Allow()
+
+	if err := first.Wait(ctx); err != nil {
+		t.Fatalf("Expected the first wait to fit in the budget, got: %v", err)
+	}
+	second.Allow()
+	if err := second.Wait(ctx); !errors.Is(err, ErrDelayBudgetExceeded) {
+		t.Errorf("Expected the second wait to run out of budget, got: %v", err)
+	}
+
+	if spent, ok := DelaySpent(ctx); !ok || spent < 140*time.Millisecond || spent > 250*time.Millisecond {
+		t.Errorf("Expected ~150ms of budget spent, got %v", spent)
+	}
+}
+
+// TestDelayBudget_NoDelayIsFree tests that requests that don't have to wait go through even with the budget used up
+func TestDelayBudget_NoDelayIsFree(t *testing.T) {
+	ctx := WithDelayBudget(context.Background(), 0)
+
+	if err := NewTokenBucket(10, time.Second, 1).Wait(ctx); err != nil {
+		t.Errorf("Expected a request with tokens available to go through, got: %v", err)
+	}
+	if spent, _ := DelaySpent(ctx); spent != 0 {
+		t.Errorf("Expected nothing spent, got %v", spent)
+	}
+}
+
+// TestDelayBudget_Exhausted tests that a wait fails right away once the budget is gone
+func TestDelayBudget_Exhausted(t *testing.T) {
+	ctx := WithDelayBudget(context.Background(), 0)
+	tb := NewTokenBucket(1, time.Second, 1)
+	tb.Allow()
+
+	start := time.Now()
+	err := tb.Wait(ctx)
+	if !errors.Is(err, ErrDelayBudgetExceeded) || !errors.Is(err, ErrWaitDeadline) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ErrDelayBudgetExceeded, ErrWaitDeadline and DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("Expected to fail right away, took %v", elapsed)
+	}
+}
+
+// TestWaitWithinBudget tests the budget with a limiter that isn't a TokenBucket
+func TestWaitWithinBudget(t *testing.T) {
+	ctx := WithDelayBudget(context.Background(), 50*time.Millisecond)
+	lb := NewLeakyBucket(1, time.Second, 5)
+	lb.Allow()
+
+	if err := WaitWithinBudget(ctx, lb); !errors.Is(err, ErrDelayBudgetExceeded) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ErrDelayBudgetExceeded and DeadlineExceeded, got: %v", err)
+	}
+	if err := WaitWithinBudget(context.Background(), NewGCRA(1, time.Second, 1)); err != nil {
+		t.Errorf("Expected a wait without a budget to work as usual, got: %v", err)
+	}
+}
+
+// TestWaitWithinBudget_NotChargedTwice tests that wrapping a TokenBucket, which applies the budget itself,
+// only counts the delay once
+func TestWaitWithinBudget_NotChargedTwice(t *testing.T) {
+	ctx := WithDelayBudget(context.Background(), time.Second)
+	tb := NewTokenBucket(10, time.Second, 1)
+	tb.Allow()
+
+	if err := WaitWithinBudget(ctx, NewSwappable(tb)); err != nil {
+		t.Fatalf("Expected the wait to fit in the budget, got: %v", err)
+	}
+	if spent, _ := DelaySpent(ctx); spent < 80*time.Millisecond || spent > 150*time.Millisecond {
+		t.Errorf("Expected about 100ms spent, got %v", spent)
+	}
+}
@@ -0,0 +1,321 @@
+// Package dispatch delivers outbound webhooks in the background, respecting per-endpoint rate limits
+// and concurrency, and retrying failed deliveries with backoff.
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imotyashok/ratelimiter"
+)
+
+// ErrClosed is returned by Enqueue once the dispatcher has been closed
+var ErrClosed = errors.New("dispatch: dispatcher closed")
+
+// ErrQueueFull is returned by Enqueue when the endpoint already has as many deliveries queued as allowed
+var ErrQueueFull = errors.New("dispatch: endpoint queue full")
+
+// Delivery is a single webhook to POST to an endpoint
+type Delivery struct {
+	URL    string
+	Body   []byte
+	Header http.Header
+}
+
+// Metrics is a snapshot of the dispatcher's delivery counters
+type Metrics struct {
+	Enqueued  int64 // deliveries accepted by Enqueue
+	Delivered int64 // deliveries the endpoint accepted with a 2xx
+	Failed    int64 // deliveries given up on after running out of attempts or a permanent failure
+	Retried   int64 // extra attempts made after failures
+	Pending   int64 // deliveries not finished yet (queued, in flight, or backing off)
+}
+
+// Dispatcher delivers webhooks in the background. Every endpoint (scheme + host) gets its own rate
+// limit, concurrency cap and queue, so one slow or strict receiver doesn't hold up deliveries to the others
+type Dispatcher struct {
+	client      *http.Client
+	maxOps      int                       // deliveries allowed per endpoint per `per`
+	per         time.Duration             // time window for maxOps
+	burst       int                       // per endpoint burst size
+	concurrency int                       // max in flight deliveries (and workers) per endpoint
+	queueSize   int                       // max deliveries waiting per endpoint
+	maxAttempts int                       // attempts per delivery before giving up
+	backoff     ratelimiter.BackoffPolicy // delay between attempts
+	idle        time.Duration             // how long an endpoint sits unused before it's forgotten
+
+	mtx       sync.Mutex
+	endpoints map[string]*endpoint
+	swept     time.Time // last time we forgot idle endpoints
+	closed    bool
+
+	wg     sync.WaitGroup  // tracks deliveries that haven't finished
+	ctx    context.Context // cancelled to abort in flight deliveries when Close gives up draining
+	cancel context.CancelFunc
+
+	enqueued, delivered, failed, retried atomic.Int64
+}
+
+// Per endpoint limits and queue; everything but the limiter is only touched under the dispatcher's lock
+type endpoint struct {
+	limiter   *ratelimiter.TokenBucket
+	queue     []Delivery // deliveries no worker has picked up yet
+	workers   int        // running workers, at most the dispatcher's concurrency
+	idleSince time.Time  // when the last worker exited, if there are none
+}
+
+// Option configures a Dispatcher at construction time
+type Option func(*Dispatcher)
+
+// WithClient sets the HTTP client used for deliveries (by default, one that gives up on a delivery
+// attempt after 30 seconds, so a receiver that never answers can't tie up a worker forever)
+func WithClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithQueueSize caps how many deliveries can wait per endpoint (1000 by default); Enqueue fails with
+// ErrQueueFull past that, rather than piling up deliveries for a receiver that can't keep up
+func WithQueueSize(n int) Option {
+	if n <= 0 {
+		panic("invalid dispatch parameters")
+	}
+	return func(d *Dispatcher) {
+		d.queueSize = n
+	}
+}
+
+// WithRetries sets how many attempts a delivery gets and how to back off between them
+// (5 attempts with exponential backoff from 1s up to 1m by default)
+func WithRetries(maxAttempts int, backoff ratelimiter.BackoffPolicy) Option {
+	if maxAttempts <= 0 || backoff == nil {
+		panic("invalid dispatch parameters")
+	}
+	return func(d *Dispatcher) {
+		d.maxAttempts = maxAttempts
+		d.backoff = backoff
+	}
+}
+
+// Dispatcher constructor; every endpoint is limited to maxOps deliveries per `per` (with bursts up to
+// burst) and at most concurrency deliveries in flight at once
+func New(maxOps int, per time.Duration, burst int, concurrency int, opts ...Option) *Dispatcher {
+	if concurrency <= 0 {
+		panic("invalid dispatch parameters")
+	}
+	ratelimiter.NewTokenBucket(maxOps, per, burst) // validate parameters up front
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		maxOps:      maxOps,
+		per:         per,
+		burst:       burst,
+		concurrency: concurrency,
+		queueSize:   1000,
+		maxAttempts: 5,
+		backoff:     ratelimiter.ExponentialBackoff(time.Second, time.Minute),
+		idle:        max(time.Duration(float64(burst)/float64(maxOps)*float64(per)), time.Minute),
+		endpoints:   make(map[string]*endpoint),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Enqueue queues a delivery and returns right away; it's sent in the background as soon as its
+// endpoint's limits allow, and retried on failure. Returns ErrQueueFull if the endpoint's queue is full
+func (d *Dispatcher) Enqueue(delivery Delivery) error {
+	u, err := url.Parse(delivery.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("dispatch: invalid delivery URL %q", delivery.URL)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	d.sweep(time.Now())
+
+	// Endpoints are keyed by scheme + host, so every path on a receiver shares its limits
+	key := u.Scheme + "://" + u.Host
+	ep, ok := d.endpoints[key]
+	if !ok {
+		ep = &endpoint{limiter: ratelimiter.NewTokenBucket(d.maxOps, d.per, d.burst)}
+		d.endpoints[key] = ep
+	}
+	if len(ep.queue) >= d.queueSize {
+		return ErrQueueFull
+	}
+
+	ep.queue = append(ep.queue, delivery)
+	d.enqueued.Add(1)
+	d.wg.Add(1)
+
+	// Start another worker if the endpoint has concurrency to spare
+	if ep.workers < d.concurrency {
+		ep.workers++
+		go d.work(ep)
+	}
+	return nil
+}
+
+// Metrics returns a snapshot of the delivery counters
+func (d *Dispatcher) Metrics() Metrics {
+	enqueued, delivered, failed := d.enqueued.Load(), d.delivered.Load(), d.failed.Load()
+	return Metrics{
+		Enqueued:  enqueued,
+		Delivered: delivered,
+		Failed:    failed,
+		Retried:   d.retried.Load(),
+		Pending:   enqueued - delivered - failed,
+	}
+}
+
+// Close stops accepting new deliveries and waits for the queued ones to finish. If ctx ends first,
+// whatever is still pending is aborted (and counted as failed) and the context's error is returned
+// BLOCKING!! Blocks current goroutine
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mtx.Lock()
+	d.closed = true
+	d.mtx.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-drained
+		return ctx.Err()
+	}
+}
+
+// Internal worker loop for an endpoint; sends its queued deliveries one at a time, and exits once
+// the queue is empty
+func (d *Dispatcher) work(ep *endpoint) {
+	for {
+		d.mtx.Lock()
+		if len(ep.queue) == 0 {
+			ep.workers--
+			if ep.workers == 0 {
+				ep.idleSince = time.Now()
+			}
+			d.mtx.Unlock()
+			return
+		}
+		delivery := ep.queue[0]
+		ep.queue = ep.queue[1:]
+		d.mtx.Unlock()
+
+		d.deliver(ep, delivery)
+	}
+}
+
+// Internal helper that forgets endpoints that have had no workers for a while, at most once per idle
+// period, so the map doesn't keep every receiver we've ever sent to. By then their bucket would have
+// refilled anyway, so a fresh one behaves the same
+// Caller must hold the lock
+func (d *Dispatcher) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.idle {
+		return
+	}
+	for key, ep := range d.endpoints {
+		if ep.workers == 0 && now.Sub(ep.idleSince) >= d.idle {
+			delete(d.endpoints, key)
+		}
+	}
+	d.swept = now
+}
+
+// Internal helper that sends one delivery, retrying with backoff through the endpoint's limiter
+func (d *Dispatcher) deliver(ep *endpoint, delivery Delivery) {
+	defer d.wg.Done()
+
+	// A 429's Retry-After stretches the next backoff to at least that long
+	var retryAfter time.Duration
+	backoff := func(retry int, prev time.Duration) time.Duration {
+		return max(d.backoff(retry, prev), retryAfter)
+	}
+
+	attempts := 0
+	err := ratelimiter.DoWithRetry(d.ctx, ep.limiter, backoff, d.maxAttempts, func(ctx context.Context) error {
+		attempts++
+		if attempts > 1 {
+			d.retried.Add(1)
+		}
+
+		var err error
+		retryAfter, err = d.send(ctx, delivery)
+		return err
+	})
+
+	if err != nil {
+		d.failed.Add(1)
+		return
+	}
+	d.delivered.Add(1)
+}
+
+// Internal helper that POSTs a delivery. Network errors, 429s and 5xxs are worth retrying;
+// any other non-2xx response is treated as a permanent failure. For a 429, also returns how long
+// the endpoint asked us to wait with Retry-After, if it did
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, ratelimiter.Permanent(err)
+	}
+	for k, v := range delivery.Header {
+		req.Header[k] = v
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return parseRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("dispatch: endpoint responded %s", resp.Status)
+	case resp.StatusCode >= 500:
+		return 0, fmt.Errorf("dispatch: endpoint responded %s", resp.Status)
+	default:
+		return 0, ratelimiter.Permanent(fmt.Errorf("dispatch: endpoint responded %s", resp.Status))
+	}
+}
+
+// Internal helper that parses a Retry-After header, given either in seconds or as an HTTP date.
+// Returns 0 if it's missing or malformed
+func parseRetryAfter(header string) time.Duration {
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		return max(time.Until(when), 0)
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+package dispatch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imotyashok/ratelimiter"
+)
+
+// TestDispatcher_Delivers tests that queued deliveries reach the endpoint with their body and headers
+func TestDispatcher_Delivers(t *testing.T) {
+	var received atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Event") != "ping" {
+			t.Errorf("Unexpected request: %s %v", r.Method, r.Header)
+		}
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	d := New(100, time.Second, 10, 2)
+	for range 5 {
+		if err := d.Enqueue(Delivery{URL: srv.URL + "/hook", Body: []byte("{}"), Header: http.Header{"X-Event": {"ping"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Load() != 5 {
+		t.Errorf("Expected 5 deliveries, got %d", received.Load())
+	}
+	if m := d.Metrics(); m.Delivered != 5 || m.Pending != 0 || m.Failed != 0 {
+		t.Errorf("Unexpected metrics: %+v", m)
+	}
+}
+
+// TestDispatcher_RetriesThenSucceeds tests that 5xx responses are retried
+func TestDispatcher_RetriesThenSucceeds(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	d := New(100, time.Second, 10, 1, WithRetries(5, ratelimiter.ConstantBackoff(time.Millisecond)))
+	d.Enqueue(Delivery{URL: srv.URL})
+	d.Close(context.Background())
+
+	if m := d.Metrics(); m.Delivered != 1 || m.Retried != 2 {
+		t.Errorf("Expected 1 delivery after 2 retries, got %+v", m)
+	}
+}
+
+// TestDispatcher_PermanentFailure tests that 4xx responses aren't retried
+func TestDispatcher_PermanentFailure(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	d := New(100, time.Second, 10, 1, WithRetries(5, ratelimiter.ConstantBackoff(time.Millisecond)))
+	d.Enqueue(Delivery{URL: srv.URL})
+	d.Close(context.Background())
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 attempt for a 400, got %d", calls.Load())
+	}
+	if m := d.Metrics(); m.Failed != 1 || m.Retried != 0 {
+		t.Errorf("Expected 1 failed delivery with no retries, got %+v", m)
+	}
+}
+
+// TestDispatcher_PerEndpointConcurrency tests that an endpoint never sees more than its concurrency cap
+func TestDispatcher_PerEndpointConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		inFlight.Add(-1)
+	}))
+	defer srv.Close()
+
+	d := New(1000, time.Second, 100, 2)
+	for range 8 {
+		d.Enqueue(Delivery{URL: srv.URL})
+	}
+	d.Close(context.Background())
+
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 deliveries in flight, saw %d", peak.Load())
+	}
+}
+
+// TestDispatcher_Close tests that Enqueue fails after Close and that Close gives up on its deadline
+func TestDispatcher_Close(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// Long backoff means the delivery can't finish before Close's deadline
+	d := New(100, time.Second, 10, 1, WithRetries(5, ratelimiter.ConstantBackoff(time.Hour)))
+	d.Enqueue(Delivery{URL: srv.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded from Close, got: %v", err)
+	}
+	if m := d.Metrics(); m.Failed != 1 || m.Pending != 0 {
+		t.Errorf("Expected the aborted delivery to count as failed, got %+v", m)
+	}
+
+	if err := d.Enqueue(Delivery{URL: srv.URL}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got: %v", err)
+	}
+}
+
+// TestDispatcher_QueueFull tests that Enqueue fails once an endpoint's queue is full
+func TestDispatcher_QueueFull(t *testing.T) {
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+
+	d := New(100, time.Second, 10, 1, WithQueueSize(1))
+	d.Enqueue(Delivery{URL: srv.URL})
+	<-started // the only worker is busy with the first delivery now
+
+	if err := d.Enqueue(Delivery{URL: srv.URL}); err != nil {
+		t.Fatalf("Expected the second delivery to be queued, got: %v", err)
+	}
+	if err := d.Enqueue(Delivery{URL: srv.URL}); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got: %v", err)
+	}
+
+	close(release)
+	d.Close(context.Background())
+	if m := d.Metrics(); m.Enqueued != 2 || m.Delivered != 2 {
+		t.Errorf("Expected the 2 queued deliveries to go through, got %+v", m)
+	}
+}
+
+// TestDispatcher_ForgetsIdleEndpoints tests that endpoints nobody has sent to in a while are dropped
+func TestDispatcher_ForgetsIdleEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	d := New(100, time.Second, 10, 1)
+	d.idle = 20 * time.Millisecond
+
+	d.Enqueue(Delivery{URL: srv.URL})
+	for d.Metrics().Pending > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Sending anywhere after the idle period sweeps out the first endpoint
+	time.Sleep(30 * time.Millisecond)
+	d.Enqueue(Delivery{URL: other.URL})
+
+	d.mtx.Lock()
+	n := len(d.endpoints)
+	d.mtx.Unlock()
+	if n != 1 {
+		t.Errorf("Expected the idle endpoint to be forgotten, %d endpoints left", n)
+	}
+	d.Close(context.Background())
+}
+
+// TestDispatcher_HonoursRetryAfter tests that a 429's Retry-After holds off the retry longer than the backoff
+func TestDispatcher_HonoursRetryAfter(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	d := New(100, time.Second, 10, 1, WithRetries(3, ratelimiter.ConstantBackoff(time.Millisecond)))
+	start := time.Now()
+	d.Enqueue(Delivery{URL: srv.URL})
+	d.Close(context.Background())
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected the retry to wait out the 1s Retry-After, took %v", elapsed)
+	}
+	if m := d.Metrics(); m.Delivered != 1 || m.Retried != 1 {
+		t.Errorf("Expected 1 delivery after 1 retry, got %+v", m)
+	}
+}
+
+// TestParseRetryAfter tests both forms of the Retry-After header
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("Expected 3s, got %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d < 58*time.Second || d > time.Minute {
+		t.Errorf("Expected ~1m, got %v", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("Expected 0 for a malformed header, got %v", d)
+	}
+}
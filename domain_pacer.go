@@ -0,0 +1,240 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DomainPacer paces outgoing email or webhook deliveries separately per destination domain, since
+// every provider tolerates a different rate (gmail.com and outlook.com throttle very differently).
+// Deliveries can either block with Wait, or be queued with Enqueue and released in the background
+// as soon as their domain's budget allows
+type DomainPacer struct {
+	mtx         sync.Mutex
+	defaultRate domainRate                            // rate for domains without their own
+	rates       map[string]domainRate                 // per domain overrides
+	buckets     *keyedBuckets                         // one bucket per domain we've sent to recently
+	queues      map[string][]func()                   // queued deliveries per domain, released in order
+	pending     int                                   // total queued deliveries not yet sent
+	onDrop      func(domain string, n int, err error) // called when queued deliveries are dropped; may be nil
+	closed      bool                                  // set by Close; nothing new is let in
+	drained     chan struct{}                         // closed once nothing is pending after Close
+}
+
+// Rate settings for a single domain
+type domainRate struct {
+	maxOps int
+	per    time.Duration
+	burst  int
+}
+
+// DomainPacer constructor; maxOps per `per` (with bursts up to burst) is the rate for any domain
+// that doesn't have its own set with SetDomainRate
+func NewDomainPacer(maxOps int, per time.Duration, burst int) *DomainPacer {
+	NewTokenBucket(maxOps, per, burst) // validate parameters up front
+
+	p := &DomainPacer{
+		defaultRate: domainRate{maxOps, per, burst},
+		rates:       make(map[string]domainRate),
+		queues:      make(map[string][]func()),
+	}
+	p.buckets = newKeyedBuckets(max(per, time.Minute), func(domain string) *TokenBucket {
+		// Called with our lock held (from bucket), so the rates map is safe to read
+		rate, ok := p.rates[domain]
+		if !ok {
+			rate = p.defaultRate
+		}
+		return NewTokenBucket(rate.maxOps, rate.per, rate.burst)
+	})
+	return p
+}
+
+// SetDomainRate gives a domain its own rate instead of the default
+func (p *DomainPacer) SetDomainRate(domain string, maxOps int, per time.Duration, burst int) {
+	tb := NewTokenBucket(maxOps, per, burst) // validate parameters up front
+	domain = strings.ToLower(domain)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.rates[domain] = domainRate{maxOps, per, burst}
+
+	// If we already have a bucket for the domain, switch it over to the new rate; otherwise it picks
+	// the rate up when it's first needed
+	if existing, ok := p.buckets.peek(domain); ok {
+		existing.setRate(tb.rate, tb.max_tokens)
+	}
+}
+
+// OnDrop sets a function to call whenever queued deliveries are dropped instead of sent, with the
+// domain, how many were dropped, and why (ErrClosed once the pacer is closed). Pass nil to stop
+func (p *DomainPacer) OnDrop(fn func(domain string, n int, err error)) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.onDrop = fn
+}
+
+// Wait blocks until a delivery to recipient (an email address, URL, or bare domain) is allowed
+// BLOCKING!! Blocks current goroutine
+func (p *DomainPacer) Wait(ctx context.Context, recipient string) error {
+	p.mtx.Lock()
+	if p.closed {
+		p.mtx.Unlock()
+		return ErrClosed
+	}
+	tb := p.bucket(domainOf(recipient))
+	p.mtx.Unlock()
+
+	return tb.Wait(ctx)
+}
+
+// Enqueue queues a delivery to recipient (an email address, URL, or bare domain) and returns right
+// away; send is called in the background once the domain's budget allows. Deliveries to the same
+// domain are released in the order they were queued. Once the pacer is closed the delivery is
+// dropped right away instead
+func (p *DomainPacer) Enqueue(recipient string, send func()) {
+	domain := domainOf(recipient)
+
+	p.mtx.Lock()
+	if p.closed {
+		onDrop := p.onDrop
+		p.mtx.Unlock()
+		if onDrop != nil {
+			onDrop(domain, 1, ErrClosed)
+		}
+		return
+	}
+	defer p.mtx.Unlock()
+
+	p.pending++
+	p.queues[domain] = append(p.queues[domain], send)
+
+	// First delivery queued for the domain kicks off its release loop
+	if len(p.queues[domain]) == 1 {
+		go p.release(domain)
+	}
+}
+
+// Pending returns how many queued deliveries haven't been sent yet
+func (p *DomainPacer) Pending() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.pending
+}
+
+// Close stops the pacer: Wait fails with ErrClosed and Enqueue drops deliveries from now on. Deliveries
+// already queued keep being released at their domain's pace until ctx ends; any still queued then are
+// dropped (see OnDrop), goroutines blocked in Wait fail with ErrClosed, and Close returns the
+// context's error. Returns nil once every queued delivery has been sent
+// BLOCKING!! Blocks current goroutine
+func (p *DomainPacer) Close(ctx context.Context) error {
+	p.mtx.Lock()
+	p.closed = true
+	if p.drained == nil {
+		p.drained = make(chan struct{})
+		if p.pending == 0 {
+			close(p.drained)
+		}
+	}
+	drained := p.drained
+	p.mtx.Unlock()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Fail whatever is still waiting on a domain's budget; the release loops drop the rest of their queues
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tb := range p.buckets.all() {
+		tb.Close(cancelled)
+	}
+	return err
+}
+
+// Internal release loop for one domain; releases its queued deliveries as the budget allows,
+// and exits once the queue is empty. If the domain's bucket refuses to wait (e.g. once the pacer is
+// closed), the rest of its queue is dropped rather than sent without a token, and reported to OnDrop
+func (p *DomainPacer) release(domain string) {
+	for {
+		p.mtx.Lock()
+		tb := p.bucket(domain)
+		p.mtx.Unlock()
+
+		if err := tb.Wait(context.Background()); err != nil {
+			p.mtx.Lock()
+			n := len(p.queues[domain])
+			delete(p.queues, domain)
+			onDrop := p.onDrop
+			p.mtx.Unlock()
+
+			if onDrop != nil {
+				onDrop(domain, n, err)
+			}
+
+			// Only count them as gone once they've been reported, so Close doesn't return before that
+			p.mtx.Lock()
+			p.settle(n)
+			p.mtx.Unlock()
+			return
+		}
+
+		p.mtx.Lock()
+		send := p.queues[domain][0]
+		p.mtx.Unlock()
+
+		send()
+
+		// Only take the delivery off the queue once it's sent, so anything queued in the meantime
+		// is picked up by this loop instead of starting a second one
+		p.mtx.Lock()
+		p.queues[domain] = p.queues[domain][1:]
+		p.settle(1)
+		done := len(p.queues[domain]) == 0
+		if done {
+			delete(p.queues, domain)
+		}
+		p.mtx.Unlock()
+
+		if done {
+			return
+		}
+	}
+}
+
+// Internal helper that marks n queued deliveries as sent or dropped, and lets Close know once
+// there are none left
+// Caller must hold the lock
+func (p *DomainPacer) settle(n int) {
+	p.pending -= n
+	if p.pending == 0 && p.drained != nil {
+		select {
+		case <-p.drained:
+		default:
+			close(p.drained)
+		}
+	}
+}
+
+// Internal helper that returns the bucket for a domain
+// Caller must hold the lock
+func (p *DomainPacer) bucket(domain string) *TokenBucket {
+	return p.buckets.get(domain)
+}
+
+// Internal helper that works out the destination domain of an email address, URL, or bare domain
+func domainOf(recipient string) string {
+	if i := strings.LastIndex(recipient, "@"); i >= 0 && !strings.Contains(recipient, "://") {
+		return strings.ToLower(recipient[i+1:])
+	}
+	if u, err := url.Parse(recipient); err == nil && u.Host != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	return strings.ToLower(recipient)
+}
@@ -0,0 +1,150 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDomainOf tests that domains are pulled out of emails, URLs, and bare domains
+func TestDomainOf(t *testing.T) {
+	cases := map[string]string{
+		"someone@Gmail.com":                   "gmail.com",
+		"https://hooks.example.com:8443/path": "hooks.example.com",
+		"outlook.com":                         "outlook.com",
+	}
+	for recipient, want := range cases {
+		if got := domainOf(recipient); got != want {
+			t.Errorf("domainOf(%q) = %q, expected %q", recipient, got, want)
+		}
+	}
+}
+
+// TestDomainPacer_PerDomainRates tests that domains are paced independently with their own rates
+func TestDomainPacer_PerDomainRates(t *testing.T) {
+	// Default allows 1 per hour, but gmail.com gets plenty
+	p := NewDomainPacer(1, time.Hour, 1)
+	p.SetDomainRate("gmail.com", 100, time.Second, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	for range 5 {
+		if err := p.Wait(ctx, "someone@gmail.com"); err != nil {
+			t.Fatalf("Expected gmail.com deliveries to go through, got: %v", err)
+		}
+	}
+
+	if err := p.Wait(ctx, "someone@outlook.com"); err != nil {
+		t.Fatalf("Expected first outlook.com delivery to go through, got: %v", err)
+	}
+	if err := p.Wait(ctx, "other@outlook.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected second outlook.com delivery to be held back, got: %v", err)
+	}
+}
+
+// TestDomainPacer_Enqueue tests that queued deliveries are released in order at the domain's pace
+func TestDomainPacer_Enqueue(t *testing.T) {
+	// 20 per second with no burst, so 3 deliveries take ~100ms
+	p := NewDomainPacer(20, time.Second, 1)
+
+	var mtx sync.Mutex
+	var sent []int
+	start := time.Now()
+	for i := range 3 {
+		p.Enqueue("https://hooks.example.com/a", func() {
+			mtx.Lock()
+			sent = append(sent, i)
+			mtx.Unlock()
+		})
+	}
+
+	for p.Pending() > 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected deliveries to be paced, took %v", elapsed)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(sent) != 3 || sent[0] != 0 || sent[1] != 1 || sent[2] != 2 {
+		t.Errorf("Expected deliveries in queue order, got %v", sent)
+	}
+}
+
+// TestDomainPacer_CloseDrains tests that Close lets queued deliveries go out before returning
+func TestDomainPacer_CloseDrains(t *testing.T) {
+	p := NewDomainPacer(20, time.Second, 1)
+
+	var mtx sync.Mutex
+	sent := 0
+	for range 3 {
+		p.Enqueue("someone@example.com", func() {
+			mtx.Lock()
+			sent++
+			mtx.Unlock()
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("Expected Close to drain the queue, got: %v", err)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if sent != 3 {
+		t.Errorf("Expected all 3 deliveries to be sent, got %d", sent)
+	}
+}
+
+// TestDomainPacer_CloseDropsQueued tests that deliveries still queued when Close gives up are dropped
+// and reported rather than sent, and that nothing new gets in afterwards
+func TestDomainPacer_CloseDropsQueued(t *testing.T) {
+	// 1 per hour, so only the first delivery goes out
+	p := NewDomainPacer(1, time.Hour, 1)
+
+	var mtx sync.Mutex
+	sent, dropped := 0, 0
+	p.OnDrop(func(domain string, n int, err error) {
+		if domain != "example.com" || !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected example.com dropped with ErrClosed, got %q: %v", domain, err)
+		}
+		mtx.Lock()
+		dropped += n
+		mtx.Unlock()
+	})
+	send := func() {
+		mtx.Lock()
+		sent++
+		mtx.Unlock()
+	}
+	for range 3 {
+		p.Enqueue("someone@example.com", send)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to give up at the deadline, got: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	p.Enqueue("someone@example.com", send)
+	if err := p.Wait(context.Background(), "someone@example.com"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected Wait on a closed pacer to fail with ErrClosed, got: %v", err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if sent != 1 || dropped != 3 {
+		t.Errorf("Expected 1 sent and 3 dropped, got %d sent and %d dropped", sent, dropped)
+	}
+}
@@ -0,0 +1,176 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+)
+
+// DRRScheduler hands out a shared TokenBucket's capacity to queued waiters grouped by key, using
+// deficit round robin. Each key takes turns being served, and on every turn it earns its quantum
+// worth of credit to spend on its queued requests. A key with big, expensive requests has to save
+// up credit over several turns, so it can't block small requests from other keys indefinitely
+type DRRScheduler struct {
+	mtx            sync.Mutex
+	limiter        *TokenBucket         // shared capacity being scheduled
+	defaultQuantum float64              // credit earned per turn by keys without their own quantum
+	quantums       map[string]float64   // per key quantum overrides
+	queues         map[string]*drrQueue // queued waiters per key
+	active         []string             // keys with queued waiters, in round robin order
+	dispatching    bool                 // whether the dispatcher goroutine is running
+}
+
+// A single key's queue and its accumulated credit
+type drrQueue struct {
+	waiters []*drrWaiter
+	deficit float64
+}
+
+// A single waiter in a key's queue
+type drrWaiter struct {
+	cost      float64
+	ready     chan struct{} // closed once the waiter has been granted its tokens (or failed to get them)
+	err       error         // set before ready is closed if the bucket refused the tokens
+	granted   bool
+	cancelled bool
+}
+
+// DRRScheduler constructor; defaultQuantum is the credit each key earns per turn
+func NewDRRScheduler(limiter *TokenBucket, defaultQuantum float64) *DRRScheduler {
+	if limiter == nil || defaultQuantum <= 0 {
+		panic("invalid DRR scheduler parameters")
+	}
+
+	return &DRRScheduler{
+		limiter:        limiter,
+		defaultQuantum: defaultQuantum,
+		quantums:       make(map[string]float64),
+		queues:         make(map[string]*drrQueue),
+	}
+}
+
+// SetQuantum sets how much credit a key earns per turn; give a key a bigger quantum to give it a bigger share
+func (s *DRRScheduler) SetQuantum(key string, quantum float64) {
+	if quantum <= 0 {
+		panic("invalid DRR scheduler parameters")
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.quantums[key] = quantum
+}
+
+// Wait queues up a request of the given cost under key, and blocks until the scheduler grants it
+// Returns ErrBurstExceeded right away if cost is more than the bucket can ever hold, and whatever
+// error the bucket's WaitN gives if it refuses the tokens (e.g. ErrPaused or ErrClosed)
+// BLOCKING!! Blocks current goroutine
+func (s *DRRScheduler) Wait(ctx context.Context, key string, cost float64) error {
+	if cost > s.limiter.capacity() {
+		return ErrBurstExceeded
+	}
+
+	w := &drrWaiter{cost: cost, ready: make(chan struct{})}
+
+	s.mtx.Lock()
+	q, ok := s.queues[key]
+	if !ok {
+		q = &drrQueue{}
+		s.queues[key] = q
+		s.active = append(s.active, key)
+	}
+	q.waiters = append(q.waiters, w)
+
+	// Kick off the dispatcher if nobody is running it right now
+	if !s.dispatching {
+		s.dispatching = true
+		go s.dispatch()
+	}
+	s.mtx.Unlock()
+
+	select {
+	case <-w.ready:
+		return w.err
+	case <-ctx.Done():
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		// We might have been granted right as the context ended; if so we got our tokens after all
+		if w.granted {
+			return w.err
+		}
+		w.cancelled = true
+		return waitError(ctx)
+	}
+}
+
+// Internal dispatcher loop; visits keys round robin and serves their queued waiters while they have
+// credit. Exits once every queue is empty
+func (s *DRRScheduler) dispatch() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for len(s.active) > 0 {
+		key := s.active[0]
+		q := s.queues[key]
+
+		// Every turn earns the key its quantum of credit
+		quantum, ok := s.quantums[key]
+		if !ok {
+			quantum = s.defaultQuantum
+		}
+		q.deficit += quantum
+
+		// Serve waiters from the head of the queue as long as the credit covers them
+		for len(q.waiters) > 0 {
+			w := q.waiters[0]
+			if w.cancelled {
+				q.waiters = q.waiters[1:]
+				continue
+			}
+			if w.cost > q.deficit {
+				break
+			}
+
+			// Get the tokens from the shared bucket without holding up everyone else
+			s.mtx.Unlock()
+			err := s.limiter.WaitN(context.Background(), w.cost)
+			s.mtx.Lock()
+
+			q.waiters = q.waiters[1:]
+			if err != nil {
+				// The bucket refused (paused, closed, shed...); pass that on instead of granting
+				if !w.cancelled {
+					w.err = err
+					w.granted = true
+					close(w.ready)
+				}
+				continue
+			}
+			if w.cancelled {
+				// Waiter gave up while we were getting its tokens; give them back
+				s.limiter.refund(w.cost)
+				continue
+			}
+			q.deficit -= w.cost
+			w.granted = true
+			close(w.ready)
+		}
+
+		s.active = s.active[1:]
+		if len(q.waiters) == 0 {
+			// Empty queues don't get to hoard credit
+			delete(s.queues, key)
+		} else {
+			// Back of the line for the next round
+			s.active = append(s.active, key)
+		}
+	}
+
+	s.dispatching = false
+}
+
+// Internal helper that reports whether nobody is queued
+func (s *DRRScheduler) idle() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.active) == 0
+}
@@ -0,0 +1,131 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Internal test helper that queues up waiters on a paused scheduler, then starts dispatching,
+// and returns the order keys were served in
+func runDRR(t *testing.T, s *DRRScheduler, requests []struct {
+	key  string
+	cost float64
+}) []string {
+	// Hold off the dispatcher until everyone is queued so the order is deterministic
+	s.mtx.Lock()
+	s.dispatching = true
+	s.mtx.Unlock()
+
+	var mtx sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for _, r := range requests {
+		wg.Go(func() {
+			if err := s.Wait(context.Background(), r.key, r.cost); err != nil {
+				t.Error(err)
+				return
+			}
+			mtx.Lock()
+			order = append(order, r.key)
+			mtx.Unlock()
+		})
+	}
+
+	// Wait until all requests are queued
+	for {
+		s.mtx.Lock()
+		queued := 0
+		for _, q := range s.queues {
+			queued += len(q.waiters)
+		}
+		s.mtx.Unlock()
+		if queued == len(requests) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	go s.dispatch()
+	wg.Wait()
+	return order
+}
+
+// TestDRRScheduler_SmallNotBlockedByLarge tests that small requests from one key get through
+// while another key's big requests are still saving up credit
+func TestDRRScheduler_SmallNotBlockedByLarge(t *testing.T) {
+	// Drained bucket refilling 1 token per 10ms, so grants are spaced out and happen in a clear order
+	tb := NewTokenBucket(100, time.Second, 10)
+	tb.AllowN(10)
+	s := NewDRRScheduler(tb, 1)
+
+	order := runDRR(t, s, []struct {
+		key  string
+		cost float64
+	}{
+		{"big", 5}, {"small", 1}, {"small", 1}, {"small", 1},
+	})
+
+	// Big needs 5 turns of credit, small gets served once per turn, so all of small goes first
+	if len(order) != 4 || order[3] != "big" {
+		t.Errorf("Expected small requests to be served before the big one, got %v", order)
+	}
+}
+
+// TestDRRScheduler_Quantum tests that a bigger quantum gives a key a bigger share of turns
+func TestDRRScheduler_Quantum(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 10)
+	tb.AllowN(10)
+	s := NewDRRScheduler(tb, 1)
+	s.SetQuantum("vip", 2)
+
+	order := runDRR(t, s, []struct {
+		key  string
+		cost float64
+	}{
+		{"vip", 1}, {"vip", 1}, {"vip", 1}, {"vip", 1},
+		{"normal", 1}, {"normal", 1},
+	})
+
+	// vip gets 2 requests per turn and normal gets 1, so the first 3 served include 2 vips
+	vips := 0
+	for _, key := range order[:3] {
+		if key == "vip" {
+			vips++
+		}
+	}
+	if vips != 2 {
+		t.Errorf("Expected 2 of the first 3 served to be vip, got order %v", order)
+	}
+}
+
+// TestDRRScheduler_Cancel tests that cancelled waiters return their context error and are skipped
+func TestDRRScheduler_Cancel(t *testing.T) {
+	// Bucket is drained and refills slowly, so the waiter can't be served in time
+	tb := NewTokenBucket(1, 10*time.Second, 1)
+	tb.Allow()
+	s := NewDRRScheduler(tb, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Wait(ctx, "a", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+
+	if err := s.Wait(context.Background(), "a", 2); err != ErrBurstExceeded {
+		t.Errorf("Expected ErrBurstExceeded, got: %v", err)
+	}
+}
+
+// TestDRRScheduler_BucketRefuses tests that an error from the bucket is passed on instead of granting the waiter
+func TestDRRScheduler_BucketRefuses(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 10)
+	tb.Pause()
+	s := NewDRRScheduler(tb, 1)
+
+	if err := s.Wait(context.Background(), "a", 1); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused from a paused bucket, got: %v", err)
+	}
+}
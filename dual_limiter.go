@@ -0,0 +1,61 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// DualLimiter enforces two budgets at once, like the requests-per-minute and tokens-per-minute
+// limits LLM providers put on their APIs. Every call consumes 1 request plus some token cost,
+// and is only let through if both budgets can cover it
+type DualLimiter struct {
+	requests *TokenBucket // request count budget
+	tokens   *TokenBucket // token cost budget
+}
+
+// DualLimiter constructor; e.g. NewDualLimiter(500, 30000, time.Minute) allows 500 requests
+// and 30,000 tokens per minute, whichever runs out first
+func NewDualLimiter(maxRequests int, maxTokens int, per time.Duration) *DualLimiter {
+	return &DualLimiter{
+		requests: NewTokenBucket(maxRequests, per, maxRequests),
+		tokens:   NewTokenBucket(maxTokens, per, maxTokens),
+	}
+}
+
+// Implements Allow RateLimiter method; only counts against the request budget (token cost of 0)
+// NON-BLOCKING! Returns immediately
+func (dl *DualLimiter) Allow() bool {
+	return dl.AllowTokens(0)
+}
+
+// Implements Wait RateLimiter method; only counts against the request budget (token cost of 0)
+// BLOCKING!! Blocks current goroutine
+func (dl *DualLimiter) Wait(ctx context.Context) error {
+	return dl.WaitTokens(ctx, 0)
+}
+
+// AllowTokens checks both budgets and consumes 1 request plus cost tokens only if both have room.
+// Nothing is consumed if either budget comes up short. Panics on a negative cost
+// NON-BLOCKING! Returns immediately
+func (dl *DualLimiter) AllowTokens(cost int) bool {
+	return dl.take(float64(cost)).ok
+}
+
+// WaitTokens blocks until both budgets can cover 1 request plus cost tokens, waiting on whichever
+// constraint binds. Returns ErrBurstExceeded if cost is more than the token budget can ever hold.
+// Panics on a negative cost
+// BLOCKING!! Blocks current goroutine
+func (dl *DualLimiter) WaitTokens(ctx context.Context, cost int) error {
+	return waitMulti(ctx, func() takeResult {
+		return dl.take(float64(cost))
+	})
+}
+
+// Internal helper that consumes 1 request plus cost tokens if both budgets have room.
+// Otherwise reports how long until the binding constraint has enough capacity
+func (dl *DualLimiter) take(cost float64) takeResult {
+	if cost < 0 {
+		panic("invalid dual limiter parameters") // would hand tokens back instead of charging them
+	}
+	return tryTakeMulti([]*TokenBucket{dl.requests, dl.tokens}, []float64{1, cost})
+}
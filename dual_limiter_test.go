@@ -0,0 +1,85 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestDualLimiter_RequestBudget tests that the request count budget is enforced
+func TestDualLimiter_RequestBudget(t *testing.T) {
+	// 2 requests and plenty of tokens per minute
+	dl := NewDualLimiter(2, 1000, time.Minute)
+
+	if !dl.AllowTokens(10) || !dl.AllowTokens(10) {
+		t.Fatal("Expected first 2 requests to be allowed")
+	}
+	if dl.AllowTokens(10) {
+		t.Error("Expected third request to be denied by the request budget")
+	}
+}
+
+// TestDualLimiter_TokenBudget tests that the token budget is enforced
+func TestDualLimiter_TokenBudget(t *testing.T) {
+	// Plenty of requests but only 100 tokens per minute
+	dl := NewDualLimiter(100, 100, time.Minute)
+
+	if !dl.AllowTokens(80) {
+		t.Fatal("Expected 80 token request to be allowed")
+	}
+	if dl.AllowTokens(30) {
+		t.Error("Expected 30 token request to be denied with only 20 tokens left")
+	}
+	if !dl.AllowTokens(20) {
+		t.Error("Expected 20 token request to fit in the remaining budget")
+	}
+}
+
+// TestDualLimiter_Atomic tests that a denied request doesn't consume from either budget
+func TestDualLimiter_Atomic(t *testing.T) {
+	dl := NewDualLimiter(1, 100, time.Minute)
+
+	// Denied by the token budget, so the single request slot must NOT be used up
+	if dl.AllowTokens(200) {
+		t.Fatal("Expected request over the token budget to be denied")
+	}
+	if !dl.AllowTokens(50) {
+		t.Error("Expected request budget to be untouched by the denied request")
+	}
+}
+
+// TestDualLimiter_WaitTokens tests that Wait blocks on whichever budget binds
+func TestDualLimiter_WaitTokens(t *testing.T) {
+	// 100 tokens per second, so 10 tokens refill in ~100ms
+	dl := NewDualLimiter(100, 100, time.Second)
+	dl.AllowTokens(100)
+
+	start := time.Now()
+	if err := dl.WaitTokens(context.Background(), 10); err != nil {
+		t.Fatalf("WaitTokens() returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("WaitTokens() returned too quickly: %v", elapsed)
+	}
+}
+
+// TestDualLimiter_WaitBurstExceeded tests that a cost bigger than the token budget fails immediately
+func TestDualLimiter_WaitBurstExceeded(t *testing.T) {
+	dl := NewDualLimiter(10, 100, time.Second)
+
+	if err := dl.WaitTokens(context.Background(), 101); err != ErrBurstExceeded {
+		t.Errorf("Expected ErrBurstExceeded, got: %v", err)
+	}
+}
+
+// TestDualLimiter_NegativeCost tests that a negative token cost panics instead of adding tokens
+func TestDualLimiter_NegativeCost(t *testing.T) {
+	dl := NewDualLimiter(10, 100, time.Minute)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a negative cost to panic")
+		}
+	}()
+	dl.AllowTokens(-50)
+}
@@ -0,0 +1,124 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Lowest fraction of its configured rate an ErrorBudgetLimiter throttles down to, so some traffic
+// always gets through to show whether things have recovered
+const minErrorBudgetFraction = 0.1
+
+// ErrorBudgetLimiter ties throttling to an SLO: its rate shrinks while the error budget is burning
+// faster than it should, and relaxes back as the burn slows down. At a burn rate of 1 or less (errors
+// at or under what the SLO allows) it runs at the full configured rate; above that, the rate is
+// divided by the burn rate (so burning 4x too fast means a quarter of the rate), down to a floor of
+// 10% of the configured rate.
+//
+// The burn rate comes from outcomes recorded with Record, measured over fixed windows, or from an
+// external signal (e.g. a burn rate alert in the monitoring system) passed to SetBurnRate
+type ErrorBudgetLimiter struct {
+	mtx        sync.Mutex
+	tb         *TokenBucket  // the bucket whose rate we adjust
+	maxRate    float64       // configured rate, per second
+	slo        float64       // target success ratio, e.g. 0.999
+	window     time.Duration // how long Record measures the burn rate over
+	windowFrom time.Time     // start of the current measurement window
+	total      int           // outcomes recorded in the current window
+	failed     int           // failures recorded in the current window
+	burnRate   float64       // latest burn rate; 1 means burning exactly as fast as the SLO allows
+}
+
+// ErrorBudgetLimiter constructor; slo is the target success ratio (e.g. 0.999 for three nines),
+// window is how long recorded outcomes are measured over, and maxOps per `per` (with bursts up to
+// burst) is the rate while the budget is healthy
+func NewErrorBudgetLimiter(slo float64, window time.Duration, maxOps int, per time.Duration, burst int) *ErrorBudgetLimiter {
+	if slo <= 0 || slo >= 1 || window <= 0 {
+		panic("invalid error budget parameters")
+	}
+	tb := NewTokenBucket(maxOps, per, burst)
+
+	return &ErrorBudgetLimiter{
+		tb:         tb,
+		maxRate:    tb.rate,
+		slo:        slo,
+		window:     window,
+		windowFrom: time.Now(),
+	}
+}
+
+// Implements Allow RateLimiter method at the current rate
+// NON-BLOCKING! Returns immediately
+func (eb *ErrorBudgetLimiter) Allow() bool {
+	return eb.tb.Allow()
+}
+
+// Implements Wait RateLimiter method at the current rate
+// BLOCKING!! Blocks current goroutine
+func (eb *ErrorBudgetLimiter) Wait(ctx context.Context) error {
+	return eb.tb.Wait(ctx)
+}
+
+// Record records whether a piece of admitted work succeeded, and updates the burn rate (and with it
+// the limiter's rate) if the current measurement window is over
+func (eb *ErrorBudgetLimiter) Record(success bool) {
+	eb.mtx.Lock()
+	defer eb.mtx.Unlock()
+
+	eb.total++
+	if !success {
+		eb.failed++
+	}
+
+	now := time.Now()
+	if now.Sub(eb.windowFrom) < eb.window {
+		return
+	}
+
+	// Burn rate = observed error ratio / error ratio the SLO allows
+	errorRatio := float64(eb.failed) / float64(eb.total)
+	eb.apply(errorRatio / (1 - eb.slo))
+
+	// Start a fresh window
+	eb.windowFrom = now
+	eb.total = 0
+	eb.failed = 0
+}
+
+// SetBurnRate sets the burn rate from an external signal, adjusting the limiter's rate right away
+func (eb *ErrorBudgetLimiter) SetBurnRate(burnRate float64) {
+	if burnRate < 0 {
+		panic("invalid error budget parameters")
+	}
+
+	eb.mtx.Lock()
+	defer eb.mtx.Unlock()
+	eb.apply(burnRate)
+}
+
+// BurnRate returns the latest burn rate
+func (eb *ErrorBudgetLimiter) BurnRate() float64 {
+	eb.mtx.Lock()
+	defer eb.mtx.Unlock()
+	return eb.burnRate
+}
+
+// Rate returns the current rate in operations per second
+func (eb *ErrorBudgetLimiter) Rate() float64 {
+	eb.tb.mtx.Lock()
+	defer eb.tb.mtx.Unlock()
+	return eb.tb.rate
+}
+
+// Internal helper that sets the rate for a burn rate
+// Caller must hold the lock
+func (eb *ErrorBudgetLimiter) apply(burnRate float64) {
+	eb.burnRate = burnRate
+
+	fraction := 1.0
+	if burnRate > 1 {
+		fraction = max(1/burnRate, minErrorBudgetFraction)
+	}
+	eb.tb.setRate(eb.maxRate*fraction, eb.tb.capacity())
+}
@@ -0,0 +1,55 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestErrorBudgetLimiter_Record tests that recorded failures shrink the rate and recovery relaxes it
+func TestErrorBudgetLimiter_Record(t *testing.T) {
+	eb := NewErrorBudgetLimiter(0.99, 20*time.Millisecond, 100, time.Second, 10)
+
+	// 4% errors against a 1% budget is a burn rate of 4
+	for i := 0; i < 96; i++ {
+		eb.Record(true)
+	}
+	for i := 0; i < 4; i++ {
+		eb.Record(false)
+	}
+	time.Sleep(25 * time.Millisecond)
+	eb.Record(true) // closes out the window (and counts towards it)
+
+	if burn := eb.BurnRate(); burn < 3.9 || burn > 4 {
+		t.Errorf("Expected burn rate of ~4, got %v", burn)
+	}
+	if rate := eb.Rate(); rate < 25 || rate > 26 {
+		t.Errorf("Expected rate to drop to ~25/s, got %v", rate)
+	}
+
+	// A clean window brings the full rate back
+	time.Sleep(25 * time.Millisecond)
+	eb.Record(true)
+	if rate := eb.Rate(); rate != 100 {
+		t.Errorf("Expected full rate of 100/s, got %v", rate)
+	}
+}
+
+// TestErrorBudgetLimiter_SetBurnRate tests the external signal and the rate floor
+func TestErrorBudgetLimiter_SetBurnRate(t *testing.T) {
+	eb := NewErrorBudgetLimiter(0.999, time.Minute, 100, time.Second, 10)
+
+	eb.SetBurnRate(2)
+	if rate := eb.Rate(); rate != 50 {
+		t.Errorf("Expected half rate at burn rate 2, got %v", rate)
+	}
+
+	eb.SetBurnRate(1000)
+	if rate := eb.Rate(); rate != 10 {
+		t.Errorf("Expected rate to bottom out at 10/s, got %v", rate)
+	}
+
+	eb.SetBurnRate(0.5)
+	if rate := eb.Rate(); rate != 100 {
+		t.Errorf("Expected full rate while under budget, got %v", rate)
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// FairLimiter divides one total rate among named request classes by weight (e.g. interactive=3,
+// batch=1), so bulk work can't starve latency sensitive work sharing the same limit. Weights only
+// matter while classes are competing: a class with nothing queued leaves its share to the busy ones,
+// so batch gets the full rate when nobody else wants it. Waiters are scheduled with deficit round
+// robin (see DRRScheduler), each class earning credit in proportion to its weight
+type FairLimiter struct {
+	tb    *TokenBucket  // the shared total rate
+	sched *DRRScheduler // hands tokens out to queued waiters by class weight
+}
+
+// FairClass is one request class of a FairLimiter, usable anywhere a RateLimiter is expected
+type FairClass struct {
+	fl   *FairLimiter
+	name string
+}
+
+// FairLimiter constructor; the total rate is maxOps per `per` with bursts up to burst, shared among
+// classes by the given weights. Classes not in weights get a weight of 1
+func NewFairLimiter(maxOps int, per time.Duration, burst int, weights map[string]int) *FairLimiter {
+	tb := NewTokenBucket(maxOps, per, burst)
+	sched := NewDRRScheduler(tb, 1)
+	for class, weight := range weights {
+		if weight <= 0 {
+			panic("invalid fair limiter parameters")
+		}
+		sched.SetQuantum(class, float64(weight))
+	}
+
+	return &FairLimiter{tb: tb, sched: sched}
+}
+
+// Class returns the limiter for the named class
+func (fl *FairLimiter) Class(name string) *FairClass {
+	return &FairClass{fl: fl, name: name}
+}
+
+// Implements Allow RateLimiter method; only takes a token if nobody in any class is queued for one,
+// so Allow can't cut in front of the weighted schedule
+// NON-BLOCKING! Returns immediately
+func (fc *FairClass) Allow() bool {
+	if !fc.fl.sched.idle() {
+		return false
+	}
+	return fc.fl.tb.Allow()
+}
+
+// Implements Wait RateLimiter method; queues up in the class's queue and blocks until the weighted
+// schedule gets to it
+// BLOCKING!! Blocks current goroutine
+func (fc *FairClass) Wait(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+	return fc.fl.sched.Wait(ctx, fc.name, 1)
+}
@@ -0,0 +1,83 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestFairLimiter_Weights tests that competing classes are served in proportion to their weights
+func TestFairLimiter_Weights(t *testing.T) {
+	fl := NewFairLimiter(200, time.Second, 1, map[string]int{"interactive": 3, "batch": 1})
+	interactive, batch := fl.Class("interactive"), fl.Class("batch")
+	fl.tb.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// Both classes keep plenty of requests queued
+	var mtx sync.Mutex
+	counts := map[string]int{}
+	var wg sync.WaitGroup
+	for _, class := range []*FairClass{interactive, batch} {
+		for range 100 {
+			wg.Go(func() {
+				if class.Wait(ctx) == nil {
+					mtx.Lock()
+					counts[class.name]++
+					mtx.Unlock()
+				}
+			})
+		}
+	}
+	wg.Wait()
+
+	ratio := float64(counts["interactive"]) / float64(max(counts["batch"], 1))
+	if ratio < 2 || ratio > 4.5 {
+		t.Errorf("Expected interactive to get ~3x batch, got %d vs %d", counts["interactive"], counts["batch"])
+	}
+}
+
+// TestFairLimiter_IdleShareFlows tests that a class alone gets the whole rate
+func TestFairLimiter_IdleShareFlows(t *testing.T) {
+	fl := NewFairLimiter(100, time.Second, 1, map[string]int{"interactive": 3, "batch": 1})
+	batch := fl.Class("batch")
+	batch.Allow()
+
+	start := time.Now()
+	for range 10 {
+		if err := batch.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 10 tokens at the full 100/s is ~100ms, not the ~400ms a quarter share would take
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Expected batch to get the full rate while alone, took %v", elapsed)
+	}
+}
+
+// TestFairLimiter_AllowDoesNotCutInLine tests that Allow is denied while anyone is queued
+func TestFairLimiter_AllowDoesNotCutInLine(t *testing.T) {
+	fl := NewFairLimiter(10, time.Second, 1, nil)
+	fl.Class("a").Allow()
+
+	go fl.Class("a").Wait(context.Background())
+	time.Sleep(20 * time.Millisecond)
+
+	if fl.Class("b").Allow() {
+		t.Error("Expected Allow to be denied while a waiter is queued")
+	}
+}
+
+// TestFairLimiter_Closed tests that Wait fails once the shared bucket is closed
+func TestFairLimiter_Closed(t *testing.T) {
+	fl := NewFairLimiter(10, time.Second, 1, nil)
+	fl.tb.Close(context.Background())
+
+	if err := fl.Class("a").Wait(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got: %v", err)
+	}
+}
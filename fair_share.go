@@ -0,0 +1,141 @@
+package ratelimiter
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FairShareAllocator divides one global rate among whichever tenants are currently active using
+// max-min fairness: tenants that want less than an equal split get everything they want, and the
+// share they don't use is split among the tenants that want more. Shares are recomputed every
+// interval from each tenant's observed demand, so a global cap is shared sensibly without
+// hand-maintained per-tenant splits
+type FairShareAllocator struct {
+	mtx         sync.Mutex
+	rate        float64                 // global rate in tokens per second
+	interval    time.Duration           // how often shares are recomputed
+	tenants     map[string]*tenantShare // currently active tenants
+	windowStart time.Time               // start of the current demand measurement window
+}
+
+// Per tenant state for the allocator
+type tenantShare struct {
+	tb       *TokenBucket // tenant's bucket, refilled at its current share
+	attempts int          // requests seen in the current window (allowed or not), used to measure demand
+	share    float64      // currently allocated rate in tokens per second
+}
+
+// FairShareAllocator constructor; maxOps per `per` is the global rate to share out
+func NewFairShareAllocator(maxOps int, per time.Duration, interval time.Duration) *FairShareAllocator {
+	if maxOps <= 0 || per <= 0 || interval <= 0 {
+		panic("invalid fair share parameters")
+	}
+
+	return &FairShareAllocator{
+		rate:        float64(maxOps) / per.Seconds(),
+		interval:    interval,
+		tenants:     make(map[string]*tenantShare),
+		windowStart: time.Now(),
+	}
+}
+
+// Allow checks whether the tenant has room in its current fair share
+// NON-BLOCKING! Returns immediately
+func (fs *FairShareAllocator) Allow(tenant string) bool {
+	return fs.bucket(tenant).Allow()
+}
+
+// Wait blocks until the tenant has room in its fair share, or the context is cancelled
+// BLOCKING!! Blocks current goroutine
+func (fs *FairShareAllocator) Wait(ctx context.Context, tenant string) error {
+	return fs.bucket(tenant).Wait(ctx)
+}
+
+// Share returns the rate (tokens per second) currently allocated to a tenant, or 0 if it isn't active
+func (fs *FairShareAllocator) Share(tenant string) float64 {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+
+	if ts, ok := fs.tenants[tenant]; ok {
+		return ts.share
+	}
+	return 0
+}
+
+// Internal helper that counts a request against the tenant's demand and returns its bucket,
+// recomputing shares when the interval is up or a new tenant shows up
+func (fs *FairShareAllocator) bucket(tenant string) *TokenBucket {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+
+	now := time.Now()
+	ts, ok := fs.tenants[tenant]
+	if !ok {
+		// Start with a placeholder bucket; recompute below gives it a real share
+		ts = &tenantShare{tb: NewTokenBucket(1, time.Second, 1)}
+		fs.tenants[tenant] = ts
+	}
+	ts.attempts++
+
+	if !ok || now.Sub(fs.windowStart) >= fs.interval {
+		fs.recompute(now, !ok)
+	}
+	return ts.tb
+}
+
+// Internal helper that redistributes the global rate with max-min fairness (water filling)
+// Caller must hold the lock
+func (fs *FairShareAllocator) recompute(now time.Time, newTenant bool) {
+	elapsed := now.Sub(fs.windowStart)
+	windowOver := elapsed >= fs.interval
+
+	type demand struct {
+		ts   *tenantShare
+		rate float64
+	}
+	demands := make([]demand, 0, len(fs.tenants))
+
+	for name, ts := range fs.tenants {
+		// Tenants that sat out a whole window are no longer active and give up their share
+		if windowOver && ts.attempts == 0 {
+			delete(fs.tenants, name)
+			continue
+		}
+
+		// Mid-window (a new tenant showed up) we don't have a full measurement yet, so assume
+		// everyone wants as much as they can get and just split evenly
+		rate := math.Inf(1)
+		if windowOver {
+			rate = float64(ts.attempts) / elapsed.Seconds()
+		}
+		demands = append(demands, demand{ts, rate})
+	}
+	if len(demands) == 0 {
+		return
+	}
+
+	// Water filling: satisfy the smallest demands first, each getting at most an equal split of what's left
+	slices.SortFunc(demands, func(a, b demand) int { return cmp.Compare(a.rate, b.rate) })
+	remaining := fs.rate
+	for i, d := range demands {
+		d.ts.share = min(d.rate, remaining/float64(len(demands)-i))
+		remaining -= d.ts.share
+	}
+
+	// If everyone got what they wanted, spread the leftover evenly so tenants have room to grow
+	for _, d := range demands {
+		d.ts.share += remaining / float64(len(demands))
+		d.ts.tb.setRate(d.ts.share, max(1, d.ts.share)) // burst of about a second's worth of share
+		if windowOver {
+			d.ts.attempts = 0
+		}
+	}
+
+	if windowOver || (newTenant && len(demands) == 1) {
+		fs.windowStart = now
+	}
+}
@@ -0,0 +1,65 @@
+package ratelimiter
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestFairShare_EvenSplit tests that new tenants split the global rate evenly
+func TestFairShare_EvenSplit(t *testing.T) {
+	fs := NewFairShareAllocator(100, time.Second, time.Minute)
+
+	fs.Allow("a")
+	if share := fs.Share("a"); share != 100 {
+		t.Errorf("Expected a lone tenant to get the whole rate, got %v", share)
+	}
+
+	fs.Allow("b")
+	if a, b := fs.Share("a"), fs.Share("b"); a != 50 || b != 50 {
+		t.Errorf("Expected an even split of 50/50, got %v/%v", a, b)
+	}
+}
+
+// TestFairShare_MaxMin tests that a light tenant's unused share goes to the heavy tenant
+func TestFairShare_MaxMin(t *testing.T) {
+	fs := NewFairShareAllocator(100, time.Second, 100*time.Millisecond)
+
+	// Light tenant makes 1 request in the window (~10/sec), heavy tenant makes 50 (~500/sec)
+	fs.Allow("light")
+	for range 50 {
+		fs.Allow("heavy")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Next call closes the window and recomputes
+	fs.Allow("heavy")
+
+	light, heavy := fs.Share("light"), fs.Share("heavy")
+	if math.Abs(light+heavy-100) > 0.001 {
+		t.Errorf("Expected shares to add up to the global rate, got %v + %v", light, heavy)
+	}
+	if light > 15 || heavy < 85 {
+		t.Errorf("Expected light tenant to keep roughly its demand and heavy to get the rest, got %v/%v", light, heavy)
+	}
+}
+
+// TestFairShare_InactiveTenantsDropped tests that tenants idle for a whole window give up their share
+func TestFairShare_InactiveTenantsDropped(t *testing.T) {
+	fs := NewFairShareAllocator(100, time.Second, 50*time.Millisecond)
+
+	fs.Allow("a")
+	fs.Allow("b")
+	time.Sleep(60 * time.Millisecond)
+	fs.Allow("a") // closes the window where both were active
+
+	time.Sleep(60 * time.Millisecond)
+	fs.Allow("a") // closes a window where only a was active
+
+	if share := fs.Share("b"); share != 0 {
+		t.Errorf("Expected inactive tenant to be dropped, got share %v", share)
+	}
+	if share := fs.Share("a"); share != 100 {
+		t.Errorf("Expected remaining tenant to get the whole rate, got %v", share)
+	}
+}
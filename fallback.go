@@ -0,0 +1,52 @@
+package ratelimiter
+
+import "context"
+
+// Degradable is implemented by limiters that can tell when they can't be trusted right now, e.g. a
+// distributed limiter whose backend is down or whose circuit breaker is open
+type Degradable interface {
+	Degraded() bool
+}
+
+// FallbackLimiter sends decisions to a primary limiter while it's healthy, and to a secondary one
+// while the primary reports itself degraded, so e.g. a distributed limiter can fail over to a
+// stricter local one automatically. A primary that doesn't implement Degradable is always used
+type FallbackLimiter struct {
+	primary   RateLimiter
+	secondary RateLimiter
+}
+
+// FallbackLimiter constructor
+func Fallback(primary RateLimiter, secondary RateLimiter) *FallbackLimiter {
+	if primary == nil || secondary == nil {
+		panic("invalid fallback parameters")
+	}
+	return &FallbackLimiter{primary: primary, secondary: secondary}
+}
+
+// Implements Allow RateLimiter method on whichever limiter is in charge right now
+// NON-BLOCKING! Returns immediately
+func (f *FallbackLimiter) Allow() bool {
+	return f.active().Allow()
+}
+
+// Implements Wait RateLimiter method on whichever limiter is in charge right now
+// BLOCKING!! Blocks current goroutine
+func (f *FallbackLimiter) Wait(ctx context.Context) error {
+	return f.active().Wait(ctx)
+}
+
+// Degraded returns true if we're currently falling back to the secondary limiter, so fallbacks can
+// be chained or monitored
+func (f *FallbackLimiter) Degraded() bool {
+	d, ok := f.primary.(Degradable)
+	return ok && d.Degraded()
+}
+
+// Internal helper that picks the limiter to consult
+func (f *FallbackLimiter) active() RateLimiter {
+	if f.Degraded() {
+		return f.secondary
+	}
+	return f.primary
+}
@@ -0,0 +1,56 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Fake limiter for testing that allows everything and can be marked as degraded
+type fakeDegradable struct {
+	degraded atomic.Bool
+}
+
+func (f *fakeDegradable) Allow() bool                    { return true }
+func (f *fakeDegradable) Wait(ctx context.Context) error { return nil }
+func (f *fakeDegradable) Degraded() bool                 { return f.degraded.Load() }
+
+// TestFallback tests that the secondary is only used while the primary is degraded
+func TestFallback(t *testing.T) {
+	primary := &fakeDegradable{}
+	secondary := NewTokenBucket(1, time.Hour, 1)
+	f := Fallback(primary, secondary)
+
+	for i := 0; i < 5; i++ {
+		if !f.Allow() {
+			t.Fatal("Expected healthy primary to allow everything")
+		}
+	}
+	if secondary.Tokens() != 1 {
+		t.Error("Expected secondary to be left alone while primary is healthy")
+	}
+
+	primary.degraded.Store(true)
+	if !f.Degraded() {
+		t.Error("Expected fallback to report degraded")
+	}
+	if !f.Allow() || f.Allow() {
+		t.Error("Expected the strict secondary to take over")
+	}
+
+	primary.degraded.Store(false)
+	if !f.Allow() {
+		t.Error("Expected primary to take back over once healthy")
+	}
+}
+
+// TestFallback_NotDegradable tests that a primary without Degraded is always used
+func TestFallback_NotDegradable(t *testing.T) {
+	f := Fallback(NewTokenBucket(1, time.Hour, 1), NewTokenBucket(1, time.Hour, 100))
+
+	f.Allow()
+	if f.Allow() || f.Degraded() {
+		t.Error("Expected primary to be used")
+	}
+}
@@ -0,0 +1,48 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"time"
+)
+
+// ThrottleFileServer wraps a file serving handler (like http.FileServer) with download speed limits:
+// perConnection bytes per second for each connection, and perUser bytes per second in total across
+// all of a user's parallel connections, so splitting a download into many range requests doesn't help.
+// Users are identified with key, which defaults to ClientIP when nil. Pass 0 to skip a limit
+func ThrottleFileServer(fs http.Handler, perConnection int, perUser int, key KeyFunc) http.Handler {
+	if perConnection < 0 || perUser < 0 {
+		panic("invalid throttle parameters")
+	}
+	if key == nil {
+		key = ClientIP
+	}
+
+	// Connections are told apart by their remote address (IP + port), so keep-alive requests on the
+	// same connection share its budget. Idle ones get forgotten, same as ThrottleWrites does for clients
+	var connections, users *keyedBuckets
+	if perConnection > 0 {
+		connections = newKeyedBuckets(time.Minute, func(string) *TokenBucket {
+			return NewTokenBucket(perConnection, time.Second, perConnection)
+		})
+	}
+	if perUser > 0 {
+		users = newKeyedBuckets(time.Minute, func(string) *TokenBucket {
+			return NewTokenBucket(perUser, time.Second, perUser)
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &ThrottledResponseWriter{ResponseWriter: w, ctx: r.Context()}
+
+		if connections != nil {
+			conn := r.RemoteAddr
+			tw.limiters = append(tw.limiters, func() *TokenBucket { return connections.get(conn) })
+		}
+		if users != nil {
+			user := key(r)
+			tw.limiters = append(tw.limiters, func() *TokenBucket { return users.get(user) })
+		}
+
+		fs.ServeHTTP(tw, r)
+	})
+}
@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Internal test helper that serves a directory with a single 500 byte file in it
+func newTestFileServer(t *testing.T) http.Handler {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.bin"), []byte(strings.Repeat("x", 500)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return http.FileServer(http.Dir(dir))
+}
+
+// TestThrottleFileServer_PerConnection tests that a single download is paced to the connection limit
+func TestThrottleFileServer_PerConnection(t *testing.T) {
+	// 2000 bytes per second per connection, so 500 bytes takes ~250ms once the first burst is used up
+	srv := httptest.NewServer(ThrottleFileServer(newTestFileServer(t), 2000, 0, nil))
+	defer srv.Close()
+
+	// First download uses up the connection's initial burst
+	download(t, srv.URL+"/file.bin")
+	download(t, srv.URL+"/file.bin")
+	download(t, srv.URL+"/file.bin")
+	download(t, srv.URL+"/file.bin")
+
+	// Keep-alive connection is reused, so this one has to wait for the budget to refill
+	start := time.Now()
+	body := download(t, srv.URL+"/file.bin")
+	if len(body) != 500 {
+		t.Errorf("Expected 500 bytes, got %d", len(body))
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected download to be throttled, took %v", elapsed)
+	}
+}
+
+// TestThrottleFileServer_PerUser tests that parallel connections from one user share an aggregate limit
+func TestThrottleFileServer_PerUser(t *testing.T) {
+	// Generous per-connection limit, but only 1000 bytes per second for the whole user
+	srv := httptest.NewServer(ThrottleFileServer(newTestFileServer(t), 100000, 1000, nil))
+	defer srv.Close()
+
+	// 4 parallel downloads on separate connections = 2000 bytes, so at least ~1s of it has to be paced
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			resp, err := client.Get(srv.URL + "/file.bin")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		})
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("Expected user's parallel downloads to share one budget, took %v", elapsed)
+	}
+}
+
+// Internal test helper that downloads a URL and returns the body
+func download(t *testing.T, url string) []byte {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
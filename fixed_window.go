@@ -0,0 +1,96 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FixedWindow counts requests in fixed windows of time and lets up to maxOps through in each one,
+// resetting the count at every window boundary. Windows are aligned to multiples of `per` on the clock
+// (so a per minute window resets at :00 of every minute), matching how most APIs document
+// their limits. Unlike a TokenBucket, this allows up to 2x maxOps in a short span across a boundary,
+// which is exactly what the upstream would allow too
+type FixedWindow struct {
+	mtx         sync.Mutex
+	maxOps      int           // requests allowed per window
+	per         time.Duration // window length
+	windowStart time.Time     // start of the current window
+	count       int           // requests let through in the current window
+}
+
+// FixedWindow constructor; lets up to maxOps requests through in every window of length `per`
+func NewFixedWindow(maxOps int, per time.Duration) *FixedWindow {
+	if maxOps <= 0 || per <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+
+	return &FixedWindow{
+		maxOps:      maxOps,
+		per:         per,
+		windowStart: time.Now().Truncate(per),
+	}
+}
+
+// Implements Allow RateLimiter method; allows the request if the current window isn't used up yet
+// NON-BLOCKING! Returns immediately
+func (fw *FixedWindow) Allow() bool {
+	fw.mtx.Lock()
+	defer fw.mtx.Unlock()
+
+	fw.advance(time.Now())
+	if fw.count >= fw.maxOps {
+		return false
+	}
+	fw.count++
+	return true
+}
+
+// Implements Wait RateLimiter method; blocks until the request fits in a window, which once the
+// current window is used up means waiting for the next one to start
+// BLOCKING!! Blocks current goroutine
+func (fw *FixedWindow) Wait(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	for {
+		fw.mtx.Lock()
+		now := time.Now()
+		fw.advance(now)
+		if fw.count < fw.maxOps {
+			fw.count++
+			fw.mtx.Unlock()
+			return nil
+		}
+		waitDuration := fw.windowStart.Add(fw.per).Sub(now)
+		fw.mtx.Unlock()
+
+		select {
+		case <-time.After(waitDuration):
+			continue
+		case <-ctx.Done():
+			return waitError(ctx)
+		}
+	}
+}
+
+// Status returns how many requests are left in the current window and how long until it resets;
+// suitable for RateLimit-Remaining and RateLimit-Reset style headers
+func (fw *FixedWindow) Status() (remaining int, reset time.Duration) {
+	fw.mtx.Lock()
+	defer fw.mtx.Unlock()
+
+	now := time.Now()
+	fw.advance(now)
+	return fw.maxOps - fw.count, fw.windowStart.Add(fw.per).Sub(now)
+}
+
+// Internal helper that starts a fresh window once the current one has ended
+// Caller must hold the lock
+func (fw *FixedWindow) advance(now time.Time) {
+	if now.Sub(fw.windowStart) >= fw.per {
+		fw.windowStart = now.Truncate(fw.per)
+		fw.count = 0
+	}
+}
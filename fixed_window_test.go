@@ -0,0 +1,61 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestFixedWindow_Limit tests that only maxOps requests get through per window
+func TestFixedWindow_Limit(t *testing.T) {
+	fw := NewFixedWindow(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if !fw.Allow() {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	if fw.Allow() {
+		t.Error("Expected 4th request in the window to be denied")
+	}
+}
+
+// TestFixedWindow_Reset tests that the count resets at the window boundary, not a window after the first request
+func TestFixedWindow_Reset(t *testing.T) {
+	fw := NewFixedWindow(2, 100*time.Millisecond)
+	for fw.Allow() {
+	}
+
+	_, reset := fw.Status()
+	if reset <= 0 || reset > 100*time.Millisecond {
+		t.Fatalf("Expected reset within the window, got %v", reset)
+	}
+
+	time.Sleep(reset + 5*time.Millisecond)
+	if remaining, _ := fw.Status(); remaining != 2 {
+		t.Errorf("Expected a fresh window with 2 remaining, got %d", remaining)
+	}
+}
+
+// TestFixedWindow_Alignment tests that windows line up with multiples of their length
+func TestFixedWindow_Alignment(t *testing.T) {
+	fw := NewFixedWindow(1, time.Second)
+	if fw.windowStart.UnixNano()%int64(time.Second) != 0 {
+		t.Errorf("Expected the window to start on a whole second, got %v", fw.windowStart)
+	}
+}
+
+// TestFixedWindow_Wait tests that Wait blocks until the next window
+func TestFixedWindow_Wait(t *testing.T) {
+	fw := NewFixedWindow(1, 100*time.Millisecond)
+	fw.Allow()
+	_, reset := fw.Status()
+
+	start := time.Now()
+	if err := fw.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < reset-5*time.Millisecond {
+		t.Errorf("Expected to wait ~%v for the next window, took %v", reset, elapsed)
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// GCRA implements the generic cell rate algorithm. It allows the same traffic as a TokenBucket with the
+// same rate and burst, but keeps a single timestamp instead of a token count: the theoretical arrival
+// time (TAT), when the next request would be due if requests came in exactly at the configured rate.
+// A request is allowed as long as it isn't more than burst-1 emission intervals ahead of the TAT.
+// Since the whole state is one timestamp, it's easy to store elsewhere, and the exact retry-after for a
+// denied request falls right out of it
+type GCRA struct {
+	mtx      sync.Mutex
+	interval time.Duration // emission interval; time between requests at the steady rate
+	delay    time.Duration // delay variation tolerance; how far ahead of schedule a request may be
+	tat      time.Time     // theoretical arrival time of the next request
+}
+
+// GCRA constructor; lets maxOps requests through per `per`, with bursts of up to burst requests
+func NewGCRA(maxOps int, per time.Duration, burst int) *GCRA {
+	if maxOps <= 0 || per <= 0 || burst <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+
+	interval := per / time.Duration(maxOps)
+	return &GCRA{
+		interval: interval,
+		delay:    interval * time.Duration(burst-1),
+		tat:      time.Now(),
+	}
+}
+
+// Implements Allow RateLimiter method; allows the request if it isn't too far ahead of schedule
+// NON-BLOCKING! Returns immediately
+func (g *GCRA) Allow() bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	_, ok := g.take(time.Now())
+	return ok
+}
+
+// Implements Wait RateLimiter method; blocks until the request is within tolerance of its schedule
+// BLOCKING!! Blocks current goroutine
+func (g *GCRA) Wait(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	for {
+		g.mtx.Lock()
+		waitDuration, ok := g.take(time.Now())
+		g.mtx.Unlock()
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-time.After(waitDuration):
+			continue
+		case <-ctx.Done():
+			return waitError(ctx)
+		}
+	}
+}
+
+// TAT returns the current theoretical arrival time; when it's in the past, the full burst is available
+func (g *GCRA) TAT() time.Time {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.tat
+}
+
+// RetryAfter returns how long until a request would be allowed; 0 if one would be allowed right now.
+// Suitable for a Retry-After header on a denied request
+func (g *GCRA) RetryAfter() time.Duration {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.retryAfter(time.Now())
+}
+
+// Internal helper that allows a request if it's within tolerance, pushing the TAT back one interval.
+// Otherwise returns how long until it would be
+// Caller must hold the lock
+func (g *GCRA) take(now time.Time) (time.Duration, bool) {
+	if wait := g.retryAfter(now); wait > 0 {
+		return wait, false
+	}
+
+	// The next request is due one interval after this one, or after the last one if we're ahead of schedule
+	if g.tat.Before(now) {
+		g.tat = now
+	}
+	g.tat = g.tat.Add(g.interval)
+	return 0, true
+}
+
+// Internal helper that returns how far a request at now is past the tolerance, or 0 if it's within it
+// Caller must hold the lock
+func (g *GCRA) retryAfter(now time.Time) time.Duration {
+	allowAt := g.tat.Add(-g.delay)
+	return max(allowAt.Sub(now), 0)
+}
@@ -0,0 +1,70 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestGCRA_Burst tests that exactly burst requests get through at once
+func TestGCRA_Burst(t *testing.T) {
+	g := NewGCRA(10, time.Second, 5)
+
+	for i := 0; i < 5; i++ {
+		if !g.Allow() {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	if g.Allow() {
+		t.Error("Expected request past the burst to be denied")
+	}
+}
+
+// TestGCRA_RetryAfter tests that the retry-after matches when the next request actually goes through
+func TestGCRA_RetryAfter(t *testing.T) {
+	g := NewGCRA(10, time.Second, 1)
+	if g.RetryAfter() != 0 {
+		t.Fatal("Expected no retry-after on a fresh limiter")
+	}
+	g.Allow()
+
+	retryAfter := g.RetryAfter()
+	if retryAfter < 90*time.Millisecond || retryAfter > 100*time.Millisecond {
+		t.Fatalf("Expected retry-after of ~100ms, got %v", retryAfter)
+	}
+
+	time.Sleep(retryAfter - 20*time.Millisecond)
+	if g.Allow() {
+		t.Error("Expected request before the retry-after to be denied")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !g.Allow() {
+		t.Error("Expected request after the retry-after to be allowed")
+	}
+}
+
+// TestGCRA_TAT tests that every allowed request pushes the TAT back one interval
+func TestGCRA_TAT(t *testing.T) {
+	g := NewGCRA(10, time.Second, 3)
+	start := g.TAT()
+
+	g.Allow()
+	g.Allow()
+	if got := g.TAT().Sub(start); got < 200*time.Millisecond || got > 210*time.Millisecond {
+		t.Errorf("Expected TAT ~200ms ahead after 2 requests, got %v", got)
+	}
+}
+
+// TestGCRA_Wait tests that Wait blocks for one interval once the burst is used up
+func TestGCRA_Wait(t *testing.T) {
+	g := NewGCRA(10, time.Second, 1)
+	g.Allow()
+
+	start := time.Now()
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("Expected to wait ~100ms, took %v", elapsed)
+	}
+}
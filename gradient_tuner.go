@@ -0,0 +1,97 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// How much weight each new latency sample gets in the GradientTuner's short and long term averages
+const (
+	gradientShortAlpha = 2.0 / (10 + 1)  // ~last 10 samples
+	gradientLongAlpha  = 2.0 / (600 + 1) // ~last 600 samples
+)
+
+// How far the GradientTuner moves its limit toward the newly computed one per sample
+const gradientSmoothing = 0.2
+
+// GradientTuner continuously adjusts an AdmissionController's concurrency limit from latency samples,
+// in the style of Netflix's gradient2 algorithm. It keeps a long term average latency as the baseline,
+// and a short term one for how things are going right now. Their ratio (the gradient, capped between
+// 0.5 and 1) shrinks the limit as latency climbs above the baseline, and a queueing allowance of
+// sqrt(limit) on top lets it probe for more while latency holds steady.
+//
+// Unlike the ConcurrencyTuner, which recomputes once per interval from throughput, this reacts to
+// every sample and doesn't need the backend to be saturated to find its limit. The limit only grows
+// while at least half of it is actually in use, so a quiet service doesn't drift up to the max
+type GradientTuner struct {
+	mtx      sync.Mutex
+	ac       *AdmissionController // controller whose concurrency limit we tune
+	minLimit float64              // lower bound for the limit
+	maxLimit float64              // upper bound for the limit
+	limit    float64              // current limit, before rounding down
+	shortRTT float64              // short term average latency, in seconds
+	longRTT  float64              // long term average latency, in seconds
+}
+
+// GradientTuner constructor; starts the controller's limit at minLimit
+func NewGradientTuner(ac *AdmissionController, minLimit int, maxLimit int) *GradientTuner {
+	if ac == nil || minLimit <= 0 || maxLimit < minLimit {
+		panic("invalid gradient tuner parameters")
+	}
+
+	ac.SetMaxInFlight(minLimit)
+	return &GradientTuner{
+		ac:       ac,
+		minLimit: float64(minLimit),
+		maxLimit: float64(maxLimit),
+		limit:    float64(minLimit),
+	}
+}
+
+// Observe records the latency of a piece of admitted work once it completes, and adjusts the limit
+func (gt *GradientTuner) Observe(latency time.Duration) {
+	inFlight := gt.ac.InFlight()
+
+	gt.mtx.Lock()
+	defer gt.mtx.Unlock()
+
+	sample := latency.Seconds()
+	if gt.longRTT == 0 {
+		gt.shortRTT, gt.longRTT = sample, sample
+	} else {
+		gt.shortRTT += (sample - gt.shortRTT) * gradientShortAlpha
+		gt.longRTT += (sample - gt.longRTT) * gradientLongAlpha
+	}
+
+	// If the baseline has drifted way above where latency is now (e.g. after a slow spell), pull it
+	// back down faster so it doesn't take hundreds of samples to trust the lower latency again
+	if gt.longRTT > 2*gt.shortRTT {
+		gt.longRTT *= 0.95
+	}
+
+	gradient := 1.0
+	if gt.shortRTT > 0 {
+		gradient = min(max(gt.longRTT/gt.shortRTT, 0.5), 1)
+	}
+	newLimit := gt.limit*gradient + math.Sqrt(gt.limit)
+	limit := gt.limit*(1-gradientSmoothing) + newLimit*gradientSmoothing
+
+	// Not using half the limit, so latency says nothing about whether we could handle more
+	if float64(inFlight) < gt.limit/2 {
+		limit = min(limit, gt.limit)
+	}
+	limit = min(max(limit, gt.minLimit), gt.maxLimit)
+
+	if int(limit) != int(gt.limit) {
+		gt.ac.SetMaxInFlight(int(limit))
+	}
+	gt.limit = limit
+}
+
+// Limit returns the concurrency limit the tuner has currently settled on
+func (gt *GradientTuner) Limit() int {
+	gt.mtx.Lock()
+	defer gt.mtx.Unlock()
+	return int(gt.limit)
+}
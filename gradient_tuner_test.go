@@ -0,0 +1,64 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestGradientTuner_GrowsWhileLatencyHolds tests that the limit climbs while latency stays at the baseline
+func TestGradientTuner_GrowsWhileLatencyHolds(t *testing.T) {
+	ac := NewAdmissionController(nil, 0, 0)
+	gt := NewGradientTuner(ac, 4, 100)
+
+	for range 200 {
+		// Keep the limit fully used, like a busy service would
+		var held []*Admission
+		for {
+			a, ok := ac.TryAdmit(0)
+			if !ok {
+				break
+			}
+			held = append(held, a)
+		}
+		gt.Observe(10 * time.Millisecond)
+		for _, a := range held {
+			a.Release()
+		}
+	}
+
+	if limit := gt.Limit(); limit <= 4 {
+		t.Errorf("Expected limit to grow above the minimum, got %d", limit)
+	}
+	if ac.maxInFlight != gt.Limit() {
+		t.Errorf("Expected controller limit %d to match tuner limit %d", ac.maxInFlight, gt.Limit())
+	}
+}
+
+// TestGradientTuner_ShrinksOnLatencyRise tests that the limit comes down when latency climbs over the baseline
+func TestGradientTuner_ShrinksOnLatencyRise(t *testing.T) {
+	ac := NewAdmissionController(nil, 0, 0)
+	gt := NewGradientTuner(ac, 1, 100)
+	gt.limit = 50
+	gt.shortRTT, gt.longRTT = 0.01, 0.01
+
+	for range 20 {
+		gt.Observe(100 * time.Millisecond)
+	}
+
+	if limit := gt.Limit(); limit >= 50 {
+		t.Errorf("Expected limit to shrink as latency rose, got %d", limit)
+	}
+}
+
+// TestGradientTuner_IdleDoesNotGrow tests that the limit doesn't grow when it isn't being used
+func TestGradientTuner_IdleDoesNotGrow(t *testing.T) {
+	ac := NewAdmissionController(nil, 0, 0)
+	gt := NewGradientTuner(ac, 4, 100)
+
+	for range 200 {
+		gt.Observe(10 * time.Millisecond)
+	}
+	if limit := gt.Limit(); limit != 4 {
+		t.Errorf("Expected limit to stay at 4 with nothing in flight, got %d", limit)
+	}
+}
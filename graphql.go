@@ -0,0 +1,124 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Largest GraphQL request body we'll read to work out its cost
+const maxGraphQLBody = 1 << 20
+
+// ComplexityFunc computes the cost of a GraphQL operation, e.g. with a query complexity analyzer or
+// the complexity calculation of the GraphQL server library in use. An error means the operation
+// couldn't be analyzed (e.g. it doesn't parse), and the request is rejected with 400 Bad Request,
+// as it is for a negative cost
+type ComplexityFunc func(query string, operationName string, variables map[string]any) (int, error)
+
+// LimitGraphQL is middleware that charges each GraphQL request its computed query complexity against
+// a budget of maxCost per `per`, so one deeply nested query can't cost the same as a trivial one.
+// Requests over budget get 429 Too Many Requests with a Retry-After header; an operation costing
+// more than maxCost can never run and gets 413 Request Entity Too Large, as does a body over 1 MiB.
+// With a key, each client gets its own budget; with a nil key everyone shares one.
+// Only POST requests are analyzed; anything else passes straight through. A batch (a JSON array of
+// operations) is charged the total of its operations. An operation without a query to analyze (e.g. a
+// persisted query sent only by its hash) is charged the whole maxCost, and a body that isn't a JSON
+// operation or batch gets 400 Bad Request, so nothing gets through unpriced.
+// An Override in the request context can bypass the budget or scale what a query costs
+func LimitGraphQL(next http.Handler, complexity ComplexityFunc, maxCost int, per time.Duration, key KeyFunc) http.Handler {
+	if complexity == nil || maxCost <= 0 || per <= 0 {
+		panic("invalid graphql limit parameters")
+	}
+
+	newBudget := func(string) *TokenBucket { return NewTokenBucket(maxCost, per, maxCost) }
+	shared := newBudget("")
+	budgets := newKeyedBuckets(max(per, time.Minute), newBudget)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multiplier, limited := overrideCost(r, 1)
+		if r.Method != http.MethodPost || !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Read one byte past the limit so we can tell a body that's too big from one that just fits
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLBody+1))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxGraphQLBody {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body)) // put the body back for the GraphQL handler
+
+		ops, ok := parseGraphQLOperations(body)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		complexityCost := 0
+		for _, op := range ops {
+			if op.Query == "" {
+				complexityCost += maxCost // nothing we can analyze, so assume the worst
+				continue
+			}
+			opCost, err := complexity(op.Query, op.OperationName, op.Variables)
+			if err != nil || opCost < 0 {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			complexityCost += opCost
+		}
+		cost := int(math.Ceil(float64(complexityCost) * multiplier))
+		if cost > maxCost {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		budget := shared
+		if key != nil {
+			budget = budgets.get(key(r))
+		}
+
+		if !budget.AllowN(float64(cost)) {
+			// Let the client know when the budget will have room for this query again
+			retryAfter := math.Ceil(budget.EstimatedWait(float64(cost)).Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(retryAfter))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// One GraphQL operation in a request body
+type graphQLOperation struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Internal helper that parses a request body holding either a single GraphQL operation or a batch
+// of them. Returns false if it's neither
+func parseGraphQLOperations(body []byte) ([]graphQLOperation, bool) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var ops []graphQLOperation
+		if json.Unmarshal(trimmed, &ops) != nil || len(ops) == 0 {
+			return nil, false
+		}
+		return ops, true
+	}
+
+	var op graphQLOperation
+	if json.Unmarshal(body, &op) != nil {
+		return nil, false
+	}
+	return []graphQLOperation{op}, true
+}
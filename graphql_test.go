@@ -0,0 +1,120 @@
+package ratelimiter
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test complexity function that charges one per opening brace, a rough stand in for nesting depth
+func braceComplexity(query string, _ string, _ map[string]any) (int, error) {
+	if strings.Count(query, "{") != strings.Count(query, "}") {
+		return 0, errors.New("unbalanced braces")
+	}
+	return strings.Count(query, "{"), nil
+}
+
+// Helper that posts a GraphQL query through the handler and returns the status code
+func postGraphQL(handler http.Handler, query string) int {
+	body := `{"query": ` + strconv.Quote(query) + `}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+	return rec.Code
+}
+
+// TestLimitGraphQL tests that queries are charged by their complexity
+func TestLimitGraphQL(t *testing.T) {
+	var received string
+	handler := LimitGraphQL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	}), braceComplexity, 5, time.Hour, nil)
+
+	// Nested query costs 4, leaving 1
+	if code := postGraphQL(handler, "{ a { b { c { d } } } }"); code != http.StatusOK {
+		t.Fatalf("Expected nested query to be allowed, got %d", code)
+	}
+	if !strings.Contains(received, "a { b") {
+		t.Errorf("Expected the body to reach the handler, got %q", received)
+	}
+
+	// Another nested query doesn't fit, a trivial one does
+	if code := postGraphQL(handler, "{ a { b } }"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for a query over budget, got %d", code)
+	}
+	if code := postGraphQL(handler, "{ a }"); code != http.StatusOK {
+		t.Errorf("Expected trivial query to be allowed, got %d", code)
+	}
+}
+
+// TestLimitGraphQL_Rejections tests queries that can't be priced or can never fit
+func TestLimitGraphQL_Rejections(t *testing.T) {
+	handler := LimitGraphQL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), braceComplexity, 2, time.Hour, ClientIP)
+
+	if code := postGraphQL(handler, "{ a { b"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a query that can't be analyzed, got %d", code)
+	}
+	if code := postGraphQL(handler, "{ a { b { c } } }"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a query costing more than the whole budget, got %d", code)
+	}
+
+	// A body too big to read whole can't be priced, and must not reach the server cut short
+	big := `{"query": "{ a }", "variables": {"blob": "` + strings.Repeat("x", maxGraphQLBody) + `"}}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(big)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body over the limit, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql?query={a}", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected GET requests to pass through, got %d", rec.Code)
+	}
+}
+
+// TestLimitGraphQL_Unpriced tests that batches and operations without a query don't get through for free
+func TestLimitGraphQL_Unpriced(t *testing.T) {
+	served := 0
+	handler := LimitGraphQL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served++ }), braceComplexity, 4, time.Hour, nil)
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// A batch of 3 queries costing 1 each fits in the budget of 4, a second one doesn't
+	batch := `[{"query": "{ a }"}, {"query": "{ b }"}, {"query": "{ c }"}]`
+	if code := post(batch); code != http.StatusOK {
+		t.Errorf("Expected the first batch to be allowed, got %d", code)
+	}
+	if code := post(batch); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second batch to be charged for every query, got %d", code)
+	}
+
+	// Persisted queries sent by hash can't be analyzed, so they cost the whole budget
+	if code := post(`{"extensions": {"persistedQuery": {"sha256Hash": "abc"}}}`); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a query without text to be charged the whole budget, got %d", code)
+	}
+	if code := post(`not json`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a body that isn't an operation, got %d", code)
+	}
+	if served != 1 {
+		t.Errorf("Expected only the first batch to be served, got %d", served)
+	}
+}
+
+// TestLimitGraphQL_NegativeCost tests that a negative complexity is rejected rather than crediting the budget
+func TestLimitGraphQL_NegativeCost(t *testing.T) {
+	negative := func(string, string, map[string]any) (int, error) { return -100, nil }
+	handler := LimitGraphQL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), negative, 5, time.Hour, nil)
+
+	if code := postGraphQL(handler, "{ a }"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative cost, got %d", code)
+	}
+}
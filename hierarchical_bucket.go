@@ -0,0 +1,82 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HierarchicalBucket shares one global capacity between children (e.g. tenants) that each have a
+// guaranteed rate of their own, like HTB in Linux traffic control. A child's requests first use its
+// own guaranteed tokens; once those run out, it can borrow whatever the parent has to spare. Guaranteed
+// traffic counts against the parent too, so children can only borrow what nobody is using
+type HierarchicalBucket struct {
+	mtx        sync.Mutex   // held while a child tries its guarantee and the parent, so the attempts don't interleave
+	parent     *TokenBucket // global capacity
+	guaranteed float64      // total guaranteed rate handed out to children, per second
+}
+
+// ChildBucket is one child of a HierarchicalBucket, with its own guaranteed rate
+type ChildBucket struct {
+	hb  *HierarchicalBucket
+	own *TokenBucket // guaranteed capacity
+}
+
+// HierarchicalBucket constructor; the global capacity is maxOps per `per`, with bursts up to burst
+func NewHierarchicalBucket(maxOps int, per time.Duration, burst int) *HierarchicalBucket {
+	return &HierarchicalBucket{parent: NewTokenBucket(maxOps, per, burst)}
+}
+
+// Child adds a child guaranteed minOps per `per` (with bursts up to burst) on top of which it can
+// borrow spare global capacity. Panics if the guarantees would add up to more than the global rate
+func (hb *HierarchicalBucket) Child(minOps int, per time.Duration, burst int) *ChildBucket {
+	own := NewTokenBucket(minOps, per, burst)
+
+	hb.mtx.Lock()
+	defer hb.mtx.Unlock()
+
+	if hb.guaranteed+own.rate > hb.parent.rate*(1+1e-9) {
+		panic("invalid hierarchical bucket parameters")
+	}
+	hb.guaranteed += own.rate
+	return &ChildBucket{hb: hb, own: own}
+}
+
+// Implements Allow RateLimiter method; allows the request out of the child's guarantee, or else out
+// of spare global capacity
+// NON-BLOCKING! Returns immediately
+func (cb *ChildBucket) Allow() bool {
+	return cb.take().ok
+}
+
+// Implements Wait RateLimiter method; blocks until either the child's guarantee or the spare global
+// capacity has room, whichever comes first
+// BLOCKING!! Blocks current goroutine
+func (cb *ChildBucket) Wait(ctx context.Context) error {
+	return waitMulti(ctx, cb.take)
+}
+
+// Internal helper that takes a token from the child's guarantee, or else borrows one from the parent.
+// Guaranteed tokens are charged to the parent as well, even if that puts it in debt, so borrowing only
+// ever gets capacity nobody is using. Otherwise returns how long until either has a token
+func (cb *ChildBucket) take() takeResult {
+	cb.hb.mtx.Lock()
+	defer cb.hb.mtx.Unlock()
+
+	parent, own := cb.hb.parent, cb.own
+	guaranteed := tryTakeMulti([]*TokenBucket{own}, []float64{1})
+	if guaranteed.ok {
+		parent.charge(1)
+		return guaranteed
+	}
+	if guaranteed.err != nil {
+		return guaranteed
+	}
+
+	// Out of guaranteed tokens; borrow from the parent
+	borrowed := tryTakeMulti([]*TokenBucket{parent}, []float64{1})
+	if borrowed.ok || borrowed.err != nil {
+		return borrowed
+	}
+	return takeResult{wait: min(guaranteed.wait, borrowed.wait)}
+}
@@ -0,0 +1,102 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHierarchicalBucket_Borrowing tests that a child can go past its guarantee using spare global capacity
+func TestHierarchicalBucket_Borrowing(t *testing.T) {
+	hb := NewHierarchicalBucket(10, time.Hour, 10)
+	a := hb.Child(1, time.Hour, 2)
+
+	allowed := 0
+	for a.Allow() {
+		allowed++
+	}
+	// 2 from its own guarantee (also charged to the parent), then the 8 the parent has left
+	if allowed != 10 {
+		t.Errorf("Expected 10 requests through the child, got %d", allowed)
+	}
+}
+
+// TestHierarchicalBucket_GuaranteedFloor tests that a child keeps its guarantee when others used up the spare capacity
+func TestHierarchicalBucket_GuaranteedFloor(t *testing.T) {
+	hb := NewHierarchicalBucket(10, time.Hour, 10)
+	a := hb.Child(1, time.Hour, 3)
+	b := hb.Child(1, time.Hour, 3)
+
+	// a uses its guarantee and borrows everything the parent has
+	for a.Allow() {
+	}
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("Expected b's guaranteed request %d to be allowed", i+1)
+		}
+	}
+	if b.Allow() {
+		t.Error("Expected b to be denied past its guarantee with no spare capacity")
+	}
+}
+
+// TestHierarchicalBucket_OverCommitted tests that guarantees can't add up to more than the global rate
+func TestHierarchicalBucket_OverCommitted(t *testing.T) {
+	hb := NewHierarchicalBucket(10, time.Second, 10)
+	hb.Child(6, time.Second, 1)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected guarantees over the global rate to panic")
+		}
+	}()
+	hb.Child(5, time.Second, 1)
+}
+
+// TestHierarchicalBucket_Wait tests that Wait takes whichever of the guarantee or the parent refills first
+func TestHierarchicalBucket_Wait(t *testing.T) {
+	hb := NewHierarchicalBucket(10, time.Second, 1)
+	a := hb.Child(1, time.Minute, 1)
+	for a.Allow() {
+	}
+
+	// The parent refills a token in ~100ms, long before the child's guarantee does
+	start := time.Now()
+	if err := a.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > 250*time.Millisecond {
+		t.Errorf("Expected to wait ~100ms for the parent, took %v", elapsed)
+	}
+}
+
+// TestHierarchicalBucket_GlobalCap tests that guaranteed and borrowed traffic together stay within the global rate
+func TestHierarchicalBucket_GlobalCap(t *testing.T) {
+	hb := NewHierarchicalBucket(100, time.Second, 10)
+	children := []*ChildBucket{hb.Child(50, time.Second, 1), hb.Child(1, time.Second, 1)}
+
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(time.Second)
+	for _, child := range children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				if child.Allow() {
+					total.Add(1)
+				}
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 100/s for a second, plus the parent's burst of 10 and a token of burst per child
+	if n := total.Load(); n > 115 {
+		t.Errorf("Expected at most ~112 requests across children, got %d", n)
+	}
+}
@@ -0,0 +1,49 @@
+package ratelimiter
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// InvalidAPIKey is the key APIKey maps requests without a valid API key to, so they all share one
+// bucket instead of every made up key getting limiter state of its own
+const InvalidAPIKey = "invalid"
+
+// KeyFunc extracts the identity a request should be rate limited under (client IP, user ID, API key, etc.)
+// Requests that map to the same key share the same limiter state
+type KeyFunc func(r *http.Request) string
+
+// ClientIP is a KeyFunc that keys requests by the IP address of the connecting client
+// NOTE: behind a proxy or load balancer this will be the proxy's address, not the end user's!
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr // no port in the address, so use it as is
+	}
+	return host
+}
+
+// APIKey returns a KeyFunc that keys requests by their API key, taken from an "Authorization: Bearer"
+// header, then the given header (e.g. "X-API-Key"), then the given query parameter (e.g. "api_key");
+// pass "" to skip a source. Keys that validate rejects (e.g. a bad HMAC signature or an unknown key),
+// and requests without one, all map to InvalidAPIKey. A nil validate accepts any non-empty key
+func APIKey(header string, query string, validate func(key string) bool) KeyFunc {
+	return func(r *http.Request) string {
+		key := ""
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = strings.TrimSpace(token)
+		}
+		if key == "" && header != "" {
+			key = r.Header.Get(header)
+		}
+		if key == "" && query != "" {
+			key = r.URL.Query().Get(query)
+		}
+
+		if key == "" || (validate != nil && !validate(key)) {
+			return InvalidAPIKey
+		}
+		return key
+	}
+}
@@ -0,0 +1,50 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestClientIP tests that the port is stripped from the remote address
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if got := ClientIP(req); got != "192.0.2.1" {
+		t.Errorf("Expected 192.0.2.1, got %s", got)
+	}
+
+	req.RemoteAddr = "192.0.2.1"
+	if got := ClientIP(req); got != "192.0.2.1" {
+		t.Errorf("Expected address without port to be used as is, got %s", got)
+	}
+}
+
+// TestAPIKey tests where API keys are taken from and that invalid ones are collapsed
+func TestAPIKey(t *testing.T) {
+	key := APIKey("X-API-Key", "api_key", func(k string) bool { return strings.HasPrefix(k, "live_") })
+
+	tests := []struct {
+		name string
+		req  func(r *http.Request)
+		want string
+	}{
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer live_a") }, "live_a"},
+		{"header", func(r *http.Request) { r.Header.Set("X-API-Key", "live_b") }, "live_b"},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "api_key=live_c" }, "live_c"},
+		{"bearer first", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer live_a")
+			r.Header.Set("X-API-Key", "live_b")
+		}, "live_a"},
+		{"invalid", func(r *http.Request) { r.Header.Set("X-API-Key", "garbage") }, InvalidAPIKey},
+		{"missing", func(r *http.Request) {}, InvalidAPIKey},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		tt.req(req)
+		if got := key(req); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Internal helper that hands out one shared TokenBucket per key, creating them on first use
+// and forgetting keys that have gone idle so memory doesn't grow forever with every client we've seen
+type keyedBuckets struct {
+	mtx       sync.Mutex
+	buckets   map[string]*keyedBucket
+	newBucket func(key string) *TokenBucket // builds the bucket for a key we haven't seen before
+	idleTTL   time.Duration                 // how long a key can go unused before it's dropped
+	lastPrune time.Time                     // last time we swept for idle keys
+}
+
+// A bucket along with the last time someone asked for it
+type keyedBucket struct {
+	tb       *TokenBucket
+	lastUsed time.Time
+}
+
+// keyedBuckets constructor
+func newKeyedBuckets(idleTTL time.Duration, newBucket func(key string) *TokenBucket) *keyedBuckets {
+	return &keyedBuckets{
+		buckets:   make(map[string]*keyedBucket),
+		newBucket: newBucket,
+		idleTTL:   idleTTL,
+		lastPrune: time.Now(),
+	}
+}
+
+// Returns the bucket for key, creating it if needed
+func (kb *keyedBuckets) get(key string) *TokenBucket {
+	kb.mtx.Lock()
+	defer kb.mtx.Unlock()
+
+	now := time.Now()
+	kb.prune(now)
+
+	entry, ok := kb.buckets[key]
+	if !ok {
+		entry = &keyedBucket{tb: kb.newBucket(key)}
+		kb.buckets[key] = entry
+	}
+	entry.lastUsed = now
+	return entry.tb
+}
+
+// Returns the bucket for key if we already have one, without creating it
+func (kb *keyedBuckets) peek(key string) (*TokenBucket, bool) {
+	kb.mtx.Lock()
+	defer kb.mtx.Unlock()
+
+	entry, ok := kb.buckets[key]
+	if !ok {
+		return nil, false
+	}
+	return entry.tb, true
+}
+
+// Returns every bucket we currently have
+func (kb *keyedBuckets) all() []*TokenBucket {
+	kb.mtx.Lock()
+	defer kb.mtx.Unlock()
+
+	buckets := make([]*TokenBucket, 0, len(kb.buckets))
+	for _, entry := range kb.buckets {
+		buckets = append(buckets, entry.tb)
+	}
+	return buckets
+}
+
+// Drops keys that haven't been used within idleTTL. Only sweeps once per idleTTL so we don't
+// walk the whole map on every request
+// Caller must hold the lock
+func (kb *keyedBuckets) prune(now time.Time) {
+	if now.Sub(kb.lastPrune) < kb.idleTTL {
+		return
+	}
+	for key, entry := range kb.buckets {
+		if now.Sub(entry.lastUsed) >= kb.idleTTL {
+			delete(kb.buckets, key)
+		}
+	}
+	kb.lastPrune = now
+}
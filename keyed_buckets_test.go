@@ -0,0 +1,34 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestKeyedBuckets_SharedPerKey tests that the same key always gets the same bucket
+func TestKeyedBuckets_SharedPerKey(t *testing.T) {
+	kb := newKeyedBuckets(time.Minute, func(string) *TokenBucket { return NewTokenBucket(1, time.Second, 1) })
+
+	if kb.get("a") != kb.get("a") {
+		t.Error("Expected the same bucket for the same key")
+	}
+	if kb.get("a") == kb.get("b") {
+		t.Error("Expected different buckets for different keys")
+	}
+}
+
+// TestKeyedBuckets_PrunesIdle tests that keys unused for longer than the TTL are forgotten
+func TestKeyedBuckets_PrunesIdle(t *testing.T) {
+	kb := newKeyedBuckets(50*time.Millisecond, func(string) *TokenBucket { return NewTokenBucket(1, time.Second, 1) })
+
+	kb.get("idle")
+	time.Sleep(60 * time.Millisecond)
+	kb.get("active")
+
+	if _, ok := kb.buckets["idle"]; ok {
+		t.Error("Expected idle key to be pruned")
+	}
+	if _, ok := kb.buckets["active"]; !ok {
+		t.Error("Expected active key to be kept")
+	}
+}
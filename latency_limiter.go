@@ -0,0 +1,147 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// How the LatencyTargetLimiter moves its rate: cut by this factor when over the target...
+const latencyBackoffFactor = 0.8
+
+// ...and grow by this fraction of the max rate when under it
+const latencyGrowthStep = 0.05
+
+// LatencyTargetLimiter is a rate limiter that adapts its rate to keep a latency percentile of the work
+// it admits under a target (e.g. p99 under 200ms), instead of waiting for errors to signal overload.
+//
+// Every interval it estimates the percentile from the latencies recorded with Observe. If it's over
+// the target, the rate is cut multiplicatively; if it's under, the rate grows additively (AIMD), so
+// the limiter backs off quickly when the backend slows down and probes carefully for more headroom
+type LatencyTargetLimiter struct {
+	mtx        sync.Mutex
+	tb         *TokenBucket     // the bucket whose rate we adapt
+	target     time.Duration    // latency the percentile should stay under
+	percentile float64          // which percentile we control on, e.g. 0.99
+	minRate    float64          // lowest rate we go to, per second
+	maxRate    float64          // highest rate we go to, per second
+	interval   time.Duration    // how often the rate is recomputed
+	rate       float64          // current rate, per second
+	windowFrom time.Time        // start of the current measurement window
+	latencies  latencyHistogram // latencies recorded in the current window
+}
+
+// LatencyTargetLimiter constructor; the rate moves between minOps and maxOps per `per` (starting at
+// maxOps), with bursts up to burst, and is recomputed every interval
+func NewLatencyTargetLimiter(target time.Duration, percentile float64, minOps int, maxOps int, per time.Duration, burst int, interval time.Duration) *LatencyTargetLimiter {
+	if target <= 0 || percentile <= 0 || percentile > 1 || minOps <= 0 || maxOps < minOps || interval <= 0 {
+		panic("invalid latency limiter parameters")
+	}
+	tb := NewTokenBucket(maxOps, per, burst)
+
+	return &LatencyTargetLimiter{
+		tb:         tb,
+		target:     target,
+		percentile: percentile,
+		minRate:    float64(minOps) / per.Seconds(),
+		maxRate:    tb.rate,
+		interval:   interval,
+		rate:       tb.rate,
+		windowFrom: time.Now(),
+	}
+}
+
+// Implements Allow RateLimiter method at the current rate
+// NON-BLOCKING! Returns immediately
+func (ll *LatencyTargetLimiter) Allow() bool {
+	return ll.tb.Allow()
+}
+
+// Implements Wait RateLimiter method at the current rate
+// BLOCKING!! Blocks current goroutine
+func (ll *LatencyTargetLimiter) Wait(ctx context.Context) error {
+	return ll.tb.Wait(ctx)
+}
+
+// Observe records the latency of a piece of admitted work once it completes, and recomputes the
+// rate if the current measurement window is over
+func (ll *LatencyTargetLimiter) Observe(latency time.Duration) {
+	ll.mtx.Lock()
+	defer ll.mtx.Unlock()
+
+	ll.latencies.record(latency)
+
+	now := time.Now()
+	if now.Sub(ll.windowFrom) < ll.interval {
+		return
+	}
+
+	if ll.latencies.quantile(ll.percentile) > ll.target {
+		ll.rate = max(ll.rate*latencyBackoffFactor, ll.minRate)
+	} else {
+		ll.rate = min(ll.rate+ll.maxRate*latencyGrowthStep, ll.maxRate)
+	}
+	ll.tb.setRate(ll.rate, ll.tb.capacity())
+
+	// Start a fresh window
+	ll.windowFrom = now
+	ll.latencies = latencyHistogram{}
+}
+
+// Rate returns the current rate in operations per second
+func (ll *LatencyTargetLimiter) Rate() float64 {
+	ll.mtx.Lock()
+	defer ll.mtx.Unlock()
+	return ll.rate
+}
+
+// Buckets in a latencyHistogram grow by this factor, so estimates are within ~5% of the real value
+const latencyBucketGrowth = 1.05
+
+// Internal HDR style histogram of latencies with logarithmically sized buckets, so percentiles can be
+// estimated in constant memory no matter how many latencies get recorded
+type latencyHistogram struct {
+	counts []int // counts[i] is how many latencies fell in bucket i
+	total  int
+}
+
+// Records a latency
+func (h *latencyHistogram) record(d time.Duration) {
+	i := latencyBucket(d)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int, i-len(h.counts)+1)...)
+	}
+	h.counts[i]++
+	h.total++
+}
+
+// Returns the latency that fraction q (between 0 and 1) of the recorded latencies were at or under,
+// rounded up to its bucket's upper bound. Returns 0 if nothing has been recorded
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(q * float64(h.total)))
+	seen := 0
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return latencyBucketBound(i)
+		}
+	}
+	return latencyBucketBound(len(h.counts) - 1)
+}
+
+// Internal helper that returns the histogram bucket a latency falls in; bucket i covers latencies
+// up to latencyBucketBound(i) microseconds
+func latencyBucket(d time.Duration) int {
+	us := max(float64(d)/float64(time.Microsecond), 1)
+	return int(math.Ceil(math.Log(us) / math.Log(latencyBucketGrowth)))
+}
+
+// Internal helper that returns the upper bound of a histogram bucket
+func latencyBucketBound(i int) time.Duration {
+	return time.Duration(math.Pow(latencyBucketGrowth, float64(i)) * float64(time.Microsecond))
+}
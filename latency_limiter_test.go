@@ -0,0 +1,72 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLatencyTargetLimiter_BacksOff tests that the rate comes down while latency is over the target
+// and recovers once it's back under
+func TestLatencyTargetLimiter_BacksOff(t *testing.T) {
+	ll := NewLatencyTargetLimiter(100*time.Millisecond, 0.99, 10, 100, time.Second, 10, 20*time.Millisecond)
+
+	// A window where the p99 is way over target
+	for i := 0; i < 100; i++ {
+		ll.Observe(300 * time.Millisecond)
+	}
+	time.Sleep(25 * time.Millisecond)
+	ll.Observe(300 * time.Millisecond)
+
+	if rate := ll.Rate(); rate != 80 {
+		t.Errorf("Expected rate to be cut to 80/s, got %v", rate)
+	}
+
+	// A window where latency is healthy again
+	time.Sleep(25 * time.Millisecond)
+	ll.Observe(10 * time.Millisecond)
+
+	if rate := ll.Rate(); rate != 85 {
+		t.Errorf("Expected rate to grow to 85/s, got %v", rate)
+	}
+}
+
+// TestLatencyTargetLimiter_Bounds tests that the rate stays between the configured min and max
+func TestLatencyTargetLimiter_Bounds(t *testing.T) {
+	ll := NewLatencyTargetLimiter(100*time.Millisecond, 0.5, 10, 100, time.Second, 10, time.Millisecond)
+
+	for i := 0; i < 20; i++ {
+		time.Sleep(2 * time.Millisecond)
+		ll.Observe(time.Second)
+	}
+	if rate := ll.Rate(); rate != 10 {
+		t.Errorf("Expected rate to bottom out at 10/s, got %v", rate)
+	}
+
+	for i := 0; i < 40; i++ {
+		time.Sleep(2 * time.Millisecond)
+		ll.Observe(time.Millisecond)
+	}
+	if rate := ll.Rate(); rate != 100 {
+		t.Errorf("Expected rate to top out at 100/s, got %v", rate)
+	}
+}
+
+// TestLatencyHistogram tests percentile estimates against a known distribution
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	if h.quantile(0.99) != 0 {
+		t.Error("Expected 0 from an empty histogram")
+	}
+
+	// 1ms through 100ms, one of each
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	for q, want := range map[float64]time.Duration{0.5: 50 * time.Millisecond, 0.99: 99 * time.Millisecond} {
+		got := h.quantile(q)
+		if got < want || float64(got) > float64(want)*latencyBucketGrowth {
+			t.Errorf("Expected p%v within 5%% above %v, got %v", q*100, want, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// LeakyBucket lets requests out at a constant rate, one every per/maxOps, with no bursts at all:
+// even after a quiet spell, two requests are never let through closer together than that. Waiters
+// queue up in the bucket and drain out one at a time; once capacity of them are queued, Wait fails
+// with ErrQueueFull instead of queueing more. Useful in front of downstreams that can't handle bursts
+// even within a TokenBucket's capacity
+type LeakyBucket struct {
+	mtx      sync.Mutex
+	interval time.Duration // time between two requests leaving the bucket
+	capacity int           // most waiters queued at once
+	next     time.Time     // earliest time the next request can leave
+}
+
+// LeakyBucket constructor; lets out maxOps requests per `per`, evenly spaced, with up to capacity
+// requests queued in Wait
+func NewLeakyBucket(maxOps int, per time.Duration, capacity int) *LeakyBucket {
+	if maxOps <= 0 || per <= 0 || capacity <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+
+	return &LeakyBucket{
+		interval: per / time.Duration(maxOps),
+		capacity: capacity,
+		next:     time.Now(),
+	}
+}
+
+// Every returns a limiter that lets at most one event through per d, with no bursts building up while
+// it's idle: after a quiet spell, the first event goes right away and the next one still has to wait d.
+// Handy for strictly paced polling. Wait queues up as many callers as there are
+func Every(d time.Duration) *LeakyBucket {
+	return NewLeakyBucket(1, d, math.MaxInt)
+}
+
+// Implements Allow RateLimiter method; allows the request if nothing has left the bucket in the last
+// interval and nobody is queued ahead of it
+// NON-BLOCKING! Returns immediately
+func (lb *LeakyBucket) Allow() bool {
+	lb.mtx.Lock()
+	defer lb.mtx.Unlock()
+
+	now := time.Now()
+	if now.Before(lb.next) {
+		return false
+	}
+	lb.next = now.Add(lb.interval)
+	return true
+}
+
+// Implements Wait RateLimiter method; queues the request for the next free slot and blocks until then.
+// Returns ErrQueueFull right away if capacity requests are already queued
+// BLOCKING!! Blocks current goroutine
+func (lb *LeakyBucket) Wait(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	lb.mtx.Lock()
+	now := time.Now()
+	slot := lb.next
+	if slot.Before(now) {
+		slot = now
+	}
+	if lb.queued(now) >= lb.capacity {
+		lb.mtx.Unlock()
+		return ErrQueueFull
+	}
+	lb.next = slot.Add(lb.interval)
+	lb.mtx.Unlock()
+
+	waitDuration := time.Until(slot)
+	if waitDuration <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(waitDuration):
+		return nil
+	case <-ctx.Done():
+		// Hand our slot back if nobody has queued up behind us; otherwise it just goes unused
+		lb.mtx.Lock()
+		if lb.next.Equal(slot.Add(lb.interval)) {
+			lb.next = slot
+		}
+		lb.mtx.Unlock()
+		return waitError(ctx)
+	}
+}
+
+// Queued returns how many requests are currently queued in Wait
+func (lb *LeakyBucket) Queued() int {
+	lb.mtx.Lock()
+	defer lb.mtx.Unlock()
+	return lb.queued(time.Now())
+}
+
+// Internal helper that counts the slots handed out that are still in the future. Slots are spaced one
+// interval apart, with the last one at next - interval
+// Caller must hold the lock
+func (lb *LeakyBucket) queued(now time.Time) int {
+	ahead := lb.next.Sub(now)
+	if ahead <= 0 {
+		return 0
+	}
+	return int((ahead - 1) / lb.interval)
+}
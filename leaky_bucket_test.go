@@ -0,0 +1,103 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLeakyBucket_NoBurst tests that Allow never lets two requests through within one interval,
+// even when the bucket has been idle
+func TestLeakyBucket_NoBurst(t *testing.T) {
+	lb := NewLeakyBucket(10, time.Second, 5)
+	time.Sleep(200 * time.Millisecond) // idle time shouldn't build up a burst
+
+	if !lb.Allow() {
+		t.Fatal("Expected first request to be allowed")
+	}
+	if lb.Allow() {
+		t.Error("Expected second request within the interval to be denied")
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	if !lb.Allow() {
+		t.Error("Expected request after one interval to be allowed")
+	}
+}
+
+// TestLeakyBucket_WaitSpacing tests that waiters are let out evenly spaced
+func TestLeakyBucket_WaitSpacing(t *testing.T) {
+	lb := NewLeakyBucket(20, time.Second, 10) // one every 50ms
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := lb.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// First goes right away, the other 4 are 50ms apart
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond || elapsed > 350*time.Millisecond {
+		t.Errorf("Expected ~200ms for 5 requests, took %v", elapsed)
+	}
+}
+
+// TestLeakyBucket_QueueFull tests that Wait fails once capacity requests are queued
+func TestLeakyBucket_QueueFull(t *testing.T) {
+	lb := NewLeakyBucket(1, time.Second, 2)
+	lb.Allow()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		go lb.Wait(ctx)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if queued := lb.Queued(); queued != 2 {
+		t.Errorf("Expected 2 queued, got %d", queued)
+	}
+	if err := lb.Wait(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got: %v", err)
+	}
+}
+
+// TestLeakyBucket_CancelReturnsSlot tests that a cancelled waiter at the back of the queue gives its slot back
+func TestLeakyBucket_CancelReturnsSlot(t *testing.T) {
+	lb := NewLeakyBucket(1, time.Second, 2)
+	lb.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := lb.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded error, got: %v", err)
+	}
+
+	if queued := lb.Queued(); queued != 0 {
+		t.Errorf("Expected the slot to be handed back, %d still queued", queued)
+	}
+}
+
+// TestEvery tests that Every allows one event per interval without ever building up a burst
+func TestEvery(t *testing.T) {
+	limiter := Every(50 * time.Millisecond)
+	time.Sleep(120 * time.Millisecond) // idle for more than two intervals
+
+	if !limiter.Allow() {
+		t.Fatal("Expected first event to be allowed")
+	}
+	if limiter.Allow() {
+		t.Error("Expected no burst after being idle")
+	}
+
+	start := time.Now()
+	for range 3 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond || elapsed > 300*time.Millisecond {
+		t.Errorf("Expected ~150ms for 3 paced events, took %v", elapsed)
+	}
+}
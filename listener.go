@@ -0,0 +1,243 @@
+package ratelimiter
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// LimitListener wraps a net.Listener and limits the connections it hands out: how many can be open
+// at once, how fast new ones are accepted, and how many any single source IP can hold open.
+// Works in front of an http.Server (via Serve) or any raw TCP accept loop
+type LimitListener struct {
+	net.Listener
+	slots          chan struct{} // one entry per open connection; nil means no global connection limit
+	acceptRate     *TokenBucket  // new connections per second across all sources; nil means no rate limit
+	perSourceConns int           // max open connections per source IP; 0 means no limit
+	perSourceRate  *keyedBuckets // new connections per second per source IP; nil means no limit
+	banFor         time.Duration // how long a source is banned after going over its rate
+
+	mtx     sync.Mutex
+	sources map[string]int       // open connections per source IP
+	bans    map[string]time.Time // banned source IPs and when their ban ends
+	swept   time.Time            // last time we cleared out expired bans
+
+	ctx    context.Context // cancelled on Close so blocked Accepts give up
+	cancel context.CancelFunc
+}
+
+// ListenerOption configures a LimitListener at construction time
+type ListenerOption func(*LimitListener)
+
+// WithMaxConns caps how many accepted connections can be open at once. Accept blocks until one closes
+func WithMaxConns(n int) ListenerOption {
+	if n <= 0 {
+		panic("invalid listener parameters")
+	}
+	return func(l *LimitListener) {
+		l.slots = make(chan struct{}, n)
+	}
+}
+
+// WithAcceptRate caps how fast new connections are accepted (maxOps per `per`, with bursts up to burst).
+// Accept waits rather than rejecting, so excess connections queue up in the kernel's backlog
+func WithAcceptRate(maxOps int, per time.Duration, burst int) ListenerOption {
+	return func(l *LimitListener) {
+		l.acceptRate = NewTokenBucket(maxOps, per, burst)
+	}
+}
+
+// WithPerSourceMaxConns caps how many connections a single source IP can have open at once.
+// Connections over the cap are closed right after being accepted
+func WithPerSourceMaxConns(n int) ListenerOption {
+	if n <= 0 {
+		panic("invalid listener parameters")
+	}
+	return func(l *LimitListener) {
+		l.perSourceConns = n
+	}
+}
+
+// WithPerSourceAcceptRate caps how fast a single source IP can open new connections (maxOps per `per`,
+// with bursts up to burst). A source that goes over gets banned for banFor, and every connection it
+// opens in the meantime is closed right after being accepted, to protect the accept loop from floods
+func WithPerSourceAcceptRate(maxOps int, per time.Duration, burst int, banFor time.Duration) ListenerOption {
+	if banFor < 0 {
+		panic("invalid listener parameters")
+	}
+	NewTokenBucket(maxOps, per, burst) // validate parameters up front
+
+	return func(l *LimitListener) {
+		// Sources that go quiet get forgotten once their bucket would be full again anyway
+		idle := max(time.Duration(float64(burst)/float64(maxOps)*float64(per)), time.Minute)
+		l.perSourceRate = newKeyedBuckets(idle, func(string) *TokenBucket {
+			return NewTokenBucket(maxOps, per, burst)
+		})
+		l.banFor = banFor
+	}
+}
+
+// LimitListener constructor
+func NewLimitListener(inner net.Listener, opts ...ListenerOption) *LimitListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &LimitListener{
+		Listener: inner,
+		sources:  make(map[string]int),
+		bans:     make(map[string]time.Time),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Accept waits for a free connection slot and for the accept rate to allow it, then accepts the
+// next connection that isn't over its source's limit
+// BLOCKING!! Blocks current goroutine
+func (l *LimitListener) Accept() (net.Conn, error) {
+	for {
+		// Wait for a free connection slot
+		if l.slots != nil {
+			select {
+			case l.slots <- struct{}{}:
+			case <-l.ctx.Done():
+				return nil, net.ErrClosed
+			}
+		}
+
+		// Wait for the accept rate to let a new connection in
+		if l.acceptRate != nil {
+			if err := l.acceptRate.Wait(l.ctx); err != nil {
+				l.releaseSlot()
+				return nil, net.ErrClosed
+			}
+		}
+
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.releaseSlot()
+			return nil, err
+		}
+
+		source := sourceIP(c.RemoteAddr())
+		if !l.admitSource(source) {
+			// Source is over one of its limits or banned; drop it and move on to the next one
+			c.Close()
+			l.releaseSlot()
+			continue
+		}
+
+		return &limitedConn{Conn: c, listener: l, source: source}, nil
+	}
+}
+
+// Banned reports whether a source IP is currently banned for opening connections too fast
+func (l *LimitListener) Banned(ip string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	until, ok := l.bans[ip]
+	return ok && time.Now().Before(until)
+}
+
+// Close stops the listener and wakes up any Accept calls blocked on our limits
+func (l *LimitListener) Close() error {
+	l.cancel()
+	return l.Listener.Close()
+}
+
+// Internal helper that counts a new connection against its source, if the source has room
+// and isn't banned. Sources going over their connection rate get banned
+func (l *LimitListener) admitSource(source string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.perSourceRate != nil {
+		now := time.Now()
+		l.sweepBans(now)
+		if until, ok := l.bans[source]; ok {
+			if now.Before(until) {
+				return false
+			}
+			delete(l.bans, source) // ban is over
+		}
+
+		if !l.perSourceRate.get(source).Allow() {
+			if l.banFor > 0 {
+				l.bans[source] = now.Add(l.banFor)
+			}
+			return false
+		}
+	}
+
+	if l.perSourceConns > 0 && l.sources[source] >= l.perSourceConns {
+		return false
+	}
+	l.sources[source]++
+	return true
+}
+
+// Internal helper that forgets expired bans from sources that never came back, at most once per ban length
+// Caller must hold the lock
+func (l *LimitListener) sweepBans(now time.Time) {
+	if now.Sub(l.swept) < l.banFor {
+		return
+	}
+	for source, until := range l.bans {
+		if !now.Before(until) {
+			delete(l.bans, source)
+		}
+	}
+	l.swept = now
+}
+
+// Internal helper that gives back a connection's slot and source count once it closes
+func (l *LimitListener) release(source string) {
+	l.mtx.Lock()
+	l.sources[source]--
+	if l.sources[source] <= 0 {
+		delete(l.sources, source) // don't keep around every IP we've ever seen
+	}
+	l.mtx.Unlock()
+
+	l.releaseSlot()
+}
+
+// Internal helper that frees up a global connection slot
+func (l *LimitListener) releaseSlot() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Internal helper that pulls the IP out of a connection's remote address
+func sourceIP(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// Connection handed out by LimitListener; gives its slot back when closed
+type limitedConn struct {
+	net.Conn
+	listener *LimitListener
+	source   string
+	once     sync.Once
+}
+
+// Close closes the connection and releases its limits. Safe to call more than once
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.listener.release(c.source)
+	})
+	return err
+}
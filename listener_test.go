@@ -0,0 +1,193 @@
+package ratelimiter
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// Internal test helper that starts a LimitListener on a random local port
+func newTestListener(t *testing.T, opts ...ListenerOption) *LimitListener {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLimitListener(inner, opts...)
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// Internal test helper that accepts in the background and hands the connections back on a channel
+func acceptInBackground(l net.Listener) <-chan net.Conn {
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- c
+		}
+	}()
+	return conns
+}
+
+// Internal test helper that dials the listener
+func dial(t *testing.T, l net.Listener) net.Conn {
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// TestLimitListener_MaxConns tests that Accept blocks once the connection limit is reached
+func TestLimitListener_MaxConns(t *testing.T) {
+	l := newTestListener(t, WithMaxConns(1))
+	conns := acceptInBackground(l)
+
+	dial(t, l)
+	first := <-conns
+
+	// Second connection can't be accepted while the first is open
+	dial(t, l)
+	select {
+	case <-conns:
+		t.Fatal("Expected second connection to wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Closing the first frees up its slot
+	first.Close()
+	select {
+	case <-conns:
+	case <-time.After(time.Second):
+		t.Fatal("Expected second connection to be accepted after the first closed")
+	}
+}
+
+// TestLimitListener_AcceptRate tests that new connections are paced by the accept rate
+func TestLimitListener_AcceptRate(t *testing.T) {
+	// 10 accepts per second with no burst, so 3 connections take ~200ms
+	l := newTestListener(t, WithAcceptRate(10, time.Second, 1))
+	conns := acceptInBackground(l)
+
+	start := time.Now()
+	for range 3 {
+		dial(t, l)
+	}
+	for range 3 {
+		<-conns
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected accepts to be paced, took %v", elapsed)
+	}
+}
+
+// TestLimitListener_PerSourceMaxConns tests that a single source can't hold more than its share open
+func TestLimitListener_PerSourceMaxConns(t *testing.T) {
+	l := newTestListener(t, WithPerSourceMaxConns(1))
+	conns := acceptInBackground(l)
+
+	dial(t, l)
+	first := <-conns
+
+	// Second connection from the same IP gets dropped, so the client sees it closed
+	second := dial(t, l)
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected connection over the per-source limit to be closed")
+	}
+
+	// Once the first closes, the source has room again
+	first.Close()
+	dial(t, l)
+	select {
+	case <-conns:
+	case <-time.After(time.Second):
+		t.Fatal("Expected connection to be accepted once the source had room")
+	}
+}
+
+// TestLimitListener_CloseUnblocksAccept tests that Close wakes up an Accept waiting on our limits
+func TestLimitListener_CloseUnblocksAccept(t *testing.T) {
+	l := newTestListener(t, WithAcceptRate(1, time.Hour, 1))
+	l.acceptRate.Allow() // use up the only token so Accept has to wait
+
+	errs := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		errs <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	l.Close()
+
+	select {
+	case err := <-errs:
+		if err != net.ErrClosed {
+			t.Errorf("Expected net.ErrClosed, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Accept to return after Close")
+	}
+}
+
+// TestLimitListener_PerSourceAcceptRateBans tests that a source opening connections too fast gets banned
+func TestLimitListener_PerSourceAcceptRateBans(t *testing.T) {
+	// 2 new connections per minute per source, then a 100ms ban
+	l := newTestListener(t, WithPerSourceAcceptRate(2, time.Minute, 2, 100*time.Millisecond))
+	conns := acceptInBackground(l)
+
+	dial(t, l)
+	dial(t, l)
+	<-conns
+	<-conns
+
+	// Third connection goes over the rate and gets the source banned
+	third := dial(t, l)
+	third.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := third.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected connection over the per-source rate to be closed")
+	}
+	if !l.Banned("127.0.0.1") {
+		t.Fatal("Expected source to be banned after going over its rate")
+	}
+
+	// Ban wears off after a while
+	time.Sleep(120 * time.Millisecond)
+	if l.Banned("127.0.0.1") {
+		t.Error("Expected ban to be over")
+	}
+}
+
+// TestLimitListener_SweepsExpiredBans tests that bans from sources that never come back are forgotten
+func TestLimitListener_SweepsExpiredBans(t *testing.T) {
+	l := newTestListener(t, WithPerSourceAcceptRate(1, time.Minute, 1, 50*time.Millisecond))
+
+	// Get a few sources banned, then never hear from them again
+	for _, source := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		l.admitSource(source)
+		if l.admitSource(source) {
+			t.Fatalf("Expected %s to go over its rate", source)
+		}
+	}
+	l.mtx.Lock()
+	if n := len(l.bans); n != 3 {
+		t.Errorf("Expected 3 bans, got %d", n)
+	}
+	l.mtx.Unlock()
+
+	// Once the bans are over, the next new connection from anyone clears them out
+	time.Sleep(60 * time.Millisecond)
+	l.admitSource("10.0.0.4")
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if n := len(l.bans); n != 0 {
+		t.Errorf("Expected expired bans to be swept, %d left", n)
+	}
+}
@@ -0,0 +1,61 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// MetricsSink receives counters and timings about limiter decisions, so they can be shipped off to
+// whatever metrics system is in use. Tags are "key:value" strings (e.g. "limiter:api", "key_class:ip")
+type MetricsSink interface {
+	Count(name string, value int64, tags []string)
+	Timing(name string, d time.Duration, tags []string)
+}
+
+// InstrumentedLimiter wraps a RateLimiter and reports every decision to a MetricsSink:
+// "ratelimiter.allowed" and "ratelimiter.denied" counters, plus a "ratelimiter.wait" timing for Wait
+type InstrumentedLimiter struct {
+	limiter RateLimiter
+	sink    MetricsSink
+	tags    []string // sent with every metric; always includes "limiter:<name>"
+}
+
+// InstrumentedLimiter constructor; every metric is tagged with "limiter:<name>" plus any extra tags
+func Instrument(limiter RateLimiter, sink MetricsSink, name string, tags ...string) *InstrumentedLimiter {
+	if limiter == nil || sink == nil {
+		panic("invalid instrumentation parameters")
+	}
+	return &InstrumentedLimiter{
+		limiter: limiter,
+		sink:    sink,
+		tags:    append([]string{"limiter:" + name}, tags...),
+	}
+}
+
+// Implements Allow RateLimiter method, counting the decision
+// NON-BLOCKING! Returns immediately
+func (il *InstrumentedLimiter) Allow() bool {
+	ok := il.limiter.Allow()
+	il.count(ok)
+	return ok
+}
+
+// Implements Wait RateLimiter method, counting the decision and timing how long it took.
+// A Wait that fails (e.g. the context ended) counts as denied
+// BLOCKING!! Blocks current goroutine
+func (il *InstrumentedLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := il.limiter.Wait(ctx)
+	il.sink.Timing("ratelimiter.wait", time.Since(start), il.tags)
+	il.count(err == nil)
+	return err
+}
+
+// Internal helper that counts an allowed or denied decision
+func (il *InstrumentedLimiter) count(allowed bool) {
+	if allowed {
+		il.sink.Count("ratelimiter.allowed", 1, il.tags)
+	} else {
+		il.sink.Count("ratelimiter.denied", 1, il.tags)
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake sink for testing; records counter totals
+type fakeSink struct {
+	mtx     sync.Mutex
+	counts  map[string]int64
+	timings int
+	tags    []string
+}
+
+func (s *fakeSink) Count(name string, value int64, tags []string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[string]int64)
+	}
+	s.counts[name] += value
+	s.tags = tags
+}
+
+func (s *fakeSink) Timing(name string, d time.Duration, tags []string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.timings++
+}
+
+// TestInstrument tests that decisions get counted and waits get timed
+func TestInstrument(t *testing.T) {
+	sink := &fakeSink{}
+	il := Instrument(NewTokenBucket(1, time.Hour, 2), sink, "api", "key_class:ip")
+
+	il.Allow()
+	il.Allow()
+	il.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	il.Wait(ctx)
+
+	if sink.counts["ratelimiter.allowed"] != 2 || sink.counts["ratelimiter.denied"] != 2 {
+		t.Errorf("Expected 2 allowed and 2 denied, got %v", sink.counts)
+	}
+	if sink.timings != 1 {
+		t.Errorf("Expected 1 wait timing, got %d", sink.timings)
+	}
+	if len(sink.tags) != 2 || sink.tags[0] != "limiter:api" || sink.tags[1] != "key_class:ip" {
+		t.Errorf("Expected limiter and key class tags, got %v", sink.tags)
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Window is one limit in a MultiWindowLimiter: at most MaxOps per Per
+type Window struct {
+	MaxOps int
+	Per    time.Duration
+}
+
+// MultiWindowLimiter enforces several windows at once, like the "10 per second AND 300 per minute AND
+// 5000 per day" contracts most APIs actually have. A request only gets through if every window has
+// room for it, and then counts against all of them
+type MultiWindowLimiter struct {
+	windows []*TokenBucket // one bucket per window, each holding up to its window's MaxOps
+	costs   []float64      // 1 per window, what each request takes from the windows
+}
+
+// MultiWindowLimiter constructor; e.g. NewMultiWindowLimiter(Window{10, time.Second}, Window{300, time.Minute})
+func NewMultiWindowLimiter(windows ...Window) *MultiWindowLimiter {
+	if len(windows) == 0 {
+		panic("invalid multi window parameters")
+	}
+
+	ml := &MultiWindowLimiter{}
+	for _, w := range windows {
+		ml.windows = append(ml.windows, NewTokenBucket(w.MaxOps, w.Per, w.MaxOps))
+		ml.costs = append(ml.costs, 1)
+	}
+	return ml
+}
+
+// Implements Allow RateLimiter method; only allows the request if every window has room
+// NON-BLOCKING! Returns immediately
+func (ml *MultiWindowLimiter) Allow() bool {
+	return tryTakeMulti(ml.windows, ml.costs).ok
+}
+
+// Implements Wait RateLimiter method; blocks until every window has room, waiting on whichever binds
+// BLOCKING!! Blocks current goroutine
+func (ml *MultiWindowLimiter) Wait(ctx context.Context) error {
+	return waitMulti(ctx, func() takeResult {
+		return tryTakeMulti(ml.windows, ml.costs)
+	})
+}
+
+// Status returns how many more requests would get through right now (the least any window has left),
+// and how long until that window is back to its full allowance; suitable for RateLimit-Remaining and
+// RateLimit-Reset style headers
+func (ml *MultiWindowLimiter) Status() (remaining int, reset time.Duration) {
+	remaining = math.MaxInt
+	for _, tb := range ml.windows {
+		tb.mtx.Lock()
+		tb.refillBucket()
+		tokens := tb.tokens
+		full := time.Duration((tb.max_tokens - tb.tokens) / tb.rate * float64(time.Second))
+		tb.mtx.Unlock()
+
+		left := int(math.Floor(max(tokens, 0)))
+		if left > remaining {
+			continue
+		}
+
+		// The tightest window decides; on a tie, report the later reset
+		if left < remaining || full > reset {
+			reset = full
+		}
+		remaining = left
+	}
+	return remaining, reset
+}
@@ -0,0 +1,78 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestMultiWindowLimiter_TightestWins tests that whichever window runs out first binds
+func TestMultiWindowLimiter_TightestWins(t *testing.T) {
+	ml := NewMultiWindowLimiter(Window{10, time.Second}, Window{3, time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if !ml.Allow() {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	if ml.Allow() {
+		t.Error("Expected the hourly window to deny the 4th request")
+	}
+}
+
+// TestMultiWindowLimiter_Atomic tests that a denied request doesn't count against any window
+func TestMultiWindowLimiter_Atomic(t *testing.T) {
+	ml := NewMultiWindowLimiter(Window{1, time.Hour}, Window{5, time.Hour})
+
+	ml.Allow()
+	ml.Allow() // denied by the first window
+
+	if remaining := ml.windows[1].tokens; remaining < 4 || remaining > 4.01 {
+		t.Errorf("Expected the second window to only be charged once, has %v left", remaining)
+	}
+}
+
+// TestMultiWindowLimiter_Wait tests that Wait waits on the binding window
+func TestMultiWindowLimiter_Wait(t *testing.T) {
+	ml := NewMultiWindowLimiter(Window{100, time.Second}, Window{10, time.Second})
+	for ml.Allow() {
+	}
+
+	start := time.Now()
+	if err := ml.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 10/s window binds, so ~100ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected to wait on the slower window, took %v", elapsed)
+	}
+}
+
+// TestMultiWindowLimiter_Status tests the merged remaining/reset reporting
+func TestMultiWindowLimiter_Status(t *testing.T) {
+	ml := NewMultiWindowLimiter(Window{10, time.Second}, Window{5, time.Minute})
+	ml.Allow()
+	ml.Allow()
+
+	remaining, reset := ml.Status()
+	if remaining != 3 {
+		t.Errorf("Expected 3 remaining (from the per minute window), got %d", remaining)
+	}
+	// 2 of 5 per minute used, so 24s until it's full again
+	if reset < 23*time.Second || reset > 24*time.Second {
+		t.Errorf("Expected reset of ~24s, got %v", reset)
+	}
+}
+
+// TestMultiWindowLimiter_DelayBudget tests that Wait gives up rather than go over the delay budget
+func TestMultiWindowLimiter_DelayBudget(t *testing.T) {
+	ml := NewMultiWindowLimiter(Window{1, time.Second}, Window{100, time.Minute})
+	ml.Allow()
+
+	ctx := WithDelayBudget(context.Background(), 50*time.Millisecond)
+	if err := ml.Wait(ctx); !errors.Is(err, ErrDelayBudgetExceeded) {
+		t.Errorf("Expected ErrDelayBudgetExceeded, got: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+)
+
+// Override lets upstream code change how the limiting middleware treats one request, e.g. to let a
+// trusted internal retry or an admin action through. Put it in the request context with WithOverride;
+// LimitRetries, LimitGraphQL and SoftLimit honor it
+type Override struct {
+	Bypass         bool    // skip the limits entirely
+	CostMultiplier float64 // multiply what the request costs (0.5 for half price); 0 means unchanged
+	Reason         string  // why the override was given, for the audit trail
+}
+
+// Context key type, unexported so nobody else can collide with it
+type overrideKey struct{}
+
+// WithOverride returns a copy of ctx carrying the override
+func WithOverride(ctx context.Context, o Override) context.Context {
+	return context.WithValue(ctx, overrideKey{}, o)
+}
+
+// OverrideFromContext returns the override placed with WithOverride, if any
+func OverrideFromContext(ctx context.Context) (Override, bool) {
+	o, ok := ctx.Value(overrideKey{}).(Override)
+	return o, ok
+}
+
+// AuditOverrides is middleware that calls audit for every request carrying an override, so every use
+// of one gets recorded. Put it right in front of the limiting middleware, after whatever sets overrides
+func AuditOverrides(next http.Handler, audit func(r *http.Request, o Override)) http.Handler {
+	if audit == nil {
+		panic("invalid override audit parameters")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if o, ok := OverrideFromContext(r.Context()); ok {
+			audit(r, o)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Internal helper that applies a request's override (if any) to its cost.
+// Returns false if the request should bypass the limits altogether
+func overrideCost(r *http.Request, cost float64) (float64, bool) {
+	o, ok := OverrideFromContext(r.Context())
+	switch {
+	case !ok:
+		return cost, true
+	case o.Bypass:
+		return 0, false
+	case o.CostMultiplier > 0:
+		return cost * o.CostMultiplier, true
+	}
+	return cost, true
+}
@@ -0,0 +1,75 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper that runs a request with an optional override through the handler and returns the status code
+func serveWithOverride(handler http.Handler, req *http.Request, o *Override) int {
+	if o != nil {
+		req = req.WithContext(WithOverride(req.Context(), *o))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// TestOverride_Bypass tests that a bypass override skips the limits and gets audited
+func TestOverride_Bypass(t *testing.T) {
+	var audited []string
+	limited := LimitRetries(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), RetryHeader("X-Retry"), 1, time.Hour, nil)
+	handler := AuditOverrides(limited, func(r *http.Request, o Override) { audited = append(audited, o.Reason) })
+
+	retry := func() *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Retry", "1")
+		return req
+	}
+
+	serveWithOverride(handler, retry(), nil) // uses up the retry budget
+	if code := serveWithOverride(handler, retry(), nil); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected retry over budget to be rejected, got %d", code)
+	}
+
+	if code := serveWithOverride(handler, retry(), &Override{Bypass: true, Reason: "internal"}); code != http.StatusOK {
+		t.Errorf("Expected bypass to get through, got %d", code)
+	}
+	if len(audited) != 1 || audited[0] != "internal" {
+		t.Errorf("Expected the override to be audited once, got %v", audited)
+	}
+}
+
+// TestOverride_CostMultiplier tests that a multiplier scales what a request costs
+func TestOverride_CostMultiplier(t *testing.T) {
+	handler := LimitGraphQL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), braceComplexity, 4, time.Hour, nil)
+	query := func() *http.Request {
+		return httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ a { b } }"}`))
+	}
+
+	// Costs 2, doubled to 4, which uses up the whole budget
+	if code := serveWithOverride(handler, query(), &Override{CostMultiplier: 2}); code != http.StatusOK {
+		t.Fatalf("Expected doubled query to fit the budget, got %d", code)
+	}
+	if code := serveWithOverride(handler, query(), nil); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the budget to be used up, got %d", code)
+	}
+
+	// Half price still doesn't fit in an empty budget, but it's not rejected as too large either
+	if code := serveWithOverride(handler, query(), &Override{CostMultiplier: 0.5}); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429, got %d", code)
+	}
+}
+
+// TestOverride_SoftLimit tests that SoftLimit honors a bypass
+func TestOverride_SoftLimit(t *testing.T) {
+	handler := SoftLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 1, 1, time.Hour, nil, nil)
+
+	serveWithOverride(handler, httptest.NewRequest("GET", "/", nil), nil)
+	if code := serveWithOverride(handler, httptest.NewRequest("GET", "/", nil), &Override{Bypass: true}); code != http.StatusOK {
+		t.Errorf("Expected bypass to get through, got %d", code)
+	}
+}
@@ -0,0 +1,129 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QuotaPeriod is the calendar period a QuotaLimiter's quota resets on
+type QuotaPeriod int
+
+const (
+	QuotaDaily   QuotaPeriod = iota // resets at midnight
+	QuotaWeekly                     // resets at midnight going into Monday
+	QuotaMonthly                    // resets at midnight going into the 1st of the month
+)
+
+// QuotaLimiter allows a fixed number of requests per calendar day, week or month, resetting at
+// wall-clock boundaries in a given time zone, the way many SaaS APIs meter usage. Boundaries are
+// worked out on the calendar, so days that are 23 or 25 hours long around DST changes are handled
+type QuotaLimiter struct {
+	mtx      sync.Mutex
+	quota    int            // requests allowed per period
+	period   QuotaPeriod    // calendar period the quota resets on
+	loc      *time.Location // time zone the boundaries are in
+	used     int            // requests let through in the current period
+	resetsAt time.Time      // start of the next period
+}
+
+// QuotaLimiter constructor; allows quota requests per period, with periods starting at midnight in loc
+// (time.UTC if nil)
+func NewQuotaLimiter(quota int, period QuotaPeriod, loc *time.Location) *QuotaLimiter {
+	if quota <= 0 || period < QuotaDaily || period > QuotaMonthly {
+		panic("invalid quota limiter parameters")
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	ql := &QuotaLimiter{quota: quota, period: period, loc: loc}
+	ql.resetsAt = ql.nextBoundary(time.Now())
+	return ql
+}
+
+// Implements Allow RateLimiter method; allows the request if the quota for the current period isn't used up
+// NON-BLOCKING! Returns immediately
+func (ql *QuotaLimiter) Allow() bool {
+	ql.mtx.Lock()
+	defer ql.mtx.Unlock()
+
+	ql.advance(time.Now())
+	if ql.used >= ql.quota {
+		return false
+	}
+	ql.used++
+	return true
+}
+
+// Implements Wait RateLimiter method; once the quota is used up, blocks until the next period starts
+// (which may be days away, so pass a context with a deadline if that's not acceptable)
+// BLOCKING!! Blocks current goroutine
+func (ql *QuotaLimiter) Wait(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	for {
+		ql.mtx.Lock()
+		now := time.Now()
+		ql.advance(now)
+		if ql.used < ql.quota {
+			ql.used++
+			ql.mtx.Unlock()
+			return nil
+		}
+		waitDuration := ql.resetsAt.Sub(now)
+		ql.mtx.Unlock()
+
+		select {
+		case <-time.After(waitDuration):
+			continue
+		case <-ctx.Done():
+			return waitError(ctx)
+		}
+	}
+}
+
+// Remaining returns how many requests are left in the current period
+func (ql *QuotaLimiter) Remaining() int {
+	ql.mtx.Lock()
+	defer ql.mtx.Unlock()
+
+	ql.advance(time.Now())
+	return ql.quota - ql.used
+}
+
+// ResetsAt returns when the current period ends and the quota resets
+func (ql *QuotaLimiter) ResetsAt() time.Time {
+	ql.mtx.Lock()
+	defer ql.mtx.Unlock()
+
+	ql.advance(time.Now())
+	return ql.resetsAt
+}
+
+// Internal helper that starts a fresh period once the current one has ended
+// Caller must hold the lock
+func (ql *QuotaLimiter) advance(now time.Time) {
+	if !now.Before(ql.resetsAt) {
+		ql.used = 0
+		ql.resetsAt = ql.nextBoundary(now)
+	}
+}
+
+// Internal helper that returns the start of the period after the one t is in
+func (ql *QuotaLimiter) nextBoundary(t time.Time) time.Time {
+	t = t.In(ql.loc)
+	year, month, day := t.Date()
+
+	switch ql.period {
+	case QuotaWeekly:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday+7, 0, 0, 0, 0, ql.loc)
+	case QuotaMonthly:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, ql.loc)
+	default:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, ql.loc)
+	}
+}
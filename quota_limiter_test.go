@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestQuotaLimiter_Quota tests that only quota requests get through per period
+func TestQuotaLimiter_Quota(t *testing.T) {
+	ql := NewQuotaLimiter(3, QuotaDaily, nil)
+
+	for i := 0; i < 3; i++ {
+		if !ql.Allow() {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	if ql.Allow() {
+		t.Error("Expected 4th request to be denied")
+	}
+	if remaining := ql.Remaining(); remaining != 0 {
+		t.Errorf("Expected 0 remaining, got %d", remaining)
+	}
+}
+
+// TestQuotaLimiter_Boundaries tests where each period resets, including across a DST change
+func TestQuotaLimiter_Boundaries(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	// Saturday 2024-03-09 15:00 in New York; DST starts the next morning
+	now := time.Date(2024, 3, 9, 15, 0, 0, 0, ny)
+
+	tests := []struct {
+		period QuotaPeriod
+		want   time.Time
+	}{
+		{QuotaDaily, time.Date(2024, 3, 10, 0, 0, 0, 0, ny)},
+		{QuotaWeekly, time.Date(2024, 3, 11, 0, 0, 0, 0, ny)},
+		{QuotaMonthly, time.Date(2024, 4, 1, 0, 0, 0, 0, ny)},
+	}
+	for _, tt := range tests {
+		ql := NewQuotaLimiter(1, tt.period, ny)
+		if got := ql.nextBoundary(now); !got.Equal(tt.want) {
+			t.Errorf("Period %d: expected reset at %v, got %v", tt.period, tt.want, got)
+		}
+	}
+
+	// The day DST starts is only 23 hours long
+	ql := NewQuotaLimiter(1, QuotaDaily, ny)
+	start := time.Date(2024, 3, 10, 0, 0, 0, 0, ny)
+	if got := ql.nextBoundary(start).Sub(start); got != 23*time.Hour {
+		t.Errorf("Expected a 23 hour day, got %v", got)
+	}
+}
+
+// TestQuotaLimiter_Resets tests that the quota comes back once the period is over
+func TestQuotaLimiter_Resets(t *testing.T) {
+	ql := NewQuotaLimiter(1, QuotaDaily, nil)
+	ql.Allow()
+
+	ql.resetsAt = time.Now() // pretend midnight just passed
+	if !ql.Allow() {
+		t.Error("Expected the quota to reset in the new period")
+	}
+	if resetsAt := ql.ResetsAt(); !resetsAt.After(time.Now()) || !resetsAt.Equal(resetsAt.Truncate(24*time.Hour)) {
+		t.Errorf("Expected the next reset to be at the following midnight UTC, got %v", resetsAt)
+	}
+}
+
+// TestQuotaLimiter_Wait tests that Wait blocks until the period resets
+func TestQuotaLimiter_Wait(t *testing.T) {
+	ql := NewQuotaLimiter(1, QuotaMonthly, nil)
+	ql.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ql.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Number of slots a RateEstimator splits its window into; the window slides one slot at a time
+const estimatorSlots = 10
+
+// RateEstimate is a snapshot of a key's measured request rate
+type RateEstimate struct {
+	EWMA   float64 // exponentially weighted moving average of the rate, per second
+	Window float64 // rate over the sliding window, per second
+	Trend  float64 // newer half of the window's rate minus the older half's, per second; positive means rising
+}
+
+// RateEstimator measures the request rate per key, both as an exponentially weighted moving average
+// (smooth, reacts gradually) and as a count over a sliding window (exact, reacts in steps), along with
+// a short term trend. It's a building block for adaptive limiters and dashboards, so each of them
+// doesn't have to measure rates on its own
+type RateEstimator struct {
+	mtx       sync.Mutex
+	tau       float64               // EWMA time constant, in seconds
+	window    time.Duration         // sliding window length
+	keys      map[string]*rateState // per key measurements
+	lastPrune time.Time             // last time we swept for idle keys
+}
+
+// Measurements for one key
+type rateState struct {
+	ewma      float64                 // EWMA rate as of lastEvent
+	lastEvent time.Time               // when ewma was last updated
+	slots     [estimatorSlots]float64 // counts per slot, oldest first ending with the current slot
+	slotStart time.Time               // start of the current slot
+}
+
+// RateEstimator constructor; halfLife is how long it takes the EWMA to forget half of what it saw,
+// and window is the length of the sliding window
+func NewRateEstimator(halfLife time.Duration, window time.Duration) *RateEstimator {
+	if halfLife <= 0 || window < estimatorSlots {
+		panic("invalid rate estimator parameters")
+	}
+	return &RateEstimator{
+		tau:       halfLife.Seconds() / math.Ln2,
+		window:    window,
+		keys:      make(map[string]*rateState),
+		lastPrune: time.Now(),
+	}
+}
+
+// Add records n events for key
+func (re *RateEstimator) Add(key string, n float64) {
+	re.mtx.Lock()
+	defer re.mtx.Unlock()
+
+	now := time.Now()
+	re.prune(now)
+
+	state, ok := re.keys[key]
+	if !ok {
+		state = &rateState{lastEvent: now, slotStart: now}
+		re.keys[key] = state
+	}
+
+	state.ewma = state.ewma*math.Exp(-now.Sub(state.lastEvent).Seconds()/re.tau) + n/re.tau
+	state.lastEvent = now
+
+	re.slide(state, now)
+	state.slots[estimatorSlots-1] += n
+}
+
+// Estimate returns the current measurements for key (all zero for a key we haven't seen lately)
+func (re *RateEstimator) Estimate(key string) RateEstimate {
+	re.mtx.Lock()
+	defer re.mtx.Unlock()
+
+	state, ok := re.keys[key]
+	if !ok {
+		return RateEstimate{}
+	}
+	return re.estimate(state, time.Now())
+}
+
+// Snapshot returns the current measurements for every key seen lately
+func (re *RateEstimator) Snapshot() map[string]RateEstimate {
+	re.mtx.Lock()
+	defer re.mtx.Unlock()
+
+	now := time.Now()
+	snapshot := make(map[string]RateEstimate, len(re.keys))
+	for key, state := range re.keys {
+		snapshot[key] = re.estimate(state, now)
+	}
+	return snapshot
+}
+
+// Internal helper that works out a key's measurements as of now
+// Caller must hold the lock
+func (re *RateEstimator) estimate(state *rateState, now time.Time) RateEstimate {
+	re.slide(state, now)
+
+	var older, newer float64
+	for i, count := range state.slots {
+		if i < estimatorSlots/2 {
+			older += count
+		} else {
+			newer += count
+		}
+	}
+	half := re.window.Seconds() / 2
+
+	return RateEstimate{
+		EWMA:   state.ewma * math.Exp(-now.Sub(state.lastEvent).Seconds()/re.tau),
+		Window: (older + newer) / re.window.Seconds(),
+		Trend:  (newer - older) / half,
+	}
+}
+
+// Internal helper that moves a key's window forward to now, dropping slots that fell out of it
+// Caller must hold the lock
+func (re *RateEstimator) slide(state *rateState, now time.Time) {
+	slot := re.window / estimatorSlots
+	passed := int(now.Sub(state.slotStart) / slot)
+	if passed <= 0 {
+		return
+	}
+
+	shift := min(passed, estimatorSlots)
+	copy(state.slots[:], state.slots[shift:])
+	clear(state.slots[estimatorSlots-shift:])
+	state.slotStart = state.slotStart.Add(time.Duration(passed) * slot)
+}
+
+// Drops keys with nothing left in their window. Only sweeps once per window so we don't walk the
+// whole map on every event
+// Caller must hold the lock
+func (re *RateEstimator) prune(now time.Time) {
+	if now.Sub(re.lastPrune) < re.window {
+		return
+	}
+	for key, state := range re.keys {
+		if now.Sub(state.lastEvent) >= re.window {
+			delete(re.keys, key)
+		}
+	}
+	re.lastPrune = now
+}
@@ -0,0 +1,67 @@
+package ratelimiter
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestRateEstimator_Window tests the sliding window rate and trend
+func TestRateEstimator_Window(t *testing.T) {
+	re := NewRateEstimator(time.Second, 200*time.Millisecond)
+
+	// 10 events in the older half of the window, 30 in the newer half
+	re.Add("a", 10)
+	time.Sleep(110 * time.Millisecond)
+	re.Add("a", 30)
+
+	est := re.Estimate("a")
+	if math.Abs(est.Window-200) > 1 {
+		t.Errorf("Expected window rate of 200/s, got %v", est.Window)
+	}
+	if est.Trend <= 0 {
+		t.Errorf("Expected a rising trend, got %v", est.Trend)
+	}
+
+	// Once the window has passed, nothing is left in it
+	time.Sleep(210 * time.Millisecond)
+	if est := re.Estimate("a"); est.Window != 0 {
+		t.Errorf("Expected empty window, got %v", est.Window)
+	}
+}
+
+// TestRateEstimator_EWMA tests that the EWMA tracks a steady rate and decays when it stops
+func TestRateEstimator_EWMA(t *testing.T) {
+	re := NewRateEstimator(50*time.Millisecond, time.Second)
+
+	// ~200 events per second for a few half lives
+	for i := 0; i < 40; i++ {
+		re.Add("a", 1)
+		time.Sleep(5 * time.Millisecond)
+	}
+	steady := re.Estimate("a").EWMA
+	if steady < 100 || steady > 220 {
+		t.Errorf("Expected EWMA near 200/s (less any sleep overshoot), got %v", steady)
+	}
+
+	// Two half lives later it should be down to about a quarter
+	time.Sleep(100 * time.Millisecond)
+	if decayed := re.Estimate("a").EWMA; decayed > steady/3 {
+		t.Errorf("Expected EWMA to decay to ~%v, got %v", steady/4, decayed)
+	}
+}
+
+// TestRateEstimator_Snapshot tests that every key shows up in a snapshot
+func TestRateEstimator_Snapshot(t *testing.T) {
+	re := NewRateEstimator(time.Second, time.Second)
+	re.Add("a", 1)
+	re.Add("b", 2)
+
+	snapshot := re.Snapshot()
+	if len(snapshot) != 2 || snapshot["b"].Window != 2 {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+	if est := re.Estimate("unknown"); est != (RateEstimate{}) {
+		t.Errorf("Expected zero estimate for an unknown key, got %+v", est)
+	}
+}
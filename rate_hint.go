@@ -0,0 +1,159 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateHintHeader is the response header a server uses to suggest how fast a client should send
+// requests, as "<maxOps>;w=<seconds>" (e.g. "100;w=60" for 100 requests per minute)
+const RateHintHeader = "Rate-Hint"
+
+// SuggestRate is middleware that attaches a Rate-Hint header suggesting maxOps requests per `per`
+// to every response, so well behaved clients (like ThrottledTransport) can slow themselves down
+// before they start getting 429s. Nothing is enforced; pair it with a real limit for that
+func SuggestRate(next http.Handler, maxOps int, per time.Duration) http.Handler {
+	if maxOps <= 0 || per < time.Second {
+		panic("invalid rate hint parameters")
+	}
+
+	hint := fmt.Sprintf("%d;w=%d", maxOps, int(per/time.Second))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RateHintHeader, hint)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ThrottledTransport is an http.RoundTripper that paces outgoing requests through a local limiter, and
+// adopts the rate servers suggest with the Rate-Hint header. A hint can slow the client down or speed
+// it back up, but never past the rate the transport was created with.
+// Upstream hosts can also get limits of their own with WithHostRate, so one shared transport can
+// respect the contracts of many third party APIs at once
+type ThrottledTransport struct {
+	base    http.RoundTripper
+	tb      *TokenBucket
+	maxRate float64     // the configured rate, per second; hints can't take us above it
+	hosts   []hostLimit // per upstream limits, checked in the order they were added
+}
+
+// A limit for upstream hosts matching a pattern
+type hostLimit struct {
+	pattern string       // exact host ("api.github.com") or wildcard ("*.googleapis.com")
+	tb      *TokenBucket // shared by every host matching the pattern
+}
+
+// TransportOption configures a ThrottledTransport at construction time
+type TransportOption func(*ThrottledTransport)
+
+// WithHostRate limits requests to hosts matching pattern to maxOps per `per` (with bursts up to burst),
+// on top of the transport's overall limit. The pattern is either an exact host ("api.github.com", which
+// matches on any port, or "api.github.com:8443" for just that port) or "*." followed by a domain
+// ("*.googleapis.com"), which matches any subdomain of it. Every host
+// matching the pattern shares the one limit, since that's usually how API contracts are written.
+// If several patterns match a host, the first one added wins. Hosts are compared in lowercase without
+// a trailing dot or the scheme's default port, and are always the upstream host from the request URL,
+// never the HTTP or SOCKS proxy the request might go through
+func WithHostRate(pattern string, maxOps int, per time.Duration, burst int) TransportOption {
+	tb := NewTokenBucket(maxOps, per, burst)
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+
+	return func(t *ThrottledTransport) {
+		t.hosts = append(t.hosts, hostLimit{pattern: pattern, tb: tb})
+	}
+}
+
+// ThrottledTransport constructor; a nil base means http.DefaultTransport
+func NewThrottledTransport(base http.RoundTripper, maxOps int, per time.Duration, burst int, opts ...TransportOption) *ThrottledTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	tb := NewTokenBucket(maxOps, per, burst)
+
+	t := &ThrottledTransport{base: base, tb: tb, maxRate: tb.rate}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// RoundTrip waits on the limiters, sends the request, and picks up any rate hint from the response
+// BLOCKING!! Blocks current goroutine
+func (t *ThrottledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.tb.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if host := t.hostLimit(req.URL); host != nil {
+		if err := host.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rate, ok := parseRateHint(resp.Header.Get(RateHintHeader)); ok {
+		t.tb.setRate(min(rate, t.maxRate), t.tb.capacity())
+	}
+	return resp, nil
+}
+
+// Internal helper that returns the limit for a request's upstream host, or nil if it doesn't have one
+func (t *ThrottledTransport) hostLimit(u *url.URL) *TokenBucket {
+	hostPort := normalizeHost(u)
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = hostPort // default port, so there's no port to split off
+	}
+
+	for _, limit := range t.hosts {
+		if domain, ok := strings.CutPrefix(limit.pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return limit.tb
+			}
+		} else if limit.pattern == host || limit.pattern == hostPort {
+			return limit.tb
+		}
+	}
+	return nil
+}
+
+// Internal helper that normalizes a URL's host for matching: lowercase, no trailing dot, and no port
+// if it's the scheme's default one
+func normalizeHost(u *url.URL) string {
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if port == "" || (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Internal helper that parses a Rate-Hint header into a rate per second
+func parseRateHint(hint string) (float64, bool) {
+	if hint == "" {
+		return 0, false
+	}
+
+	ops, window, found := strings.Cut(hint, ";")
+	maxOps, err := strconv.Atoi(strings.TrimSpace(ops))
+	if err != nil || maxOps <= 0 {
+		return 0, false
+	}
+
+	seconds := 1
+	if found {
+		w, ok := strings.CutPrefix(strings.TrimSpace(window), "w=")
+		if seconds, err = strconv.Atoi(w); !ok || err != nil || seconds <= 0 {
+			return 0, false
+		}
+	}
+	return float64(maxOps) / float64(seconds), true
+}
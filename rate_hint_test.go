@@ -0,0 +1,116 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestThrottledTransport_AdoptsHint tests that the client slows down to the rate the server suggests
+func TestThrottledTransport_AdoptsHint(t *testing.T) {
+	srv := httptest.NewServer(SuggestRate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 10, time.Second))
+	defer srv.Close()
+
+	transport := NewThrottledTransport(nil, 1000, time.Second, 1)
+	client := &http.Client{Transport: transport}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// First request goes out at 1000/s and picks up the hint (the token it earned meanwhile lets the
+	// second go right away), the last 2 go at 10/s
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected the client to slow down to the hinted rate, took %v", elapsed)
+	}
+}
+
+// TestThrottledTransport_HintCapped tests that a hint can't speed the client up past its own rate
+func TestThrottledTransport_HintCapped(t *testing.T) {
+	srv := httptest.NewServer(SuggestRate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 1000, time.Second))
+	defer srv.Close()
+
+	transport := NewThrottledTransport(nil, 1, time.Second, 1)
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if transport.tb.rate != 1 {
+		t.Errorf("Expected rate to stay at 1/s, got %v", transport.tb.rate)
+	}
+}
+
+// TestParseRateHint tests parsing of the hint header
+func TestParseRateHint(t *testing.T) {
+	tests := map[string]float64{"100;w=60": 100.0 / 60, "5": 5, " 20 ; w=2 ": 10}
+	for hint, want := range tests {
+		if got, ok := parseRateHint(hint); !ok || got != want {
+			t.Errorf("parseRateHint(%q) = %v, %v, expected %v", hint, got, ok, want)
+		}
+	}
+
+	for _, hint := range []string{"", "abc", "0", "10;w=0", "10;x=5"} {
+		if _, ok := parseRateHint(hint); ok {
+			t.Errorf("Expected parseRateHint(%q) to fail", hint)
+		}
+	}
+}
+
+// TestThrottledTransport_HostRate tests that hosts matching a pattern share their own limit
+func TestThrottledTransport_HostRate(t *testing.T) {
+	transport := NewThrottledTransport(nil, 1000, time.Second, 100,
+		WithHostRate("*.googleapis.com", 1, time.Hour, 1),
+		WithHostRate("api.github.com", 1, time.Hour, 2),
+	)
+
+	tests := []struct {
+		url  string
+		want *TokenBucket
+	}{
+		{"https://storage.googleapis.com/b", transport.hosts[0].tb},
+		{"https://Maps.GoogleAPIs.com.:443/x", transport.hosts[0].tb},
+		{"https://googleapis.com/", nil},
+		{"https://api.github.com/repos", transport.hosts[1].tb},
+		{"https://api.github.com:8443/repos", transport.hosts[1].tb},
+		{"https://example.com/", nil},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := transport.hostLimit(u); got != tt.want {
+			t.Errorf("%s: got the wrong limit", tt.url)
+		}
+	}
+}
+
+// TestThrottledTransport_HostRateEnforced tests that a host's own limit holds requests back
+func TestThrottledTransport_HostRateEnforced(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	client := &http.Client{Transport: NewThrottledTransport(nil, 1000, time.Second, 100, WithHostRate(u.Hostname(), 1, time.Hour, 1))}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the host limit to hold the request back, got: %v", err)
+	}
+}
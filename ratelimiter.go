@@ -1,6 +1,10 @@
 package ratelimiter
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 // RateLimiter interface; all algorithms must implement this.
 type RateLimiter interface {
@@ -11,3 +15,54 @@ type RateLimiter interface {
 	// Blocks until allowed or context cancelled
 	Wait(ctx context.Context) error
 }
+
+// ErrWaitCancelled is returned by Wait when its context was cancelled before the request was allowed.
+// The context's error is wrapped too, so errors.Is(err, context.Canceled) still works
+var ErrWaitCancelled = errors.New("ratelimiter: wait cancelled")
+
+// ErrWaitDeadline is returned by Wait when its context's deadline passed before the request was allowed.
+// The context's error is wrapped too, so errors.Is(err, context.DeadlineExceeded) still works
+var ErrWaitDeadline = errors.New("ratelimiter: wait deadline exceeded")
+
+// ErrBurstExceeded is returned when a request costs more than a limiter could ever hold,
+// meaning it would wait forever
+var ErrBurstExceeded = errors.New("ratelimiter: cost exceeds limiter capacity")
+
+// ErrUnknownReservation is returned when committing a reservation that doesn't exist
+// or has already been committed
+var ErrUnknownReservation = errors.New("ratelimiter: unknown reservation")
+
+// ErrWouldExceedDeadline is returned by Wait when the deadline check is enabled and the request
+// would not be served before the context's deadline
+var ErrWouldExceedDeadline = errors.New("ratelimiter: would not be served before deadline")
+
+// ErrWaitShed is returned by Wait when queue management decided to shed the waiter
+// because the queue has been overloaded for too long
+var ErrWaitShed = errors.New("ratelimiter: wait shed by queue management")
+
+// ErrRateLimited is returned when a request is denied and there's nothing else to fall back on
+var ErrRateLimited = errors.New("ratelimiter: rate limited")
+
+// ErrPaused is returned by Wait when the limiter is paused and isn't set up to queue while paused
+var ErrPaused = errors.New("ratelimiter: limiter paused")
+
+// ErrQueueFull is returned by Wait when the limiter's wait queue is already full
+var ErrQueueFull = errors.New("ratelimiter: wait queue full")
+
+// ErrClosed is returned by Wait once the limiter has been closed
+var ErrClosed = errors.New("ratelimiter: limiter closed")
+
+// Internal helper that builds the error Wait returns once its context is done, wrapping both our
+// sentinel and the context's error (plus its cause, if one was given with context.WithCancelCause)
+func waitError(ctx context.Context) error {
+	err := ctx.Err()
+	sentinel := ErrWaitCancelled
+	if errors.Is(err, context.DeadlineExceeded) {
+		sentinel = ErrWaitDeadline
+	}
+
+	if cause := context.Cause(ctx); cause != nil && cause != err {
+		return fmt.Errorf("%w: %w: %w", sentinel, err, cause)
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
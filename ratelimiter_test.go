@@ -2,7 +2,28 @@ package ratelimiter
 
 import "testing"
 
-// Test to verify that TokenBucket implements RateLimiter interface
+// Test to verify that our limiters implement RateLimiter interface
 func TestRateLimiterInterface(t *testing.T) {
 	var _ RateLimiter = (*TokenBucket)(nil)
+	var _ RateLimiter = (*Blackout)(nil)
+	var _ RateLimiter = (*DualLimiter)(nil)
+	var _ RateLimiter = (*DeadlinePacer)(nil)
+	var _ RateLimiter = (*InstrumentedLimiter)(nil)
+	var _ RateLimiter = (*Swappable)(nil)
+	var _ RateLimiter = (*FallbackLimiter)(nil)
+	var _ RateLimiter = (*LatencyTargetLimiter)(nil)
+	var _ RateLimiter = (*ErrorBudgetLimiter)(nil)
+	var _ RateLimiter = (*SoftLimiter)(nil)
+	var _ RateLimiter = (*MultiWindowLimiter)(nil)
+	var _ RateLimiter = (*LeakyBucket)(nil)
+	var _ RateLimiter = (*FixedWindow)(nil)
+	var _ RateLimiter = (*SlidingWindowCounter)(nil)
+	var _ RateLimiter = (*GCRA)(nil)
+	var _ RateLimiter = (*ConcurrencyLimiter)(nil)
+	var _ RateLimiter = (*AIMDLimiter)(nil)
+	var _ RateLimiter = (*ChildBucket)(nil)
+	var _ RateLimiter = (*FairClass)(nil)
+	var _ RateLimiter = (*TwoRatePolicer)(nil)
+	var _ RateLimiter = (*QuotaLimiter)(nil)
+	var _ RateLimiter = (*RelayLimiter)(nil)
 }
@@ -0,0 +1,242 @@
+// Package ratelimitertest checks RateLimiter implementations against the behavior every limiter in
+// this module promises, so custom limiters can be tested the same way as the built-in ones:
+//
+//	func TestMyLimiter(t *testing.T) {
+//		ratelimitertest.Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+//			return NewMyLimiter(maxOps, per, burst)
+//		})
+//	}
+package ratelimitertest
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imotyashok/ratelimiter"
+)
+
+// Factory builds a fresh limiter allowing maxOps per `per`, with bursts up to burst
+type Factory func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter
+
+// Option adjusts which checks Run makes, for limiters that can't meet all of them by design
+type Option func(*options)
+
+// Internal settings built up from Options
+type options struct {
+	noRefill bool // skip checks that need the limiter to refill while the test runs
+}
+
+// WithoutRefill is for limiters that hand out a fixed quota per calendar period (like QuotaLimiter)
+// instead of refilling as time passes; the checks that wait for a refill are skipped
+func WithoutRefill() Option {
+	return func(o *options) {
+		o.noRefill = true
+	}
+}
+
+// Limiters that report how many requests are left and how long until that resets, like FixedWindow
+// and MultiWindowLimiter
+type statusReporter interface {
+	Status() (remaining int, reset time.Duration)
+}
+
+// Limiters that report when their quota resets, like QuotaLimiter
+type resetReporter interface {
+	ResetsAt() time.Time
+}
+
+// Parameters every check builds its limiters with: 100/s with bursts up to 10
+const (
+	maxOps = 100
+	per    = time.Second
+	burst  = 10
+	rate   = float64(maxOps) / float64(per/time.Second)
+
+	// How far over the configured rate a limiter may drift, to allow for timer and scheduling slop
+	epsilon = 0.1
+)
+
+// Run checks the limiters built by newLimiter against the RateLimiter invariants, each as its own subtest:
+//   - no more than burst requests get admitted in an instant
+//   - over time, no more than burst + rate × elapsed get admitted, whatever the request pattern
+//   - Wait admits at the configured rate, not faster and not much slower
+//   - Wait gives up once its context ends
+//   - for limiters reporting when they reset (a Status method like FixedWindow's, or a ResetsAt method
+//     like QuotaLimiter's), the reset time never moves back
+//
+// The request patterns are random; the seed is logged so a failure can be reproduced with RunSeed
+func Run(t *testing.T, newLimiter Factory, opts ...Option) {
+	RunSeed(t, newLimiter, rand.Uint64(), opts...)
+}
+
+// RunSeed is Run with a fixed seed for the random request patterns
+func RunSeed(t *testing.T, newLimiter Factory, seed uint64, opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	t.Logf("ratelimitertest seed: %d", seed)
+
+	t.Run("Burst", func(t *testing.T) { testBurst(t, newLimiter) })
+	t.Run("LongRunRate", func(t *testing.T) { testLongRunRate(t, newLimiter, seed) })
+	t.Run("WaitRate", func(t *testing.T) {
+		if o.noRefill {
+			t.Skip("limiter doesn't refill")
+		}
+		testWaitRate(t, newLimiter)
+	})
+	t.Run("WaitCancelled", func(t *testing.T) { testWaitCancelled(t, newLimiter) })
+	t.Run("ResetMonotonic", func(t *testing.T) { testResetMonotonic(t, newLimiter) })
+}
+
+// Checks that hammering a fresh limiter gets no more than the burst through at once
+func testBurst(t *testing.T, newLimiter Factory) {
+	limiter := newLimiter(maxOps, per, burst)
+
+	start := time.Now()
+	admitted := 0
+	for i := 0; i < burst*10; i++ {
+		if limiter.Allow() {
+			admitted++
+		}
+	}
+
+	if limit := allowance(time.Since(start)); float64(admitted) > limit {
+		t.Errorf("Admitted %d requests in an instant, expected at most %.0f", admitted, limit)
+	}
+	if admitted == 0 {
+		t.Error("Expected a fresh limiter to admit something")
+	}
+}
+
+// Checks that random bursts of concurrent Allow calls with random pauses in between never get more
+// than the limiter's allowance through
+func testLongRunRate(t *testing.T, newLimiter Factory, seed uint64) {
+	limiter := newLimiter(maxOps, per, burst)
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	var admitted atomic.Int64
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		// A random number of concurrent callers, each making a random number of calls
+		var wg sync.WaitGroup
+		for range 1 + rng.IntN(8) {
+			calls := 1 + rng.IntN(20)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range calls {
+					if limiter.Allow() {
+						admitted.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		time.Sleep(time.Duration(rng.IntN(30)) * time.Millisecond)
+
+		if limit := allowance(time.Since(start)); float64(admitted.Load()) > limit {
+			t.Fatalf("Admitted %d requests after %v, expected at most %.0f", admitted.Load(), time.Since(start), limit)
+		}
+	}
+}
+
+// Checks that back to back Waits on a drained limiter go at the configured rate. How fast they may go
+// is judged by the same allowance as LongRunRate, counting what draining let through too, so window
+// based limiters that let a window's worth through at each boundary aren't held to exact spacing
+func testWaitRate(t *testing.T, newLimiter Factory) {
+	limiter := newLimiter(maxOps, per, burst)
+	start := time.Now()
+	drained := 0
+	for limiter.Allow() {
+		drained++
+	}
+
+	const waits = 20
+	for range waits {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	expected := time.Duration(float64(waits-1) / rate * float64(time.Second))
+	if limit := allowance(elapsed); float64(drained+waits) > limit {
+		t.Errorf("%d Waits after draining %d took %v, expected at most %.0f admitted by then", waits, drained, elapsed, limit)
+	}
+	if elapsed > expected*3 {
+		t.Errorf("%d Waits took %v, expected around %v", waits, elapsed, expected)
+	}
+}
+
+// Checks that Wait returns an error wrapping the context's error once the context ends
+func testWaitCancelled(t *testing.T, newLimiter Factory) {
+	limiter := newLimiter(1, time.Hour, 1)
+	limiter.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected an error wrapping DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Wait to give up with its context, took %v", elapsed)
+	}
+}
+
+// Checks that the reset time a limiter reports never moves back as requests come in and windows roll
+// over; a client backing off until the reported reset should never be told a later reset was earlier
+func testResetMonotonic(t *testing.T, newLimiter Factory) {
+	limiter := newLimiter(maxOps, per, burst)
+
+	// Brackets the absolute reset time between the clock readings taken around asking for it
+	var resetAt func() (earliest, latest time.Time)
+	switch l := limiter.(type) {
+	case statusReporter:
+		resetAt = func() (time.Time, time.Time) {
+			before := time.Now()
+			_, reset := l.Status()
+			return before.Add(reset), time.Now().Add(reset)
+		}
+	case resetReporter:
+		resetAt = func() (time.Time, time.Time) {
+			at := l.ResetsAt()
+			return at, at
+		}
+	default:
+		t.Skip("limiter doesn't report a reset time")
+	}
+
+	// Reset durations get rounded to whole nanoseconds along the way
+	const slop = time.Microsecond
+
+	prev, _ := resetAt()
+	start := time.Now()
+	for time.Since(start) < 300*time.Millisecond {
+		for range 3 {
+			limiter.Allow()
+		}
+		earliest, latest := resetAt()
+		if latest.Add(slop).Before(prev) {
+			t.Fatalf("Reset time moved back from %v to %v after %v", prev.Sub(start), latest.Sub(start), time.Since(start))
+		}
+		if earliest.After(prev) {
+			prev = earliest
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// How many requests may have been admitted after elapsed time: the burst plus the refill, with some slop
+func allowance(elapsed time.Duration) float64 {
+	return burst + rate*elapsed.Seconds()*(1+epsilon) + 1
+}
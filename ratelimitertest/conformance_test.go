@@ -0,0 +1,79 @@
+package ratelimitertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imotyashok/ratelimiter"
+)
+
+// TestTokenBucket runs the conformance suite against TokenBucket
+func TestTokenBucket(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		return ratelimiter.NewTokenBucket(maxOps, per, burst)
+	})
+}
+
+// TestTokenBucketWaitDispatcher runs the conformance suite against a TokenBucket with a wait dispatcher
+func TestTokenBucketWaitDispatcher(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		return ratelimiter.NewTokenBucket(maxOps, per, burst, ratelimiter.WithWaitDispatcher())
+	})
+}
+
+// TestSwappable runs the conformance suite against a Swappable wrapping a TokenBucket
+func TestSwappable(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		return ratelimiter.NewSwappable(ratelimiter.NewTokenBucket(maxOps, per, burst))
+	})
+}
+
+// TestGCRA runs the conformance suite against GCRA
+func TestGCRA(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		return ratelimiter.NewGCRA(maxOps, per, burst)
+	})
+}
+
+// TestFixedWindow runs the conformance suite against FixedWindow. Half the burst goes in each window,
+// since a window boundary lets two windows' worth through at once
+func TestFixedWindow(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		perWindow := max(burst/2, 1)
+		return ratelimiter.NewFixedWindow(perWindow, per*time.Duration(perWindow)/time.Duration(maxOps))
+	})
+}
+
+// TestSlidingWindowCounter runs the conformance suite against SlidingWindowCounter, with windows sized
+// like FixedWindow's
+func TestSlidingWindowCounter(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		perWindow := max(burst/2, 1)
+		return ratelimiter.NewSlidingWindowCounter(perWindow, per*time.Duration(perWindow)/time.Duration(maxOps))
+	})
+}
+
+// TestLeakyBucket runs the conformance suite against LeakyBucket, queueing up to burst waiters
+func TestLeakyBucket(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		return ratelimiter.NewLeakyBucket(maxOps, per, burst)
+	})
+}
+
+// TestMultiWindowLimiter runs the conformance suite against a MultiWindowLimiter whose burst window is
+// tighter than its long run window
+func TestMultiWindowLimiter(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		return ratelimiter.NewMultiWindowLimiter(
+			ratelimiter.Window{MaxOps: burst, Per: per * time.Duration(burst) / time.Duration(maxOps)},
+			ratelimiter.Window{MaxOps: maxOps, Per: per},
+		)
+	})
+}
+
+// TestQuotaLimiter runs the conformance suite against a daily QuotaLimiter with the burst as its quota
+func TestQuotaLimiter(t *testing.T) {
+	Run(t, func(maxOps int, per time.Duration, burst int) ratelimiter.RateLimiter {
+		return ratelimiter.NewQuotaLimiter(burst, ratelimiter.QuotaDaily, nil)
+	}, WithoutRefill())
+}
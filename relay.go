@@ -0,0 +1,71 @@
+package ratelimiter
+
+import "context"
+
+// RelayLimiter hands out admissions from an upstream limiter at a downstream limiter's pace; see Relay
+type RelayLimiter struct {
+	permits chan struct{} // unbuffered; the relay blocks on it until someone takes the admission
+	done    chan struct{} // closed once the relay has stopped
+}
+
+// Relay bridges a bursty upstream limiter to a steady downstream one: it takes admissions from src
+// (e.g. an external provider's per-window quota, which hands out its whole window at once) and
+// re-emits them no faster than dst allows, so consumers see a smooth pace but never more than src
+// grants. The relay runs in the background until ctx is done (or src or dst fail), after which the
+// returned limiter's Wait fails with ErrClosed. It only ever gets one admission ahead of its consumers,
+// so an idle consumer doesn't soak up the upstream quota
+func Relay(ctx context.Context, src RateLimiter, dst RateLimiter) *RelayLimiter {
+	if src == nil || dst == nil {
+		panic("invalid relay parameters")
+	}
+
+	r := &RelayLimiter{permits: make(chan struct{}), done: make(chan struct{})}
+	go r.run(ctx, src, dst)
+	return r
+}
+
+// Implements Allow RateLimiter method; allows the request if the relay has an admission ready
+// NON-BLOCKING! Returns immediately
+func (r *RelayLimiter) Allow() bool {
+	select {
+	case <-r.permits:
+		return true
+	default:
+		return false
+	}
+}
+
+// Implements Wait RateLimiter method; blocks until the relay hands out the next admission.
+// Returns ErrClosed once the relay has stopped
+// BLOCKING!! Blocks current goroutine
+func (r *RelayLimiter) Wait(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	select {
+	case <-r.permits:
+		return nil
+	case <-r.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return waitError(ctx)
+	}
+}
+
+// Internal relay loop; gets an admission from src, paces it through dst, and waits for a consumer to take it
+func (r *RelayLimiter) run(ctx context.Context, src RateLimiter, dst RateLimiter) {
+	defer close(r.done)
+
+	for {
+		if src.Wait(ctx) != nil || dst.Wait(ctx) != nil {
+			return
+		}
+
+		select {
+		case r.permits <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestRelay_SmoothsBurst tests that a burst from upstream comes out at the downstream pace
+func TestRelay_SmoothsBurst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Upstream hands out 5 at once, downstream paces to one every 20ms
+	r := Relay(ctx, NewFixedWindow(5, time.Hour), Every(20*time.Millisecond))
+
+	var gaps []time.Duration
+	last := time.Now()
+	for range 5 {
+		if err := r.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		gaps = append(gaps, time.Since(last))
+		last = time.Now()
+	}
+
+	for i, gap := range gaps[1:] {
+		if gap < 15*time.Millisecond {
+			t.Errorf("Expected admission %d paced ~20ms after the previous one, got %v", i+2, gap)
+		}
+	}
+}
+
+// TestRelay_UpstreamCaps tests that the relay never hands out more than upstream grants
+func TestRelay_UpstreamCaps(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := Relay(ctx, NewFixedWindow(2, time.Hour), NewTokenBucket(1000, time.Second, 100))
+	for range 2 {
+		if err := r.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer waitCancel()
+	if err := r.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected no admissions past the upstream quota, got: %v", err)
+	}
+}
+
+// TestRelay_Stops tests that Wait fails with ErrClosed once the relay's context is done
+func TestRelay_Stops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := Relay(ctx, NewFixedWindow(1, time.Hour), NewTokenBucket(10, time.Second, 1))
+	r.Wait(context.Background())
+	cancel()
+
+	if err := r.Wait(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got: %v", err)
+	}
+	if r.Allow() {
+		t.Error("Expected Allow to be denied once the relay has stopped")
+	}
+}
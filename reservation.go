@@ -0,0 +1,101 @@
+package ratelimiter
+
+// ReservationID identifies an upfront charge made with Reserve, to be settled later with Commit
+type ReservationID uint64
+
+// Reserve charges an estimated cost upfront for work whose true cost is only known once it's done
+// (e.g. a streamed LLM response). Settle it with Commit once the actual cost is known.
+// Panics on a negative estimate
+// NON-BLOCKING! Returns immediately; the second return value is false if the estimate doesn't fit,
+// or the bucket is paused or closed
+func (tb *TokenBucket) Reserve(estimate float64) (ReservationID, bool) {
+	if estimate < 0 {
+		panic("invalid rate limiter parameters") // would add tokens instead of taking them
+	}
+
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	tb.refillBucket()
+
+	// In meter only mode, count it and let it through; only what actually fit is settled on Commit
+	if tb.meterOnly {
+		charged := 0.0
+		if tb.fits(estimate) {
+			charged = estimate
+		}
+		tb.meter(estimate)
+		return tb.recordReservation(charged), true
+	}
+
+	if !tb.fits(estimate) || tb.paused != nil || tb.closing {
+		return 0, false
+	}
+
+	// With a wait dispatcher, don't jump ahead of anyone queued in Wait
+	if tb.dispatch != nil && tb.waiters > 0 {
+		return 0, false
+	}
+
+	tb.take(estimate)
+	return tb.recordReservation(estimate), true
+}
+
+// Commit settles a reservation against the actual cost. If the work came in under the estimate
+// the difference is refunded (up to bucket capacity); if it went over, the extra is charged too,
+// which can briefly put the bucket in debt so later requests wait until it's paid off.
+// Panics on a negative actual cost
+func (tb *TokenBucket) Commit(id ReservationID, actualCost float64) error {
+	if actualCost < 0 {
+		panic("invalid rate limiter parameters") // would refund more than was reserved
+	}
+
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	estimate, ok := tb.reservations[id]
+	if !ok {
+		return ErrUnknownReservation
+	}
+	delete(tb.reservations, id)
+
+	tb.refillBucket()
+
+	// Positive difference is a refund, negative difference is an additional charge
+	tb.tokens += estimate - actualCost
+	if tb.tokens > tb.max_tokens {
+		tb.tokens = tb.max_tokens
+	}
+	return nil
+}
+
+// Internal helper that keeps track of an outstanding reservation and hands out its ID
+// Caller must hold the lock
+func (tb *TokenBucket) recordReservation(estimate float64) ReservationID {
+	if tb.reservations == nil {
+		tb.reservations = make(map[ReservationID]float64)
+	}
+	tb.nextReservation++
+	tb.reservations[tb.nextReservation] = estimate
+	return tb.nextReservation
+}
+
+// ReserveTokens consumes 1 request and charges an estimated token cost upfront, for calls whose
+// real token usage is only known after the response finishes streaming. Settle it with Commit.
+// Panics on a negative estimate
+// NON-BLOCKING! Returns immediately; the second return value is false if either budget is short
+func (dl *DualLimiter) ReserveTokens(estimate int) (ReservationID, bool) {
+	if !dl.take(float64(estimate)).ok {
+		return 0, false
+	}
+
+	dl.tokens.mtx.Lock()
+	defer dl.tokens.mtx.Unlock()
+	return dl.tokens.recordReservation(float64(estimate)), true
+}
+
+// Commit settles a ReserveTokens reservation against the actual token usage,
+// refunding or additionally charging the difference on the token budget
+func (dl *DualLimiter) Commit(id ReservationID, actualCost int) error {
+	return dl.tokens.Commit(id, float64(actualCost))
+}
@@ -0,0 +1,144 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestReserve_Refund tests that committing under the estimate refunds the difference
+func TestReserve_Refund(t *testing.T) {
+	// Very slow refill so the test only sees reservation changes
+	tb := NewTokenBucket(1, time.Hour, 10)
+
+	id, ok := tb.Reserve(8)
+	if !ok {
+		t.Fatal("Expected reservation of 8 tokens to succeed")
+	}
+
+	// Only 2 tokens left while the reservation is outstanding
+	if _, ok := tb.Reserve(3); ok {
+		t.Fatal("Expected reservation of 3 tokens to fail with 2 tokens left")
+	}
+
+	// Actual cost was 3, so 5 tokens get refunded (7 available now)
+	if err := tb.Commit(id, 3); err != nil {
+		t.Fatalf("Commit() returned error: %v", err)
+	}
+	if _, ok := tb.Reserve(7); !ok {
+		t.Error("Expected refunded tokens to be available again")
+	}
+}
+
+// TestReserve_AdditionalCharge tests that committing over the estimate charges the extra
+func TestReserve_AdditionalCharge(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10)
+
+	id, _ := tb.Reserve(2)
+
+	// Actual cost was 12, so the bucket goes into debt
+	if err := tb.Commit(id, 12); err != nil {
+		t.Fatalf("Commit() returned error: %v", err)
+	}
+	if tb.Allow() {
+		t.Error("Expected bucket to be in debt after committing over the estimate")
+	}
+}
+
+// TestReserve_RefundCappedAtCapacity tests that refunds never overfill the bucket
+func TestReserve_RefundCappedAtCapacity(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10)
+
+	id, _ := tb.Reserve(5)
+	tb.Commit(id, 0) // the whole estimate comes back, but only up to capacity
+
+	if _, ok := tb.Reserve(11); ok {
+		t.Error("Expected bucket to be capped at its max capacity")
+	}
+}
+
+// TestReserve_NegativeCosts tests that negative estimates and actual costs panic instead of overfilling the bucket
+func TestReserve_NegativeCosts(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10)
+	id, _ := tb.Reserve(5)
+
+	for name, call := range map[string]func(){
+		"Reserve": func() { tb.Reserve(-5) },
+		"Commit":  func() { tb.Commit(id, -100) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected %s with a negative cost to panic", name)
+				}
+			}()
+			call()
+		}()
+	}
+}
+
+// TestReserve_PausedOrClosed tests that nothing can be reserved from a paused or closed bucket
+func TestReserve_PausedOrClosed(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10)
+	tb.Pause()
+	if _, ok := tb.Reserve(1); ok {
+		t.Error("Expected reservation on a paused bucket to fail")
+	}
+	tb.Resume()
+
+	tb.Close(context.Background())
+	if _, ok := tb.Reserve(1); ok {
+		t.Error("Expected reservation on a closed bucket to fail")
+	}
+}
+
+// TestReserve_MeterOnly tests that meter only mode lets reservations through and counts the would-be denials
+func TestReserve_MeterOnly(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10, WithMeterOnly())
+
+	if _, ok := tb.Reserve(8); !ok {
+		t.Error("Expected reservation that fits to succeed")
+	}
+	if _, ok := tb.Reserve(8); !ok {
+		t.Error("Expected reservation over the limit to still succeed in meter only mode")
+	}
+	if allowed, denied := tb.Meter(); allowed != 1 || denied != 1 {
+		t.Errorf("Expected 1 allowed and 1 denied, got %d and %d", allowed, denied)
+	}
+}
+
+// TestCommit_Unknown tests that unknown or already committed reservations are rejected
+func TestCommit_Unknown(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10)
+
+	if err := tb.Commit(42, 1); err != ErrUnknownReservation {
+		t.Errorf("Expected ErrUnknownReservation, got: %v", err)
+	}
+
+	id, _ := tb.Reserve(1)
+	tb.Commit(id, 1)
+	if err := tb.Commit(id, 1); err != ErrUnknownReservation {
+		t.Errorf("Expected ErrUnknownReservation on second commit, got: %v", err)
+	}
+}
+
+// TestDualLimiter_ReserveTokens tests the reserve and commit flow on the token budget
+func TestDualLimiter_ReserveTokens(t *testing.T) {
+	dl := NewDualLimiter(10, 100, time.Hour)
+
+	id, ok := dl.ReserveTokens(90)
+	if !ok {
+		t.Fatal("Expected reservation of 90 tokens to succeed")
+	}
+	if dl.AllowTokens(20) {
+		t.Fatal("Expected 20 tokens to be denied while 90 are reserved")
+	}
+
+	// Streamed response only used 40 tokens
+	if err := dl.Commit(id, 40); err != nil {
+		t.Fatalf("Commit() returned error: %v", err)
+	}
+	if !dl.AllowTokens(60) {
+		t.Error("Expected refunded tokens to be available again")
+	}
+}
@@ -0,0 +1,135 @@
+package ratelimiter
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// Resolver wraps a net.Resolver and paces the DNS queries going out through it, for crawlers and
+// scanners that have to respect the limits of their recursive resolver or of authoritative servers.
+// It has the same lookup methods as net.Resolver, each waiting on the limits before querying
+type Resolver struct {
+	resolver *net.Resolver
+	limiter  RateLimiter   // limit on all queries; nil means no global limit
+	zones    *keyedBuckets // limits per zone (e.g. "example.com"); nil means no per zone limit
+}
+
+// ResolverOption configures a Resolver at construction time
+type ResolverOption func(*Resolver)
+
+// WithZoneRate adds a separate limit per zone (maxOps per `per`, with bursts up to burst), so one busy
+// domain's authoritative servers don't get hammered even when the overall limit would allow it.
+// The zone is the last two labels of the name, so "a.b.example.com" counts against "example.com"
+func WithZoneRate(maxOps int, per time.Duration, burst int) ResolverOption {
+	NewTokenBucket(maxOps, per, burst) // validate parameters up front
+
+	return func(r *Resolver) {
+		r.zones = newKeyedBuckets(max(per, time.Minute), func(string) *TokenBucket {
+			return NewTokenBucket(maxOps, per, burst)
+		})
+	}
+}
+
+// Resolver constructor; a nil resolver means net.DefaultResolver, and a nil limiter means only
+// per zone limits (if any) apply
+func NewResolver(resolver *net.Resolver, limiter RateLimiter, opts ...ResolverOption) *Resolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	r := &Resolver{resolver: resolver, limiter: limiter}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// LookupHost is net.Resolver.LookupHost, paced by our limits
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := r.wait(ctx, host); err != nil {
+		return nil, err
+	}
+	return r.resolver.LookupHost(ctx, host)
+}
+
+// LookupIPAddr is net.Resolver.LookupIPAddr, paced by our limits
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if err := r.wait(ctx, host); err != nil {
+		return nil, err
+	}
+	return r.resolver.LookupIPAddr(ctx, host)
+}
+
+// LookupIP is net.Resolver.LookupIP, paced by our limits
+func (r *Resolver) LookupIP(ctx context.Context, network string, host string) ([]net.IP, error) {
+	if err := r.wait(ctx, host); err != nil {
+		return nil, err
+	}
+	return r.resolver.LookupIP(ctx, network, host)
+}
+
+// LookupAddr is net.Resolver.LookupAddr, paced by our limits. Reverse lookups only count against the
+// overall limit, since they don't belong to the zone of a name we know
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if err := r.wait(ctx, ""); err != nil {
+		return nil, err
+	}
+	return r.resolver.LookupAddr(ctx, addr)
+}
+
+// LookupCNAME is net.Resolver.LookupCNAME, paced by our limits
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if err := r.wait(ctx, host); err != nil {
+		return "", err
+	}
+	return r.resolver.LookupCNAME(ctx, host)
+}
+
+// LookupMX is net.Resolver.LookupMX, paced by our limits
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if err := r.wait(ctx, name); err != nil {
+		return nil, err
+	}
+	return r.resolver.LookupMX(ctx, name)
+}
+
+// LookupNS is net.Resolver.LookupNS, paced by our limits
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	if err := r.wait(ctx, name); err != nil {
+		return nil, err
+	}
+	return r.resolver.LookupNS(ctx, name)
+}
+
+// LookupTXT is net.Resolver.LookupTXT, paced by our limits
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if err := r.wait(ctx, name); err != nil {
+		return nil, err
+	}
+	return r.resolver.LookupTXT(ctx, name)
+}
+
+// Internal helper that waits on the overall limit and then the name's zone limit (if name is known)
+func (r *Resolver) wait(ctx context.Context, name string) error {
+	if r.limiter != nil {
+		if err := r.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if r.zones != nil && name != "" {
+		return r.zones.get(zoneOf(name)).Wait(ctx)
+	}
+	return nil
+}
+
+// Internal helper that maps a name to the zone we limit it under: its last two labels, lowercased.
+// This doesn't know about public suffixes, so "a.example.co.uk" and "b.other.co.uk" share "co.uk"
+func zoneOf(name string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	if len(labels) <= 2 {
+		return strings.Join(labels, ".")
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
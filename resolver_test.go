@@ -0,0 +1,62 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestZoneOf tests that names map to their last two labels
+func TestZoneOf(t *testing.T) {
+	cases := map[string]string{
+		"example.com":        "example.com",
+		"WWW.Example.COM.":   "example.com",
+		"a.b.c.example.com":  "example.com",
+		"localhost":          "localhost",
+		"mail.example.co.uk": "co.uk",
+	}
+	for name, want := range cases {
+		if got := zoneOf(name); got != want {
+			t.Errorf("zoneOf(%q) = %q, expected %q", name, got, want)
+		}
+	}
+}
+
+// TestResolver_ZoneLimit tests that queries for the same zone share a limit while other zones don't
+func TestResolver_ZoneLimit(t *testing.T) {
+	r := NewResolver(nil, nil, WithZoneRate(1, time.Hour, 1))
+	ctx := context.Background()
+
+	if err := r.wait(ctx, "a.example.com"); err != nil {
+		t.Fatalf("Expected first query for the zone to go through, got: %v", err)
+	}
+
+	// Second query for the same zone has to wait an hour, so give up quickly
+	shortCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := r.wait(shortCtx, "b.example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected second query for the zone to be held back, got: %v", err)
+	}
+
+	// A different zone has its own limit
+	if err := r.wait(ctx, "example.org"); err != nil {
+		t.Errorf("Expected query for another zone to go through, got: %v", err)
+	}
+}
+
+// TestResolver_GlobalLimit tests that the overall limiter applies to every query
+func TestResolver_GlobalLimit(t *testing.T) {
+	r := NewResolver(nil, NewTokenBucket(1, time.Hour, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// localhost resolves without going out to the network
+	if _, err := r.LookupHost(ctx, "localhost"); err != nil {
+		t.Fatalf("Expected first lookup to succeed, got: %v", err)
+	}
+	if _, err := r.LookupHost(ctx, "localhost"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected second lookup to be held back, got: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package ratelimiter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryDetector reports whether a request is a retry of an earlier attempt
+type RetryDetector func(r *http.Request) bool
+
+// RetryHeader is a RetryDetector for clients that mark retries with a header, like an attempt
+// counter ("X-Retry-Attempt: 2"). Any value other than empty or "0" counts as a retry
+func RetryHeader(name string) RetryDetector {
+	return func(r *http.Request) bool {
+		v := r.Header.Get(name)
+		return v != "" && v != "0"
+	}
+}
+
+// IdempotencyKeyRetries is a RetryDetector that treats a request as a retry if we've already seen
+// its idempotency key header (e.g. "Idempotency-Key") within ttl. Requests without the header never count
+func IdempotencyKeyRetries(header string, ttl time.Duration) RetryDetector {
+	if ttl <= 0 {
+		panic("invalid retry detector parameters")
+	}
+
+	var mtx sync.Mutex
+	seen := make(map[string]time.Time) // idempotency key -> when we stop remembering it
+	lastPrune := time.Now()
+
+	return func(r *http.Request) bool {
+		id := r.Header.Get(header)
+		if id == "" {
+			return false
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		// Forget expired keys every once in a while so the map doesn't grow forever
+		now := time.Now()
+		if now.Sub(lastPrune) >= ttl {
+			for k, expires := range seen {
+				if !now.Before(expires) {
+					delete(seen, k)
+				}
+			}
+			lastPrune = now
+		}
+
+		expires, ok := seen[id]
+		seen[id] = now.Add(ttl)
+		return ok && now.Before(expires)
+	}
+}
+
+// LimitRetries is middleware that charges retried requests against a separate retry budget of
+// maxRetries per `per`, and rejects them with 429 Too Many Requests once it runs out. First attempts
+// pass straight through, so a retry storm gets shed while fresh traffic still gets served.
+// With a key, each client gets its own retry budget; with a nil key all retries share one budget.
+// An Override in the request context can bypass the budget or change what a retry costs; a retry
+// costing more than maxRetries can never be served and gets 413 Request Entity Too Large
+func LimitRetries(next http.Handler, detect RetryDetector, maxRetries int, per time.Duration, key KeyFunc) http.Handler {
+	if detect == nil || maxRetries <= 0 || per <= 0 {
+		panic("invalid retry budget parameters")
+	}
+
+	newBudget := func(string) *TokenBucket { return NewTokenBucket(maxRetries, per, maxRetries) }
+	shared := newBudget("")
+	budgets := newKeyedBuckets(max(per, time.Minute), newBudget) // idle clients get forgotten once their budget has refilled
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !detect(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cost, limited := overrideCost(r, 1)
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cost > float64(maxRetries) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		budget := shared
+		if key != nil {
+			budget = budgets.get(key(r))
+		}
+
+		if !budget.AllowN(cost) {
+			// Let the client know when the retry budget has room again
+			retryAfter := math.Ceil(budget.EstimatedWait(cost).Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(retryAfter))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
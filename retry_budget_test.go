@@ -0,0 +1,116 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Internal test helper that sends a request with the given headers and returns the status code
+func serveWithHeaders(h http.Handler, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+// TestLimitRetries_RetriesShed tests that retries are rejected once the retry budget is used up,
+// while first attempts keep getting through
+func TestLimitRetries_RetriesShed(t *testing.T) {
+	h := LimitRetries(okHandler, RetryHeader("X-Retry-Attempt"), 2, time.Minute, nil)
+	retry := map[string]string{"X-Retry-Attempt": "1"}
+
+	for i := range 2 {
+		if rec := serveWithHeaders(h, "10.0.0.1:1", retry); rec.Code != http.StatusOK {
+			t.Fatalf("Expected retry %d to be allowed, got %d", i+1, rec.Code)
+		}
+	}
+
+	rec := serveWithHeaders(h, "10.0.0.1:1", retry)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected third retry to be rejected, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on rejected retry")
+	}
+
+	// First attempts (no header, or attempt 0) aren't charged against the retry budget
+	for _, headers := range []map[string]string{nil, {"X-Retry-Attempt": "0"}} {
+		if rec := serveWithHeaders(h, "10.0.0.1:1", headers); rec.Code != http.StatusOK {
+			t.Errorf("Expected first attempt to get through, got %d", rec.Code)
+		}
+	}
+}
+
+// TestLimitRetries_PerClient tests that each client gets its own retry budget when keyed
+func TestLimitRetries_PerClient(t *testing.T) {
+	h := LimitRetries(okHandler, RetryHeader("X-Retry-Attempt"), 1, time.Minute, ClientIP)
+	retry := map[string]string{"X-Retry-Attempt": "1"}
+
+	serveWithHeaders(h, "10.0.0.1:1", retry)
+	if rec := serveWithHeaders(h, "10.0.0.1:1", retry); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected client 1's second retry to be rejected, got %d", rec.Code)
+	}
+	if rec := serveWithHeaders(h, "10.0.0.2:1", retry); rec.Code != http.StatusOK {
+		t.Errorf("Expected client 2's retry to be allowed, got %d", rec.Code)
+	}
+}
+
+// TestLimitRetries_OverrideCostTooLarge tests that an override pushing a retry's cost past the budget is rejected, not capped
+func TestLimitRetries_OverrideCostTooLarge(t *testing.T) {
+	served := 0
+	h := LimitRetries(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served++ }), RetryHeader("X-Retry-Attempt"), 2, time.Minute, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Retry-Attempt", "1")
+	req = req.WithContext(WithOverride(req.Context(), Override{CostMultiplier: 3}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge || served != 0 {
+		t.Errorf("Expected 413 without serving the retry, got %d (served %d)", rec.Code, served)
+	}
+
+	// The rejected retry wasn't charged, so the whole budget is still there
+	retry := map[string]string{"X-Retry-Attempt": "1"}
+	for i := range 2 {
+		if rec := serveWithHeaders(h, "10.0.0.1:1", retry); rec.Code != http.StatusOK {
+			t.Errorf("Expected retry %d to be allowed, got %d", i+1, rec.Code)
+		}
+	}
+}
+
+// TestIdempotencyKeyRetries tests that repeated idempotency keys are detected as retries
+func TestIdempotencyKeyRetries(t *testing.T) {
+	detect := IdempotencyKeyRetries("Idempotency-Key", 50*time.Millisecond)
+
+	newReq := func(key string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		return req
+	}
+
+	if detect(newReq("abc")) {
+		t.Error("Expected first use of a key to not be a retry")
+	}
+	if !detect(newReq("abc")) {
+		t.Error("Expected second use of a key to be a retry")
+	}
+	if detect(newReq("")) || detect(newReq("")) {
+		t.Error("Expected requests without a key to never be retries")
+	}
+
+	// After the TTL the key is forgotten
+	time.Sleep(60 * time.Millisecond)
+	if detect(newReq("abc")) {
+		t.Error("Expected key to be forgotten after the TTL")
+	}
+}
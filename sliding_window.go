@@ -0,0 +1,103 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SlidingWindowCounter approximates a sliding window using just two counters: requests in the current
+// fixed window, and in the one before it. The previous window's count is weighted by how much of it
+// still overlaps the sliding window, assuming its requests were spread evenly. That smooths out the 2x
+// burst a FixedWindow allows across a boundary, with constant memory no matter the traffic
+type SlidingWindowCounter struct {
+	mtx         sync.Mutex
+	maxOps      float64       // requests allowed per sliding window
+	per         time.Duration // window length
+	windowStart time.Time     // start of the current fixed window
+	count       float64       // requests let through in the current fixed window
+	prevCount   float64       // requests let through in the previous fixed window
+}
+
+// SlidingWindowCounter constructor; lets up to maxOps requests through in any window of length `per`
+// (approximately, see SlidingWindowCounter)
+func NewSlidingWindowCounter(maxOps int, per time.Duration) *SlidingWindowCounter {
+	if maxOps <= 0 || per <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+
+	return &SlidingWindowCounter{
+		maxOps:      float64(maxOps),
+		per:         per,
+		windowStart: time.Now().Truncate(per),
+	}
+}
+
+// Implements Allow RateLimiter method; allows the request if the estimated count over the last
+// window has room for it
+// NON-BLOCKING! Returns immediately
+func (sw *SlidingWindowCounter) Allow() bool {
+	sw.mtx.Lock()
+	defer sw.mtx.Unlock()
+
+	_, ok := sw.take(time.Now())
+	return ok
+}
+
+// Implements Wait RateLimiter method; blocks until the estimated count has room for the request
+// BLOCKING!! Blocks current goroutine
+func (sw *SlidingWindowCounter) Wait(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	for {
+		sw.mtx.Lock()
+		waitDuration, ok := sw.take(time.Now())
+		sw.mtx.Unlock()
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-time.After(waitDuration):
+			continue
+		case <-ctx.Done():
+			return waitError(ctx)
+		}
+	}
+}
+
+// Internal helper that lets one request through if the estimate has room for it. Otherwise returns
+// how long until the previous window's weight has dropped enough, or until the next window starts if
+// the current one alone is full
+// Caller must hold the lock
+func (sw *SlidingWindowCounter) take(now time.Time) (time.Duration, bool) {
+	// Roll the windows forward; after a whole idle window the previous count is 0 too
+	if elapsed := now.Sub(sw.windowStart); elapsed >= sw.per {
+		sw.prevCount = sw.count
+		if elapsed >= 2*sw.per {
+			sw.prevCount = 0
+		}
+		sw.count = 0
+		sw.windowStart = now.Truncate(sw.per)
+	}
+
+	elapsed := now.Sub(sw.windowStart)
+	overlap := 1 - elapsed.Seconds()/sw.per.Seconds() // share of the previous window still in the sliding window
+	if sw.prevCount*overlap+sw.count+1 <= sw.maxOps {
+		sw.count++
+		return 0, true
+	}
+
+	windowEnd := sw.per - elapsed
+	room := sw.maxOps - sw.count - 1
+	if room < 0 || sw.prevCount == 0 {
+		return windowEnd, false
+	}
+
+	// Solve prevCount * (1 - t/per) + count + 1 <= maxOps for the elapsed time t
+	needed := time.Duration((1-room/sw.prevCount)*sw.per.Seconds()*float64(time.Second)) - elapsed
+	return min(max(needed, time.Millisecond), windowEnd), false
+}
@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestSlidingWindowCounter_Limit tests that only maxOps requests get through in a window
+func TestSlidingWindowCounter_Limit(t *testing.T) {
+	sw := NewSlidingWindowCounter(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if !sw.Allow() {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	if sw.Allow() {
+		t.Error("Expected 4th request to be denied")
+	}
+}
+
+// TestSlidingWindowCounter_WeightsPrevious tests that the previous window still counts, in proportion
+// to how much of it overlaps, instead of resetting at the boundary
+func TestSlidingWindowCounter_WeightsPrevious(t *testing.T) {
+	sw := NewSlidingWindowCounter(10, time.Minute)
+
+	// Pretend 10 requests came in last window and we're 30s into this one, so 5 of them still count
+	sw.windowStart = time.Now().Add(-30 * time.Second)
+	sw.prevCount = 10
+
+	allowed := 0
+	for sw.Allow() {
+		allowed++
+	}
+	if allowed != 5 {
+		t.Errorf("Expected 5 requests allowed halfway through the window, got %d", allowed)
+	}
+}
+
+// TestSlidingWindowCounter_Idle tests that an idle window clears the previous count
+func TestSlidingWindowCounter_Idle(t *testing.T) {
+	sw := NewSlidingWindowCounter(10, time.Minute)
+	sw.windowStart = time.Now().Add(-3 * time.Minute)
+	sw.count = 10
+
+	allowed := 0
+	for sw.Allow() {
+		allowed++
+	}
+	if allowed != 10 {
+		t.Errorf("Expected a full window after being idle, got %d", allowed)
+	}
+}
+
+// TestSlidingWindowCounter_Wait tests that Wait blocks until the previous window's weight drops enough
+func TestSlidingWindowCounter_Wait(t *testing.T) {
+	sw := NewSlidingWindowCounter(10, time.Second)
+
+	// 10 requests last window, 90% of the way through this one, so 1 still counts and 9 fit
+	sw.windowStart = time.Now().Add(-900 * time.Millisecond)
+	sw.prevCount = 10
+	for sw.Allow() {
+	}
+
+	// Nothing more fits in this window, so the next one goes through once the next window starts
+	start := time.Now()
+	if err := sw.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 300*time.Millisecond {
+		t.Errorf("Expected to wait ~100ms, took %v", elapsed)
+	}
+}
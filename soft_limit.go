@@ -0,0 +1,134 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SoftLimitHeader is set on responses to requests that went over the soft limit but were still served,
+// warning the client that it's in the grace band and will start getting 429s if it keeps it up
+const SoftLimitHeader = "RateLimit-Warning"
+
+// SoftLimiter has two limits: going over the soft one only triggers a warning (a hook and, in the
+// middleware, a response header), while going over the hard one gets requests denied. That gives
+// clients a grace band and advance warning before they start getting rejected
+type SoftLimiter struct {
+	soft   *TokenBucket
+	hard   *TokenBucket
+	onSoft func() // called whenever a request goes over the soft limit; may be nil
+}
+
+// SoftLimiter constructor; softOps and hardOps are both per `per` (with bursts of the same size),
+// and onSoft (which may be nil) is called for every request over the soft limit that still gets through
+func NewSoftLimiter(softOps int, hardOps int, per time.Duration, onSoft func()) *SoftLimiter {
+	if softOps > hardOps {
+		panic("invalid soft limit parameters")
+	}
+	return &SoftLimiter{
+		soft:   NewTokenBucket(softOps, per, softOps),
+		hard:   NewTokenBucket(hardOps, per, hardOps),
+		onSoft: onSoft,
+	}
+}
+
+// Implements Allow RateLimiter method; only the hard limit denies
+// NON-BLOCKING! Returns immediately
+func (sl *SoftLimiter) Allow() bool {
+	allowed, _ := sl.Check()
+	return allowed
+}
+
+// Implements Wait RateLimiter method; blocks on the hard limit, and counts against the soft one
+// once through
+// BLOCKING!! Blocks current goroutine
+func (sl *SoftLimiter) Wait(ctx context.Context) error {
+	if err := sl.hard.Wait(ctx); err != nil {
+		return err
+	}
+	sl.countSoft(1)
+	return nil
+}
+
+// Check is like Allow, but also reports whether the request went over the soft limit.
+// Denied requests always count as over it
+// NON-BLOCKING! Returns immediately
+func (sl *SoftLimiter) Check() (allowed bool, overSoft bool) {
+	return sl.checkN(1)
+}
+
+// Internal helper that's Check for a request costing n. A cost over the hard limit's capacity can
+// never fit and is always denied; one over the soft limit's capacity always counts as over it
+func (sl *SoftLimiter) checkN(n float64) (allowed bool, overSoft bool) {
+	if !sl.hard.AllowN(n) {
+		return false, true
+	}
+	return true, sl.countSoft(n)
+}
+
+// Internal helper that counts a request that got through against the soft limit, and fires the hook
+// if it went over. Returns true if it went over
+func (sl *SoftLimiter) countSoft(n float64) bool {
+	if sl.soft.AllowN(n) {
+		return false
+	}
+	if sl.onSoft != nil {
+		sl.onSoft()
+	}
+	return true
+}
+
+// SoftLimit is middleware that serves requests over softOps per `per` with a RateLimit-Warning header,
+// and rejects requests over hardOps per `per` with 429 Too Many Requests. With a key, each client
+// gets its own limits; with a nil key everyone shares them. onSoft (which may be nil) is called with
+// the request whenever one goes over the soft limit but is still served. An Override in the request
+// context can bypass the limits or change what a request costs; a request costing more than hardOps
+// can never be served and gets 413 Request Entity Too Large
+func SoftLimit(next http.Handler, softOps int, hardOps int, per time.Duration, key KeyFunc, onSoft func(r *http.Request)) http.Handler {
+	if softOps > hardOps {
+		panic("invalid soft limit parameters")
+	}
+
+	shared := NewSoftLimiter(softOps, hardOps, per, nil)
+
+	// keyedBuckets only holds buckets, so keep the soft and hard ones side by side under the same key
+	soft := newKeyedBuckets(max(per, time.Minute), func(string) *TokenBucket { return NewTokenBucket(softOps, per, softOps) })
+	hard := newKeyedBuckets(max(per, time.Minute), func(string) *TokenBucket { return NewTokenBucket(hardOps, per, hardOps) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cost, limited := overrideCost(r, 1)
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cost > float64(hardOps) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		limiter := shared
+		if key != nil {
+			id := key(r)
+			limiter = &SoftLimiter{soft: soft.get(id), hard: hard.get(id)}
+		}
+
+		allowed, overSoft := limiter.checkN(cost)
+		if !allowed {
+			retryAfter := math.Ceil(limiter.hard.EstimatedWait(cost).Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(retryAfter))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		if overSoft {
+			w.Header().Set(SoftLimitHeader, "soft rate limit exceeded; requests will be rejected above "+strconv.Itoa(hardOps)+" per "+per.String())
+			if onSoft != nil {
+				onSoft(r)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSoftLimiter tests the grace band between the soft and hard limits
+func TestSoftLimiter(t *testing.T) {
+	warnings := 0
+	sl := NewSoftLimiter(2, 4, time.Hour, func() { warnings++ })
+
+	expected := []struct{ allowed, overSoft bool }{
+		{true, false}, {true, false}, // under the soft limit
+		{true, true}, {true, true}, // in the grace band
+		{false, true}, // over the hard limit
+	}
+	for i, want := range expected {
+		allowed, overSoft := sl.Check()
+		if allowed != want.allowed || overSoft != want.overSoft {
+			t.Errorf("Request %d: expected allowed=%v overSoft=%v, got %v %v", i+1, want.allowed, want.overSoft, allowed, overSoft)
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("Expected the hook to fire for the 2 requests in the grace band, got %d", warnings)
+	}
+}
+
+// TestSoftLimit tests the middleware's warning header and rejection
+func TestSoftLimit(t *testing.T) {
+	warned := 0
+	handler := SoftLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 1, 2, time.Hour, ClientIP, func(*http.Request) { warned++ })
+
+	codes := []int{}
+	warnings := []bool{}
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		codes = append(codes, rec.Code)
+		warnings = append(warnings, rec.Header().Get(SoftLimitHeader) != "")
+	}
+
+	if codes[0] != 200 || warnings[0] {
+		t.Errorf("Expected first request to be served without warning, got %d %v", codes[0], warnings[0])
+	}
+	if codes[1] != 200 || !warnings[1] || warned != 1 {
+		t.Errorf("Expected second request to be served with a warning, got %d %v", codes[1], warnings[1])
+	}
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected third request to be rejected, got %d", codes[2])
+	}
+}
+
+// TestSoftLimit_OverrideCostTooLarge tests that an override pushing the cost past the hard limit is rejected, not capped
+func TestSoftLimit_OverrideCostTooLarge(t *testing.T) {
+	served := 0
+	handler := SoftLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served++ }), 2, 4, time.Hour, nil, nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(WithOverride(req.Context(), Override{CostMultiplier: 10}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge || served != 0 {
+		t.Errorf("Expected 413 without serving the request, got %d (served %d)", rec.Code, served)
+	}
+}
@@ -0,0 +1,41 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// SpreadN runs fn n times, spreading the calls evenly across the given duration instead of bursting
+// them all at once, e.g. a nightly sync of 10,000 records that has to be done by morning. If calls run
+// long and fall behind, the pace is recalculated so the rest are spread over whatever time is left.
+// fn is called with the item index (0 to n-1); SpreadN stops at the first error fn returns, or when
+// the context is cancelled
+// BLOCKING!! Blocks current goroutine
+func SpreadN(ctx context.Context, n int, over time.Duration, fn func(ctx context.Context, i int) error) error {
+	if n < 0 || over < 0 || fn == nil {
+		panic("invalid spread parameters")
+	}
+
+	deadline := time.Now().Add(over)
+	for i := range n {
+		itemStart := time.Now()
+		if err := fn(ctx, i); err != nil {
+			return err
+		}
+		if i == n-1 {
+			break
+		}
+
+		// Spread what's left evenly over the time remaining (as of when this item started). If the
+		// item ran past its slot we start the next one right away and everything after speeds up
+		gap := deadline.Sub(itemStart) / time.Duration(n-i)
+		next := itemStart.Add(gap)
+
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
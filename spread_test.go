@@ -0,0 +1,76 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSpreadN_Even tests that calls are spread evenly across the duration
+func TestSpreadN_Even(t *testing.T) {
+	var starts []time.Duration
+	begin := time.Now()
+
+	err := SpreadN(context.Background(), 4, 200*time.Millisecond, func(ctx context.Context, i int) error {
+		starts = append(starts, time.Since(begin))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Calls should start at roughly 0, 50, 100 and 150ms
+	for i, start := range starts {
+		want := time.Duration(i) * 50 * time.Millisecond
+		if start < want-10*time.Millisecond || start > want+30*time.Millisecond {
+			t.Errorf("Call %d started at %v, expected ~%v", i, start, want)
+		}
+	}
+}
+
+// TestSpreadN_CatchesUp tests that the pace speeds up after a call runs long
+func TestSpreadN_CatchesUp(t *testing.T) {
+	begin := time.Now()
+
+	// First call eats up half the time, so the remaining 3 should squeeze into the other half
+	SpreadN(context.Background(), 4, 200*time.Millisecond, func(ctx context.Context, i int) error {
+		if i == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil
+	})
+
+	if elapsed := time.Since(begin); elapsed > 220*time.Millisecond {
+		t.Errorf("Expected all calls to finish within the duration, took %v", elapsed)
+	}
+}
+
+// TestSpreadN_StopsOnError tests that the first error stops the run
+func TestSpreadN_StopsOnError(t *testing.T) {
+	failure := errors.New("failure")
+	calls := 0
+
+	err := SpreadN(context.Background(), 5, 50*time.Millisecond, func(ctx context.Context, i int) error {
+		calls++
+		if i == 1 {
+			return failure
+		}
+		return nil
+	})
+
+	if err != failure || calls != 2 {
+		t.Errorf("Expected to stop after the failing call, got err=%v calls=%d", err, calls)
+	}
+}
+
+// TestSpreadN_ContextCancelled tests that cancellation stops the run between calls
+func TestSpreadN_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := SpreadN(ctx, 10, time.Hour, func(ctx context.Context, i int) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+}
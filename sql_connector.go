@@ -0,0 +1,308 @@
+package ratelimiter
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ThrottledConnector wraps a database/sql driver.Connector and paces the queries and execs going
+// through its connections, so batch jobs can't overwhelm a shared database. Open a pool with
+// sql.OpenDB(NewThrottledConnector(...)); each pool gets its own limits. Connecting, pinging and
+// transaction commits/rollbacks aren't limited, only statements
+type ThrottledConnector struct {
+	connector  driver.Connector
+	limiter    RateLimiter   // limit on all statements; nil means no overall limit
+	statements *keyedBuckets // limits per statement fingerprint; nil means no per statement limit
+}
+
+// SQLOption configures a ThrottledConnector at construction time
+type SQLOption func(*ThrottledConnector)
+
+// WithStatementRate adds a separate limit per statement (maxOps per `per`, with bursts up to burst),
+// so one hot query can't use up the whole budget. Statements are told apart by their fingerprint:
+// the query with literals replaced by "?" and whitespace collapsed, so "WHERE id = 1" and
+// "WHERE id = 2" count as the same statement
+func WithStatementRate(maxOps int, per time.Duration, burst int) SQLOption {
+	NewTokenBucket(maxOps, per, burst) // validate parameters up front
+
+	return func(c *ThrottledConnector) {
+		c.statements = newKeyedBuckets(max(per, time.Minute), func(string) *TokenBucket {
+			return NewTokenBucket(maxOps, per, burst)
+		})
+	}
+}
+
+// ThrottledConnector constructor; a nil limiter means only per statement limits (if any) apply
+func NewThrottledConnector(connector driver.Connector, limiter RateLimiter, opts ...SQLOption) *ThrottledConnector {
+	if connector == nil {
+		panic("invalid connector parameters")
+	}
+
+	c := &ThrottledConnector{connector: connector, limiter: limiter}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Connect implements driver.Connector, handing out connections whose statements are paced
+func (c *ThrottledConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &throttledConn{Conn: conn, c: c}, nil
+}
+
+// Driver implements driver.Connector
+func (c *ThrottledConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// Internal helper that waits on the overall limit and then the statement's own limit
+func (c *ThrottledConnector) wait(ctx context.Context, query string) error {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if c.statements != nil {
+		return c.statements.get(statementFingerprint(query)).Wait(ctx)
+	}
+	return nil
+}
+
+// Connection wrapper that paces queries and execs, whether run directly or through prepared statements.
+// The optional driver interfaces are passed through so database/sql treats it just like the real conn
+type throttledConn struct {
+	driver.Conn
+	c *ThrottledConnector
+}
+
+// Prepare wraps the prepared statement so its executions get paced
+func (tc *throttledConn) Prepare(query string) (driver.Stmt, error) {
+	return tc.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext wraps the prepared statement so its executions get paced
+func (tc *throttledConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := tc.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = tc.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &throttledStmt{Stmt: stmt, c: tc.c, query: query}, nil
+}
+
+// BeginTx passes through; transactions themselves aren't limited, only the statements run in them
+func (tc *throttledConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := tc.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+
+	// Same checks database/sql does for drivers that only have Begin
+	if opts.Isolation != 0 {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	return tc.Conn.Begin() // fallback for drivers without BeginTx
+}
+
+// ExecContext waits on the limits before running the exec
+func (tc *throttledConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := tc.Conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql falls back to preparing the statement, which gets paced there instead
+		return nil, driver.ErrSkip
+	}
+	if err := tc.c.wait(ctx, query); err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, query, args)
+}
+
+// QueryContext waits on the limits before running the query
+func (tc *throttledConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := tc.Conn.(driver.QueryerContext)
+	if !ok {
+		// database/sql falls back to preparing the statement, which gets paced there instead
+		return nil, driver.ErrSkip
+	}
+	if err := tc.c.wait(ctx, query); err != nil {
+		return nil, err
+	}
+	return q.QueryContext(ctx, query, args)
+}
+
+// Ping passes through to the real conn
+func (tc *throttledConn) Ping(ctx context.Context) error {
+	if p, ok := tc.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession passes through to the real conn
+func (tc *throttledConn) ResetSession(ctx context.Context) error {
+	if r, ok := tc.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid passes through to the real conn
+func (tc *throttledConn) IsValid() bool {
+	if v, ok := tc.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue passes through to the real conn
+func (tc *throttledConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := tc.Conn.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip // use database/sql's default conversion
+}
+
+// Prepared statement wrapper that paces every execution of the statement
+type throttledStmt struct {
+	driver.Stmt
+	c     *ThrottledConnector
+	query string
+}
+
+// Exec waits on the limits before executing the statement
+func (ts *throttledStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := ts.c.wait(context.Background(), ts.query); err != nil {
+		return nil, err
+	}
+	return ts.Stmt.Exec(args)
+}
+
+// Query waits on the limits before querying with the statement
+func (ts *throttledStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := ts.c.wait(context.Background(), ts.query); err != nil {
+		return nil, err
+	}
+	return ts.Stmt.Query(args)
+}
+
+// ExecContext waits on the limits before executing the statement
+func (ts *throttledStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := ts.c.wait(ctx, ts.query); err != nil {
+		return nil, err
+	}
+	if e, ok := ts.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Stmt.Exec(values) // fallback for drivers without ExecContext
+}
+
+// QueryContext waits on the limits before querying with the statement
+func (ts *throttledStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ts.c.wait(ctx, ts.query); err != nil {
+		return nil, err
+	}
+	if q, ok := ts.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Stmt.Query(values) // fallback for drivers without QueryContext
+}
+
+// CheckNamedValue passes through to the real statement
+func (ts *throttledStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := ts.Stmt.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip // use database/sql's default conversion
+}
+
+// Internal helper that converts arguments for drivers that only support the legacy Exec/Query
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// Internal helper that boils a query down to its shape, so the same statement with different
+// literals gets the same fingerprint: string and number literals become "?", whitespace is
+// collapsed, and everything else is lowercased
+func statementFingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			space = b.Len() > 0
+			continue
+		case ch == '\'':
+			// Skip to the end of the string literal ('' is an escaped quote)
+			for i++; i < len(query); i++ {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			ch = '?'
+		case ch >= '0' && ch <= '9' && !isIdentChar(prevByte(query, i)):
+			// Number literal (but not a digit inside an identifier like "t1")
+			for i+1 < len(query) && (isIdentChar(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			ch = '?'
+		case ch >= 'A' && ch <= 'Z':
+			ch += 'a' - 'A'
+		}
+
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// Internal helper that returns the byte before i, or 0 at the start
+func prevByte(s string, i int) byte {
+	if i == 0 {
+		return 0
+	}
+	return s[i-1]
+}
+
+// Internal helper that reports whether ch can be part of an identifier
+func isIdentChar(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
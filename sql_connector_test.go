@@ -0,0 +1,117 @@
+package ratelimiter
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// Fake driver for testing; counts statements and returns empty results
+type fakeDriver struct{ execs int }
+
+func (d *fakeDriver) Open(string) (driver.Conn, error)             { return &fakeConn{d}, nil }
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return &fakeConn{d}, nil }
+func (d *fakeDriver) Driver() driver.Driver                        { return d }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return &fakeStmt{c.d}, nil }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *fakeConn) Commit() error                       { return nil }
+func (c *fakeConn) Rollback() error                     { return nil }
+func (c *fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	c.d.execs++
+	return driver.RowsAffected(1), nil
+}
+
+type fakeStmt struct{ d *fakeDriver }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.d.execs++
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) { return fakeRows{}, nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return nil }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+// TestThrottledConnector_Exec tests that execs are paced by the overall limit
+func TestThrottledConnector_Exec(t *testing.T) {
+	d := &fakeDriver{}
+	db := sql.OpenDB(NewThrottledConnector(d, NewTokenBucket(10, time.Second, 1)))
+	defer db.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec("UPDATE t SET x = ?", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 1 from the burst, then 2 more at 10/s
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected execs to be paced, took %v", elapsed)
+	}
+	if d.execs != 3 {
+		t.Errorf("Expected 3 execs, got %d", d.execs)
+	}
+}
+
+// TestThrottledConnector_PreparedQuery tests that queries through prepared statements are paced
+// (the fake conn has no QueryContext, so database/sql prepares every query)
+func TestThrottledConnector_PreparedQuery(t *testing.T) {
+	db := sql.OpenDB(NewThrottledConnector(&fakeDriver{}, NewTokenBucket(10, time.Second, 1)))
+	defer db.Close()
+
+	db.Query("SELECT 1") // use up the burst
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := db.QueryContext(ctx, "SELECT 1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+}
+
+// TestThrottledConnector_StatementRate tests that each statement gets its own limit
+func TestThrottledConnector_StatementRate(t *testing.T) {
+	db := sql.OpenDB(NewThrottledConnector(&fakeDriver{}, nil, WithStatementRate(1, time.Hour, 1)))
+	defer db.Close()
+
+	db.Exec("DELETE FROM a WHERE id = 1")
+
+	// Same statement with a different literal should be out of budget...
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, "delete from a where id = 2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+
+	// ...but a different statement has its own budget
+	if _, err := db.Exec("DELETE FROM b WHERE id = 1"); err != nil {
+		t.Errorf("Expected a different statement to be allowed, got: %v", err)
+	}
+}
+
+// TestStatementFingerprint tests that literals and whitespace don't change the fingerprint
+func TestStatementFingerprint(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM t1 WHERE id = 42":            "select * from t1 where id = ?",
+		"select *\n  from t1\twhere id=7":           "select * from t1 where id=?",
+		"INSERT INTO t VALUES ('it''s', 3.14, 'x')": "insert into t values (?, ?, ?)",
+	}
+	for query, want := range tests {
+		if got := statementFingerprint(query); got != want {
+			t.Errorf("statementFingerprint(%q) = %q, expected %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimiter
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsD is a MetricsSink that sends metrics over UDP in the StatsD line format, for setups that
+// don't run Prometheus. With DogStatsD on, tags are sent too ("|#tag1,tag2"); plain StatsD has no
+// tags, so they're dropped. Sends are fire-and-forget, so a missing agent never slows limiting down
+type StatsD struct {
+	mtx       sync.Mutex
+	conn      net.Conn
+	prefix    string // prepended to every metric name, e.g. "myapp."
+	dogStatsD bool   // send tags in DogStatsD format
+}
+
+// StatsD constructor; addr is the agent's UDP address (usually "127.0.0.1:8125")
+func NewStatsD(addr string, prefix string, dogStatsD bool) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsD{conn: conn, prefix: prefix, dogStatsD: dogStatsD}, nil
+}
+
+// Count sends a counter
+func (s *StatsD) Count(name string, value int64, tags []string) {
+	s.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// Timing sends a timing in milliseconds
+func (s *StatsD) Timing(name string, d time.Duration, tags []string) {
+	s.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64), "ms", tags)
+}
+
+// Close closes the connection to the agent
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+// Internal helper that formats and sends a single metric line
+func (s *StatsD) send(name string, value string, kind string, tags []string) {
+	var b strings.Builder
+	b.WriteString(s.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if s.dogStatsD && len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.conn.Write([]byte(b.String())) // fire-and-forget; a lost metric isn't worth failing over
+}
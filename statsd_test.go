@@ -0,0 +1,54 @@
+package ratelimiter
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestStatsD tests that metrics go out in StatsD/DogStatsD line format
+func TestStatsD(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	read := func() string {
+		buf := make([]byte, 512)
+		agent.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := agent.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	dog, err := NewStatsD(agent.LocalAddr().String(), "app.", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dog.Close()
+
+	dog.Count("ratelimiter.denied", 1, []string{"limiter:api", "key_class:ip"})
+	if got := read(); got != "app.ratelimiter.denied:1|c|#limiter:api,key_class:ip" {
+		t.Errorf("Unexpected counter line: %q", got)
+	}
+
+	dog.Timing("ratelimiter.wait", 1500*time.Microsecond, nil)
+	if got := read(); got != "app.ratelimiter.wait:1.5|ms" {
+		t.Errorf("Unexpected timing line: %q", got)
+	}
+
+	// Plain StatsD drops tags
+	plain, err := NewStatsD(agent.LocalAddr().String(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	plain.Count("ratelimiter.allowed", 3, []string{"limiter:api"})
+	if got := read(); got != "ratelimiter.allowed:3|c" {
+		t.Errorf("Unexpected plain counter line: %q", got)
+	}
+}
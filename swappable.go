@@ -0,0 +1,49 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Swappable wraps a RateLimiter that can be replaced at runtime (e.g. on config reload, or to switch
+// algorithms for an A/B comparison) without locking on the Allow/Wait path. Calls already in
+// progress finish on the limiter they started with; new calls go to the replacement
+type Swappable struct {
+	current atomic.Pointer[RateLimiter]
+}
+
+// Swappable constructor
+func NewSwappable(limiter RateLimiter) *Swappable {
+	s := &Swappable{}
+	s.Swap(limiter)
+	return s
+}
+
+// Implements Allow RateLimiter method on the current limiter
+// NON-BLOCKING! Returns immediately
+func (s *Swappable) Allow() bool {
+	return s.Load().Allow()
+}
+
+// Implements Wait RateLimiter method on the current limiter
+// BLOCKING!! Blocks current goroutine
+func (s *Swappable) Wait(ctx context.Context) error {
+	return s.Load().Wait(ctx)
+}
+
+// Swap replaces the current limiter and returns the old one
+func (s *Swappable) Swap(limiter RateLimiter) RateLimiter {
+	if limiter == nil {
+		panic("invalid swappable parameters")
+	}
+	old := s.current.Swap(&limiter)
+	if old == nil {
+		return nil
+	}
+	return *old
+}
+
+// Load returns the current limiter
+func (s *Swappable) Load() RateLimiter {
+	return *s.current.Load()
+}
@@ -0,0 +1,49 @@
+package ratelimiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSwappable tests that calls go to whichever limiter is current
+func TestSwappable(t *testing.T) {
+	strict := NewTokenBucket(1, time.Hour, 1)
+	loose := NewTokenBucket(1, time.Hour, 100)
+
+	s := NewSwappable(strict)
+	s.Allow()
+	if s.Allow() {
+		t.Error("Expected strict limiter to deny")
+	}
+
+	if old := s.Swap(loose); old != strict {
+		t.Error("Expected Swap to return the old limiter")
+	}
+	if !s.Allow() {
+		t.Error("Expected loose limiter to allow")
+	}
+	if s.Load() != loose {
+		t.Error("Expected Load to return the new limiter")
+	}
+}
+
+// TestSwappable_Concurrent tests swapping while other goroutines are using the limiter
+func TestSwappable_Concurrent(t *testing.T) {
+	s := NewSwappable(NewTokenBucket(1000, time.Second, 1000))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Allow()
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		s.Swap(NewTokenBucket(1000, time.Second, 1000))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,106 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Largest chunk we write in one go, so throttled output trickles out smoothly instead of in big bursts
+const maxThrottledChunk = 32 * 1024
+
+// ThrottledResponseWriter wraps an http.ResponseWriter and limits how many bytes per second can be
+// written through it. Every write has to get past all of its limiters, so one bucket can cap this
+// response while another (shared) bucket caps everything a client downloads at once
+type ThrottledResponseWriter struct {
+	http.ResponseWriter
+	ctx      context.Context // usually the request context, so we stop waiting when the client goes away
+	limiters []func() *TokenBucket
+}
+
+// ThrottledResponseWriter constructor; each limiter is a byte budget (1 token = 1 byte)
+func NewThrottledResponseWriter(ctx context.Context, w http.ResponseWriter, limiters ...*TokenBucket) *ThrottledResponseWriter {
+	tw := &ThrottledResponseWriter{ResponseWriter: w, ctx: ctx}
+	for _, tb := range limiters {
+		tw.limiters = append(tw.limiters, func() *TokenBucket { return tb })
+	}
+	return tw
+}
+
+// Write blocks until the byte budgets allow p to go out, writing it in chunks no bigger than
+// the smallest bucket so large bodies get paced instead of rejected
+// BLOCKING!! Blocks current goroutine
+func (tw *ThrottledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Grab the current buckets; shared ones are looked up again each time so they stay alive
+		buckets := make([]*TokenBucket, len(tw.limiters))
+		chunk := min(len(p), maxThrottledChunk)
+		for i, limiter := range tw.limiters {
+			buckets[i] = limiter()
+			chunk = min(chunk, int(buckets[i].capacity()))
+		}
+
+		for i, tb := range buckets {
+			if err := tb.WaitN(tw.ctx, float64(chunk)); err != nil {
+				// Give back what the earlier buckets handed out for a chunk that isn't going out
+				for _, taken := range buckets[:i] {
+					taken.refund(float64(chunk))
+				}
+				return written, err
+			}
+		}
+
+		n, err := tw.ResponseWriter.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+	return written, nil
+}
+
+// Flush passes through to the underlying writer if it supports flushing
+func (tw *ThrottledResponseWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer so http.ResponseController can reach it
+func (tw *ThrottledResponseWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// ThrottleWrites is middleware that limits response bodies to perResponse bytes per second each,
+// and (if key is non-nil) to perClient bytes per second in total across all of a client's
+// responses, so one user's parallel downloads can't hog all of our bandwidth. Pass 0 to skip a limit
+func ThrottleWrites(next http.Handler, perResponse int, perClient int, key KeyFunc) http.Handler {
+	if perResponse < 0 || perClient < 0 || (perClient > 0 && key == nil) {
+		panic("invalid throttle parameters")
+	}
+
+	// Clients that stop downloading for a minute get forgotten; their bucket would be full again by then anyway
+	var clients *keyedBuckets
+	if perClient > 0 {
+		clients = newKeyedBuckets(time.Minute, func(string) *TokenBucket {
+			return NewTokenBucket(perClient, time.Second, perClient)
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &ThrottledResponseWriter{ResponseWriter: w, ctx: r.Context()}
+
+		if perResponse > 0 {
+			tb := NewTokenBucket(perResponse, time.Second, perResponse)
+			tw.limiters = append(tw.limiters, func() *TokenBucket { return tb })
+		}
+		if clients != nil {
+			id := key(r)
+			tw.limiters = append(tw.limiters, func() *TokenBucket { return clients.get(id) })
+		}
+
+		next.ServeHTTP(tw, r)
+	})
+}
@@ -0,0 +1,109 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestThrottledResponseWriter_Paces tests that writes are held back to the configured byte rate
+func TestThrottledResponseWriter_Paces(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	// 1000 bytes per second with a 100 byte bucket; 300 bytes needs ~200ms after the initial 100
+	tw := NewThrottledResponseWriter(context.Background(), rec, NewTokenBucket(1000, time.Second, 100))
+
+	start := time.Now()
+	n, err := tw.Write(bytes.Repeat([]byte("x"), 300))
+	elapsed := time.Since(start)
+
+	if err != nil || n != 300 {
+		t.Fatalf("Write() = %d, %v; expected 300, nil", n, err)
+	}
+	if rec.Body.Len() != 300 {
+		t.Errorf("Expected 300 bytes in the response, got %d", rec.Body.Len())
+	}
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("Write() returned too quickly: %v", elapsed)
+	}
+}
+
+// TestThrottledResponseWriter_ContextCancel tests that a gone client stops the write
+func TestThrottledResponseWriter_ContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// 10 bytes per second, so 100 bytes would take ages
+	tw := NewThrottledResponseWriter(ctx, httptest.NewRecorder(), NewTokenBucket(10, time.Second, 10))
+
+	n, err := tw.Write(bytes.Repeat([]byte("x"), 100))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
+	}
+	if n != 10 {
+		t.Errorf("Expected the first 10 bytes to be written before giving up, got %d", n)
+	}
+}
+
+// TestThrottledResponseWriter_RefundsOnFailure tests that a chunk that doesn't go out doesn't cost the earlier buckets
+func TestThrottledResponseWriter_RefundsOnFailure(t *testing.T) {
+	shared := NewTokenBucket(1, time.Hour, 100)
+	closed := NewTokenBucket(1, time.Hour, 100)
+	closed.Close(context.Background())
+
+	tw := NewThrottledResponseWriter(context.Background(), httptest.NewRecorder(), shared, closed)
+	if _, err := tw.Write(bytes.Repeat([]byte("x"), 50)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got: %v", err)
+	}
+	if tokens := shared.Tokens(); tokens < 100 {
+		t.Errorf("Expected the shared bucket to get its tokens back, has %v", tokens)
+	}
+}
+
+// TestThrottleWrites_PerClientAggregate tests that parallel responses for one client share a budget
+func TestThrottleWrites_PerClientAggregate(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 200)
+	handler := ThrottleWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}), 0, 1000, ClientIP)
+
+	// Two parallel 200 byte downloads from the same client = 400 bytes against a 1000 bytes/sec budget
+	// that starts with 1000 bytes in it, so first they should go through without delay...
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+	wg.Wait()
+
+	// ...but after 1000 total bytes the client's budget is empty and a third download must wait
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:5678"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:9999"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected client's shared budget to slow down the download, took %v", elapsed)
+	}
+
+	// A different client has its own budget and isn't slowed down
+	start = time.Now()
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected other client to be unaffected, took %v", elapsed)
+	}
+}
@@ -0,0 +1,32 @@
+package ratelimiter
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// Ticks returns an iterator that yields the current time every time the limiter allows an event,
+// until the context is done, so a loop can be throttled with a single range statement:
+//
+//	for range ratelimiter.Ticks(ctx, limiter) {
+//		// do rate limited work
+//	}
+//
+// Check ctx.Err() after the loop to tell whether it ended because the context was cancelled
+// BLOCKING!! Blocks current goroutine while waiting between ticks
+func Ticks(ctx context.Context, limiter RateLimiter) iter.Seq[time.Time] {
+	return func(yield func(time.Time) bool) {
+		for limiter.Wait(ctx) == nil {
+			if !yield(time.Now()) {
+				return
+			}
+		}
+	}
+}
+
+// Ticks returns an iterator that yields at the pace this bucket allows until the context is done.
+// See the package level Ticks
+func (tb *TokenBucket) Ticks(ctx context.Context) iter.Seq[time.Time] {
+	return Ticks(ctx, tb)
+}
@@ -0,0 +1,45 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestTicks_Paced tests that ticks come at the limiter's pace
+func TestTicks_Paced(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 1)
+
+	start := time.Now()
+	count := 0
+	for range tb.Ticks(context.Background()) {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+
+	// 1 from the burst, then 2 more at 10/s
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected ticks to be paced, took %v", elapsed)
+	}
+}
+
+// TestTicks_ContextCancelled tests that the iterator ends once the context is done
+func TestTicks_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	count := 0
+	for range Ticks(ctx, NewTokenBucket(10, time.Second, 1)) {
+		count++
+	}
+
+	// 1 from the burst, then about 2 more before the context times out
+	if count < 2 || count > 4 {
+		t.Errorf("Expected about 3 ticks before cancellation, got %d", count)
+	}
+	if ctx.Err() == nil {
+		t.Error("Expected the loop to end because of the context")
+	}
+}
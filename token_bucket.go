@@ -2,6 +2,7 @@ package ratelimiter
 
 import (
 	"context"
+	"math/rand/v2"
 	"sync"
 	"time"
 )
@@ -13,11 +14,129 @@ type TokenBucket struct {
 	max_tokens  float64    // maximum token capacity for our bucket; using float64 instead of int just to prevent the need of casting in the math later
 	tokens      float64    // current count of available tokens; using float64 since our rate will refill the tokens fractionally
 	lastUpdated time.Time  // last time tokens were updated
+
+	reservations    map[ReservationID]float64 // outstanding Reserve charges waiting to be committed
+	nextReservation ReservationID             // last reservation ID handed out
+
+	deadlineCheck bool    // fail Wait right away if it can't be served before the context deadline
+	earlyReject   float64 // fill level below which Allow starts randomly rejecting; 0 means off
+	codel         *codel  // CoDel queue management for waiters; nil means off
+	slack         float64 // most seconds of missed refill we'll credit at once; 0 means no cap
+	borrowLimit   float64 // most tokens we'll lend against future refill; 0 means no borrowing
+	borrowed      float64 // tokens lent out that refill hasn't paid back yet (not counting Commit debt)
+
+	paused     chan struct{} // non-nil while paused; closed on Resume to wake queued waiters
+	pauseQueue bool          // Wait blocks while paused instead of failing with ErrPaused
+
+	dispatch *waitDispatch // single dispatcher serving Wait in order; nil means every waiter polls on its own
+	aging    time.Duration // how long a queued waiter waits to gain a priority level; 0 means no aging
+
+	warmup   time.Duration // how long the rate takes to ramp up after startup or idling; 0 means no warm-up
+	warmFrom time.Time     // when the current warm-up started
+
+	meterOnly    bool  // never deny or delay, just count what would have happened
+	meterAllowed int64 // requests that would have been allowed in meter only mode
+	meterDenied  int64 // requests that would have been denied in meter only mode
+
+	closing bool          // Close was called; no new requests are let in
+	drained chan struct{} // closed once the last waiter leaves after Close; nil if nobody's watching
+	abort   chan struct{} // closed when Close gives up on draining, failing the remaining waiters
+
+	waiters     int     // number of goroutines currently blocked in Wait
+	waitingCost float64 // total tokens those blocked goroutines are waiting for
+}
+
+// TokenBucketOption configures optional TokenBucket behavior at construction time
+type TokenBucketOption func(*TokenBucket)
+
+// WithDeadlineCheck makes Wait compare how long it would have to wait against the context's deadline,
+// and fail right away with ErrWouldExceedDeadline instead of burning the caller's whole deadline
+// in a wait that can't succeed anyway
+func WithDeadlineCheck() TokenBucketOption {
+	return func(tb *TokenBucket) {
+		tb.deadlineCheck = true
+	}
+}
+
+// WithEarlyRejection makes Allow start rejecting a growing fraction of requests once the bucket is
+// less than minFill full (e.g. 0.2 for 20%), going from 0% rejected at minFill up to 100% when empty.
+// Like RED in network queues, this smooths out the hard cliff at zero so clients don't all get
+// rejected at once and then retry in a synchronized burst right at refill. Wait isn't affected
+func WithEarlyRejection(minFill float64) TokenBucketOption {
+	if minFill <= 0 || minFill > 1 {
+		panic("invalid rate limiter parameters")
+	}
+	return func(tb *TokenBucket) {
+		tb.earlyReject = minFill
+	}
+}
+
+// WithSlack bounds how much missed time the bucket catches up on at once: however long it's been since
+// the last refill (a GC pause, a scheduler hiccup, a stalled process), at most d worth of tokens get
+// credited, so a briefly stalled process doesn't come back with a compensating burst. Like a ticker's
+// slack, this can't tell a stall from being idle, so after a quiet spell the bucket also only has
+// d worth of tokens more than it had before, and fills up the rest of the way at the normal rate
+func WithSlack(d time.Duration) TokenBucketOption {
+	if d <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+	return func(tb *TokenBucket) {
+		tb.slack = d.Seconds()
+	}
+}
+
+// WithPauseQueueing makes Wait block while the bucket is paused (until Resume or the context ends)
+// instead of failing right away with ErrPaused
+func WithPauseQueueing() TokenBucketOption {
+	return func(tb *TokenBucket) {
+		tb.pauseQueue = true
+	}
+}
+
+// WithBorrowing lets a request that's slightly short borrow up to k tokens against upcoming refill,
+// putting the bucket briefly below zero, instead of being rejected when it would have fit a few
+// milliseconds later. The bucket never goes more than k below zero by borrowing, even if it's already
+// in debt from Commit, and Borrowed reports the borrowed part separately from that debt
+func WithBorrowing(k float64) TokenBucketOption {
+	if k <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+	return func(tb *TokenBucket) {
+		tb.borrowLimit = k
+	}
+}
+
+// How much lower than the configured rate a cold bucket starts out with WithWarmup, like Guava's default
+const warmupColdFactor = 3.0
+
+// WithWarmup makes the bucket ease into its rate after startup, or after sitting idle for a whole
+// period: both the rate and the burst start out at a third of the configured values and ramp up
+// linearly to the full values over period, like Guava's SmoothWarmingUp. Useful when downstream
+// caches are cold after a deploy and can't take full rate traffic right away
+func WithWarmup(period time.Duration) TokenBucketOption {
+	if period <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+	return func(tb *TokenBucket) {
+		tb.warmup = period
+		tb.warmFrom = tb.lastUpdated
+		tb.tokens = tb.max_tokens / warmupColdFactor
+	}
+}
+
+// WithMeterOnly turns the bucket into a meter: Allow and Wait always let requests through right away,
+// but tokens are still accounted for as if the limit were enforced, and Meter reports how many requests
+// would have been allowed and how many denied. Useful for usage based billing, or for seeing what a
+// limit would do to real traffic before turning it on
+func WithMeterOnly() TokenBucketOption {
+	return func(tb *TokenBucket) {
+		tb.meterOnly = true
+	}
 }
 
 // TokenBucket constructor; allows us to pass in any rate we want, and then standardizes it
 // to the rate per second
-func NewTokenBucket(maxOps int, per time.Duration, maxBucketSize int) *TokenBucket {
+func NewTokenBucket(maxOps int, per time.Duration, maxBucketSize int, opts ...TokenBucketOption) *TokenBucket {
 	// Validation to ensure parameters are valid
 	if maxOps <= 0 || per <= 0 || maxBucketSize <= 0 {
 		panic("invalid rate limiter parameters")
@@ -26,18 +145,33 @@ func NewTokenBucket(maxOps int, per time.Duration, maxBucketSize int) *TokenBuck
 	// Standardize rate
 	rate := float64(maxOps) / per.Seconds()
 
-	return &TokenBucket{
+	tb := &TokenBucket{
 		rate:        rate,
 		max_tokens:  float64(maxBucketSize),
 		tokens:      float64(maxBucketSize),
 		lastUpdated: time.Now(),
+		abort:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(tb)
 	}
+	return tb
 }
 
 // Implements Allow RateLimiter method to determine whether we allow or deny incoming event/request
 // Returns true if we have available tokens, and false if no tokens are available (bucket is empty)
 // NON-BLOCKING! Returns immediately
 func (tb *TokenBucket) Allow() bool {
+	return tb.AllowN(1)
+}
+
+// AllowN is like Allow, but for an event/request that costs n tokens instead of 1. Panics on a negative n
+// NON-BLOCKING! Returns immediately
+func (tb *TokenBucket) AllowN(n float64) bool {
+	if n < 0 {
+		panic("invalid rate limiter parameters") // would add tokens instead of taking them
+	}
+
 	// First, we establish our lock + unlock mechanism for concurrency safety
 	tb.mtx.Lock()
 	defer tb.mtx.Unlock() // ensures we don't accidentally forget to unlock somewhere
@@ -45,59 +179,559 @@ func (tb *TokenBucket) Allow() bool {
 	// Next, refill bucket to ensure we're up to date on the current token state
 	tb.refillBucket()
 
-	// Check if we have enough tokens in our bucket for our event/request in the bucket -- we need at least 1 full token
-	if tb.tokens >= 1 {
-		tb.tokens-- // use up 1 token
+	// In meter only mode, just count it
+	if tb.meterOnly {
+		tb.meter(n)
 		return true
 	}
-	return false
+
+	// Check if we have enough tokens in our bucket for our event/request in the bucket (nothing gets through while paused or closed)
+	if !tb.fits(n) || tb.paused != nil || tb.closing {
+		return false
+	}
+
+	// With a wait dispatcher, don't jump ahead of anyone queued in Wait
+	if tb.dispatch != nil && tb.waiters > 0 {
+		return false
+	}
+
+	// If early rejection is on and we're running low, reject with a probability that grows as we drain
+	if fill := tb.tokens / tb.max_tokens; fill < tb.earlyReject {
+		if rand.Float64() < (tb.earlyReject-fill)/tb.earlyReject {
+			return false
+		}
+	}
+
+	tb.take(n) // use up n tokens
+	return true
 }
 
 // Implements Wait RateLimiter method which blocks an event/request until we have enough capacity
 // It returns an error if the context is canceled
 // BLOCKING!! Blocks current goroutine
 func (tb *TokenBucket) Wait(ctx context.Context) error {
+	return tb.WaitN(ctx, 1)
+}
+
+// WaitN is like Wait, but for an event/request that costs n tokens instead of 1
+// Returns ErrBurstExceeded right away if n is more than the bucket can ever hold, ErrClosed once the
+// bucket is closed, and ErrWaitCancelled or ErrWaitDeadline if the context ends first. Panics on a negative n
+// BLOCKING!! Blocks current goroutine
+func (tb *TokenBucket) WaitN(ctx context.Context, n float64) error {
+	if n < 0 {
+		panic("invalid rate limiter parameters") // would add tokens instead of taking them
+	}
+	return tb.wait(ctx, n, 0)
+}
+
+// WaitPriority is like Wait, but waiters with a higher priority are handed newly refilled tokens
+// before those with a lower one (plain Wait is priority 0), e.g. so health checks don't queue up
+// behind bulk traffic. Waiters with the same priority are served in arrival order (see WithPriorityAging
+// to keep lower priorities from starving). The first call switches the bucket over to dispatching every
+// Wait from one queue, as with WithWaitDispatcher
+// BLOCKING!! Blocks current goroutine
+func (tb *TokenBucket) WaitPriority(ctx context.Context, priority int) error {
+	return tb.wait(ctx, 1, priority)
+}
+
+// Internal helper implementing WaitN and WaitPriority; with a delay budget in the context, the wait
+// gets cut short before going over it
+func (tb *TokenBucket) wait(ctx context.Context, n float64, priority int) error {
+	allow := func() bool { return tb.AllowN(n) }
+	wait := func(ctx context.Context) error { return tb.waitN(ctx, n, priority) }
+	if ok, err := waitWithinBudget(ctx, allow, wait); ok {
+		return err
+	}
+	return tb.waitN(ctx, n, priority)
+}
+
+// Internal helper doing the actual waiting, once any delay budget has been applied
+func (tb *TokenBucket) waitN(ctx context.Context, n float64, priority int) error {
+	// Don't bother taking the lock if the caller has already given up
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+	if tb.meterOnly {
+		tb.mtx.Lock()
+		tb.refillBucket()
+		tb.meter(n)
+		tb.mtx.Unlock()
+		return nil
+	}
+
+	// Priorities need everyone in one queue, so the first prioritized waiter starts up the dispatcher
+	tb.mtx.Lock()
+	if n > tb.max_tokens {
+		tb.mtx.Unlock()
+		return ErrBurstExceeded
+	}
+	if priority != 0 && tb.dispatch == nil {
+		tb.dispatch = newWaitDispatch()
+	}
+	dispatched := tb.dispatch != nil
+	tb.mtx.Unlock()
+	if dispatched {
+		return tb.waitDispatched(ctx, n, priority)
+	}
+
+	// Once we have to wait, we count ourselves as a waiter until we're done so the queue can be inspected
+	queued := false
+	enqueued := time.Now()
+	defer func() {
+		if queued {
+			tb.mtx.Lock()
+			tb.dequeue(n)
+			tb.mtx.Unlock()
+		}
+	}()
+
 	for {
-		// Try to get a token
+		// Try to get the tokens
 		tb.mtx.Lock()
 		tb.refillBucket()
 
-		if tb.tokens >= 1 {
-			tb.tokens--
+		// Once closed, only those already waiting get to finish
+		if tb.closing && !queued {
+			tb.mtx.Unlock()
+			return ErrClosed
+		}
+
+		// The capacity may have been lowered (e.g. by an adaptive limiter) since we started waiting
+		if n > tb.max_tokens {
 			tb.mtx.Unlock()
-			return nil // Success! Token acquired
+			return ErrBurstExceeded
 		}
 
-		// Otherwise, no token available - calculate how long to wait
-		tokensNeeded := 1.0 - tb.tokens
+		// If WaitPriority started up a dispatcher in the meantime, join its queue instead of competing with it
+		if tb.dispatch != nil && !tb.closing {
+			if queued {
+				queued = false
+				tb.dequeue(n)
+			}
+			tb.mtx.Unlock()
+			return tb.waitDispatched(ctx, n, priority)
+		}
+
+		// While paused, either fail right away or sit tight until we're resumed
+		if paused := tb.paused; paused != nil {
+			if !tb.pauseQueue {
+				tb.mtx.Unlock()
+				return ErrPaused
+			}
+			if !queued {
+				queued = true
+				tb.waiters++
+				tb.waitingCost += n
+			}
+			tb.mtx.Unlock()
+			select {
+			case <-paused:
+				continue
+			case <-tb.abort:
+				return ErrClosed
+			case <-ctx.Done():
+				return waitError(ctx)
+			}
+		}
+
+		if tb.fits(n) {
+			// With CoDel on, waiters that sat in the queue too long may get shed instead of served
+			if tb.codel != nil && tb.codel.shouldDrop(time.Now(), time.Since(enqueued)) {
+				tb.mtx.Unlock()
+				return ErrWaitShed
+			}
+
+			tb.take(n)
+			tb.mtx.Unlock()
+			return nil // Success! Tokens acquired
+		}
+
+		// Otherwise, not enough tokens available - calculate how long to wait
+		tokensNeeded := n - tb.tokens - tb.borrowLimit
 		waitDuration := time.Duration(tokensNeeded / tb.rate * float64(time.Second))
+		if !queued {
+			queued = true
+			tb.waiters++
+			tb.waitingCost += n
+		}
 		tb.mtx.Unlock() // unlock here so other goroutines can access rate limiter if needed
 
+		// If we're never going to make it before the deadline, don't bother waiting
+		if deadline, ok := ctx.Deadline(); ok && tb.deadlineCheck && time.Until(deadline) < waitDuration {
+			return ErrWouldExceedDeadline
+		}
+
 		// Wait for that duration OR context cancellation
 		select {
 		case <-time.After(waitDuration):
-			// Time passed, loop again to try acquiring token
+			// Time passed, loop again to try acquiring tokens
 			continue
+		case <-tb.abort:
+			// Closed and done draining
+			return ErrClosed
 		case <-ctx.Done():
-			// Context cancelled - return error
-			return ctx.Err()
+			// Context cancelled - return error saying why
+			return waitError(ctx)
 		}
 	}
 }
 
-// Internal helper function to add token capacity to bucket based on our refill rate until max capacity is hit
+// EstimatedWait returns roughly how long a request costing n tokens would have to wait if it
+// queued up right now, behind everyone already waiting. Useful for telling clients about expected
+// delays before they commit, or for health checks reporting saturation. Counts what the bucket may
+// borrow, and while warming up assumes the current (reduced) rate, so it errs on the long side
+func (tb *TokenBucket) EstimatedWait(n float64) time.Duration {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	tb.refillBucket()
+
+	// Everyone already waiting gets served first, then us
+	tokensNeeded := tb.waitingCost + n - tb.tokens - tb.borrowLimit
+	if tokensNeeded <= 0 {
+		return 0
+	}
+	return time.Duration(tokensNeeded / (tb.rate * tb.warmupFactor(time.Now())) * float64(time.Second))
+}
+
+// Tokens returns how many tokens are in the bucket right now, e.g. for reporting the remaining budget
+func (tb *TokenBucket) Tokens() float64 {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	tb.refillBucket()
+	return tb.tokens
+}
+
+// Waiters returns how many goroutines are currently blocked in Wait on this bucket
+func (tb *TokenBucket) Waiters() int {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+	return tb.waiters
+}
+
+// Pause freezes the bucket: refilling stops and every request is rejected (Wait fails with ErrPaused,
+// or blocks until Resume with WithPauseQueueing), e.g. while a downstream dependency is down for
+// maintenance. Pausing an already paused bucket does nothing
+func (tb *TokenBucket) Pause() {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	if tb.paused == nil {
+		tb.refillBucket() // credit whatever was earned up to now
+		tb.paused = make(chan struct{})
+	}
+}
+
+// Resume unfreezes a paused bucket. It picks up with the tokens it had when it was paused, rather than
+// a bucket full of tokens built up during the pause, and wakes any queued waiters
+func (tb *TokenBucket) Resume() {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	if tb.paused != nil {
+		close(tb.paused)
+		tb.paused = nil
+		tb.lastUpdated = time.Now()
+	}
+}
+
+// Paused returns true if the bucket is currently paused
+func (tb *TokenBucket) Paused() bool {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+	return tb.paused != nil
+}
+
+// Borrowed returns how many tokens have been borrowed against future refill and not paid back yet
+func (tb *TokenBucket) Borrowed() float64 {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	tb.refillBucket()
+	return tb.borrowed
+}
+
+// Meter returns how many requests the bucket would have allowed and denied so far in meter only mode
+func (tb *TokenBucket) Meter() (allowed int64, denied int64) {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+	return tb.meterAllowed, tb.meterDenied
+}
+
+// Close stops the bucket from letting in anything new: Allow returns false and Wait fails with ErrClosed
+// from now on. Goroutines already blocked in Wait still get served as tokens come in, until ctx ends;
+// any still waiting then fail with ErrClosed too, and Close returns the context's error. Returns nil
+// once every waiter has left. Pass an already cancelled context to fail all waiters right away
+// BLOCKING!! Blocks current goroutine
+func (tb *TokenBucket) Close(ctx context.Context) error {
+	tb.mtx.Lock()
+	tb.closing = true
+	if tb.waiters == 0 {
+		tb.mtx.Unlock()
+		return nil
+	}
+	if tb.drained == nil {
+		tb.drained = make(chan struct{})
+	}
+	drained := tb.drained
+	tb.mtx.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	tb.mtx.Lock()
+	select {
+	case <-tb.abort:
+	default:
+		close(tb.abort)
+	}
+	if tb.dispatch != nil {
+		tb.dispatch.nudge()
+	}
+	tb.mtx.Unlock()
+
+	<-drained
+	return ctx.Err()
+}
+
+// Internal helper that takes a waiter off the books once it's done waiting, and lets Close know
+// when the last one has left
+// Caller must hold the lock
+func (tb *TokenBucket) dequeue(n float64) {
+	tb.waiters--
+	tb.waitingCost -= n
+	if tb.waiters == 0 && tb.drained != nil {
+		close(tb.drained)
+		tb.drained = nil
+	}
+}
+
+// Internal helper that records a request in meter only mode, taking its tokens if enforcing the
+// limit would have let it through
+// Caller must hold the lock
+func (tb *TokenBucket) meter(n float64) {
+	if !tb.fits(n) {
+		tb.meterDenied++
+		return
+	}
+	tb.take(n)
+	tb.meterAllowed++
+}
+
+// Internal helper that reports whether n tokens can be taken, counting what we're allowed to borrow
+// Caller must hold the lock
+func (tb *TokenBucket) fits(n float64) bool {
+	return tb.tokens+tb.borrowLimit >= n
+}
+
+// Internal helper that takes n tokens, borrowing whatever part of them the bucket doesn't have
+// Caller must hold the lock
+func (tb *TokenBucket) take(n float64) {
+	tb.borrowed += n - max(min(tb.tokens, n), 0)
+	tb.tokens -= n
+}
+
+// Outcome of tryTakeMulti, for the Allow and Wait methods of limiters that combine several buckets
+type takeResult struct {
+	ok   bool            // the tokens were taken
+	wait time.Duration   // otherwise, how long until it's worth trying again
+	wake <-chan struct{} // or, if set, try again once this is closed instead (e.g. on Resume)
+	err  error           // or why there's no point trying again (ErrPaused, ErrClosed, ErrBurstExceeded)
+}
+
+// Internal helper that takes costs[i] tokens from buckets[i] for all of the buckets at once, or nothing if
+// any of them can't cover its cost right now. Each bucket follows the same rules as AllowN (borrowing,
+// warm-up, pausing, closing, meter only mode, and not cutting in front of the wait dispatcher's queue),
+// so limiters built out of several buckets don't have to reach into them. Locks the buckets in the order
+// given, so callers must always pass them in the same order
+func tryTakeMulti(buckets []*TokenBucket, costs []float64) takeResult {
+	for _, tb := range buckets {
+		tb.mtx.Lock()
+		defer tb.mtx.Unlock()
+	}
+
+	var r takeResult
+	short := false
+	for i, tb := range buckets {
+		tb.refillBucket()
+		n := costs[i]
+
+		switch {
+		case tb.meterOnly:
+			continue // never holds anything up, only counted once everything else fits
+		case n > tb.max_tokens:
+			return takeResult{err: ErrBurstExceeded}
+		case tb.closing:
+			return takeResult{err: ErrClosed}
+		case tb.paused != nil && !tb.pauseQueue:
+			return takeResult{err: ErrPaused}
+		case tb.paused != nil:
+			r.wake = tb.paused
+			continue
+		}
+
+		// Anyone queued in the wait dispatcher goes first
+		queued := 0.0
+		if tb.dispatch != nil && tb.waiters > 0 {
+			queued = tb.waitingCost
+			short = true
+		}
+		if needed := queued + n - tb.tokens - tb.borrowLimit; needed > 0 {
+			r.wait = max(r.wait, time.Duration(needed/tb.rate*float64(time.Second)))
+			short = true
+		}
+	}
+	if short || r.wake != nil {
+		return r
+	}
+
+	for i, tb := range buckets {
+		if tb.meterOnly {
+			tb.meter(costs[i])
+		} else {
+			tb.take(costs[i])
+		}
+	}
+	return takeResult{ok: true}
+}
+
+// Internal helper that blocks until take (tryTakeMulti, or something wrapped around it) gets its tokens,
+// sleeping for as long as each failed attempt says to. With a delay budget in the context, the wait gets
+// cut short before going over it
+func waitMulti(ctx context.Context, take func() takeResult) error {
+	if ctx.Err() != nil {
+		return waitError(ctx)
+	}
+
+	allow := func() bool { return take().ok }
+	wait := func(ctx context.Context) error {
+		for {
+			r := take()
+			if r.ok || r.err != nil {
+				return r.err
+			}
+
+			var timer <-chan time.Time
+			if r.wake == nil {
+				timer = time.After(r.wait)
+			}
+
+			select {
+			case <-timer:
+				continue
+			case <-r.wake:
+				continue
+			case <-ctx.Done():
+				return waitError(ctx)
+			}
+		}
+	}
+	if ok, err := waitWithinBudget(ctx, allow, wait); ok {
+		return err
+	}
+	return wait(ctx)
+}
+
+// Internal helper to change the refill rate and capacity on the fly. Tokens earned at the
+// old rate are credited first so the change only applies going forward
+func (tb *TokenBucket) setRate(rate float64, maxTokens float64) {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	tb.refillBucket()
+	tb.rate = rate
+	tb.max_tokens = maxTokens
+	if tb.tokens > tb.max_tokens {
+		tb.tokens = tb.max_tokens
+	}
+}
+
+// Internal helper that returns the bucket's current capacity, for callers outside the lock
+// that need it (e.g. to change the rate while keeping the capacity)
+func (tb *TokenBucket) capacity() float64 {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+	return tb.max_tokens
+}
+
+// Internal helper that takes n tokens whether or not the bucket has them, putting it in debt if need be,
+// for usage that has already been let through by some other limit
+func (tb *TokenBucket) charge(n float64) {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	tb.refillBucket()
+	tb.tokens -= n
+}
+
+// Internal helper that gives tokens back to the bucket (capped at max capacity), for when
+// tokens were taken on behalf of someone who no longer needs them
+func (tb *TokenBucket) refund(n float64) {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+
+	tb.refillBucket()
+	tb.tokens = min(tb.tokens+n, tb.max_tokens)
+}
+
+// Internal helper that returns the fraction of the full rate and capacity available at now; 1 unless
+// the bucket is warming up
+// Caller must hold the lock
+func (tb *TokenBucket) warmupFactor(now time.Time) float64 {
+	if tb.warmup <= 0 {
+		return 1
+	}
+	warmed := min(now.Sub(tb.warmFrom).Seconds()/tb.warmup.Seconds(), 1)
+	return 1/warmupColdFactor + (1-1/warmupColdFactor)*warmed
+}
+
+// Internal helper function to add token capacity to bucket based on our refill rate until max capacity is hit.
+// time.Now() carries a monotonic clock reading, so the elapsed time isn't thrown off by NTP steps or
+// the wall clock being changed. If a time without a monotonic reading ever ends up in lastUpdated
+// (e.g. one that went through Round(0) or serialization), a backward wall clock jump is treated as
+// no time passing rather than taking tokens away, and a forward jump can at most fill the bucket
 func (tb *TokenBucket) refillBucket() {
 	// Figure out elapsed time since last event/request
 	now := time.Now()
-	elapsed := now.Sub(tb.lastUpdated).Seconds()
+	if tb.paused != nil {
+		tb.lastUpdated = now // nothing accrues while paused
+		return
+	}
+	elapsed := max(0, now.Sub(tb.lastUpdated).Seconds())
+	idle := elapsed
+
+	// With slack set, don't make up for more than that much missed time in one go
+	if tb.slack > 0 && elapsed > tb.slack {
+		elapsed = tb.slack
+	}
+
+	// While warming up, only a fraction of the rate and capacity are available
+	rate, maxTokens := tb.rate, tb.max_tokens
+	if tb.warmup > 0 {
+		// Idle for a whole warm-up period; downstream has gone cold again. Uses the real idle time,
+		// since slack only limits how much of it is refilled
+		if idle >= tb.warmup.Seconds() {
+			tb.warmFrom = now
+		}
+
+		factor := tb.warmupFactor(now)
+		rate, maxTokens = rate*factor, maxTokens*factor
+	}
 
 	// Add tokens based on elapsed time using our rate
-	tb.tokens += elapsed * tb.rate
+	tb.tokens += elapsed * rate
 
 	// Cap at max token/bucket limit
-	if tb.tokens > tb.max_tokens {
-		tb.tokens = tb.max_tokens
+	if tb.tokens > maxTokens {
+		tb.tokens = maxTokens
 	}
 
+	// Refill pays back borrowed tokens first
+	tb.borrowed = min(tb.borrowed, max(0, -tb.tokens))
+
 	tb.lastUpdated = now
 }
@@ -2,6 +2,7 @@ package ratelimiter
 
 import (
 	"context"
+	"errors"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -119,7 +120,7 @@ func TestWait_ContextCancellation(t *testing.T) {
 		t.Error("Expected Wait() to return error when context is cancelled")
 	}
 
-	if err != context.DeadlineExceeded {
+	if !errors.Is(err, context.DeadlineExceeded) {
 		t.Errorf("Expected DeadlineExceeded error, got: %v", err)
 	}
 }
@@ -237,3 +238,542 @@ func TestMultipleInstances_IndependentRefill(t *testing.T) {
 		t.Error("Slow bucket should have refilled by now")
 	}
 }
+
+// TestAllowN tests that multi-token requests consume the right amount
+func TestAllowN(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10)
+
+	if !tb.AllowN(7) {
+		t.Fatal("Expected AllowN(7) to succeed on a full bucket of 10")
+	}
+	if tb.AllowN(4) {
+		t.Error("Expected AllowN(4) to fail with 3 tokens left")
+	}
+	if !tb.AllowN(3) {
+		t.Error("Expected AllowN(3) to use up the remaining tokens")
+	}
+}
+
+// TestAllowN_NegativeCost tests that negative costs panic instead of overfilling the bucket
+func TestAllowN_NegativeCost(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 1)
+	for name, call := range map[string]func(){
+		"AllowN": func() { tb.AllowN(-5) },
+		"WaitN":  func() { tb.WaitN(context.Background(), -5) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected %s with a negative cost to panic", name)
+				}
+			}()
+			call()
+		}()
+	}
+}
+
+// TestWaitN_BurstExceeded tests that WaitN fails right away for costs bigger than the bucket
+func TestWaitN_BurstExceeded(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 5)
+
+	if err := tb.WaitN(context.Background(), 6); err != ErrBurstExceeded {
+		t.Errorf("Expected ErrBurstExceeded, got: %v", err)
+	}
+}
+
+// TestWait_DeadlineCheck tests that Wait fails fast when it can't be served before the deadline
+func TestWait_DeadlineCheck(t *testing.T) {
+	// 1 token per 10 seconds, so the next token is way past our deadline
+	tb := NewTokenBucket(1, 10*time.Second, 1, WithDeadlineCheck())
+	tb.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := tb.Wait(ctx)
+
+	if err != ErrWouldExceedDeadline {
+		t.Errorf("Expected ErrWouldExceedDeadline, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected Wait() to fail fast, took %v", elapsed)
+	}
+}
+
+// TestWait_DeadlineCheckWithinDeadline tests that Wait still waits when the deadline leaves enough time
+func TestWait_DeadlineCheckWithinDeadline(t *testing.T) {
+	// 10 tokens per second, so the next token is ~100ms away
+	tb := NewTokenBucket(10, time.Second, 1, WithDeadlineCheck())
+	tb.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := tb.Wait(ctx); err != nil {
+		t.Errorf("Wait() returned error: %v", err)
+	}
+}
+
+// TestEstimatedWait tests that the estimate accounts for missing tokens and waiters ahead of us
+func TestEstimatedWait(t *testing.T) {
+	// 10 tokens per second with 1 token of capacity
+	tb := NewTokenBucket(10, time.Second, 1)
+
+	if wait := tb.EstimatedWait(1); wait != 0 {
+		t.Errorf("Expected no wait on a full bucket, got %v", wait)
+	}
+
+	tb.Allow()
+	if wait := tb.EstimatedWait(1); wait < 80*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("Expected ~100ms wait on an empty bucket, got %v", wait)
+	}
+
+	// Park a waiter in the queue; we should now be estimated to wait behind it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tb.Wait(ctx)
+	time.Sleep(20 * time.Millisecond)
+
+	if waiters := tb.Waiters(); waiters != 1 {
+		t.Fatalf("Expected 1 waiter, got %d", waiters)
+	}
+	if wait := tb.EstimatedWait(1); wait < 150*time.Millisecond {
+		t.Errorf("Expected estimate to include the waiter ahead of us, got %v", wait)
+	}
+
+	// Once the waiter gives up, it's no longer counted
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	if waiters := tb.Waiters(); waiters != 0 {
+		t.Errorf("Expected 0 waiters after cancellation, got %d", waiters)
+	}
+}
+
+// TestEstimatedWait_BorrowingAndWarmup tests that the estimate counts borrowing and the reduced warm-up rate
+func TestEstimatedWait_BorrowingAndWarmup(t *testing.T) {
+	borrowing := NewTokenBucket(10, time.Second, 1, WithBorrowing(1))
+	borrowing.Allow()
+	if wait := borrowing.EstimatedWait(1); wait != 0 {
+		t.Errorf("Expected no wait when the token can be borrowed, got %v", wait)
+	}
+
+	// Cold, the rate is a third of 30/s, so a token takes ~100ms rather than ~33ms
+	cold := NewTokenBucket(30, time.Second, 30, WithWarmup(time.Minute))
+	for cold.Allow() {
+	}
+	if wait := cold.EstimatedWait(1); wait < 90*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("Expected ~100ms wait at the cold rate, got %v", wait)
+	}
+}
+
+// TestAllow_EarlyRejection tests that some requests get rejected before the bucket is empty
+func TestAllow_EarlyRejection(t *testing.T) {
+	// Start rejecting below 50% full; very slow refill so only our requests change the level
+	tb := NewTokenBucket(1, time.Hour, 1000, WithEarlyRejection(0.5))
+
+	// Above 50% everything gets through
+	for i := range 500 {
+		if !tb.Allow() {
+			t.Fatalf("Expected request %d to be allowed above the early rejection threshold", i+1)
+		}
+	}
+
+	// Below 50% some (but not all) requests should be rejected while tokens remain
+	rejected := 0
+	for range 400 {
+		if !tb.Allow() {
+			rejected++
+		}
+	}
+	if rejected == 0 || rejected == 400 {
+		t.Errorf("Expected a fraction of requests to be rejected early, got %d of 400", rejected)
+	}
+}
+
+// TestWaitErrors tests that Wait says why it failed, while still wrapping the context's error
+func TestWaitErrors(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 1)
+	tb.Allow()
+
+	// Deadline passed
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := tb.Wait(ctx)
+	if !errors.Is(err, ErrWaitDeadline) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ErrWaitDeadline wrapping DeadlineExceeded, got: %v", err)
+	}
+
+	// Cancelled with a cause
+	failure := errors.New("shutting down")
+	ctx, cancelCause := context.WithCancelCause(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancelCause(failure)
+	}()
+	err = tb.Wait(ctx)
+	if !errors.Is(err, ErrWaitCancelled) || !errors.Is(err, context.Canceled) || !errors.Is(err, failure) {
+		t.Errorf("Expected ErrWaitCancelled wrapping Canceled and the cause, got: %v", err)
+	}
+}
+
+// TestWaitAlreadyCancelled tests that Wait fails right away with an already cancelled context,
+// even when tokens are available
+func TestWaitAlreadyCancelled(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := tb.Wait(ctx); !errors.Is(err, ErrWaitCancelled) {
+		t.Errorf("Expected ErrWaitCancelled error, got: %v", err)
+	}
+	if tb.tokens != 10 {
+		t.Errorf("Expected no tokens consumed, got %v left", tb.tokens)
+	}
+}
+
+// TestWithSlack tests that only the slack's worth of missed time gets credited after a stall
+func TestWithSlack(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 100, WithSlack(50*time.Millisecond))
+	tb.AllowN(100)
+
+	// Stall for 200ms, which would normally earn 20 tokens
+	time.Sleep(200 * time.Millisecond)
+
+	allowed := 0
+	for tb.Allow() {
+		allowed++
+	}
+	if allowed < 4 || allowed > 6 {
+		t.Errorf("Expected about 5 tokens (50ms worth), got %d", allowed)
+	}
+}
+
+// TestClockJumps tests that wall clock jumps can't take tokens away or overfill the bucket.
+// Times without a monotonic reading (Round(0)) are compared by wall clock, which is how a jump shows up
+func TestClockJumps(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 10)
+	tb.AllowN(5)
+
+	// Wall clock stepped back an hour since the last refill
+	tb.lastUpdated = time.Now().Add(time.Hour).Round(0)
+	tb.mtx.Lock()
+	tb.refillBucket()
+	tokens := tb.tokens
+	tb.mtx.Unlock()
+	if tokens < 5 || tokens > 5.1 {
+		t.Errorf("Expected backward jump to leave tokens alone at ~5, got %v", tokens)
+	}
+
+	// Refills from here on are monotonic again
+	time.Sleep(100 * time.Millisecond)
+	tb.mtx.Lock()
+	tb.refillBucket()
+	tokens = tb.tokens
+	tb.mtx.Unlock()
+	if tokens < 5.9 || tokens > 6.3 {
+		t.Errorf("Expected normal refill after the jump to ~6 tokens, got %v", tokens)
+	}
+
+	// Wall clock stepped forward a day
+	tb.lastUpdated = time.Now().Add(-24 * time.Hour).Round(0)
+	tb.mtx.Lock()
+	tb.refillBucket()
+	tokens = tb.tokens
+	tb.mtx.Unlock()
+	if tokens != 10 {
+		t.Errorf("Expected forward jump to fill the bucket at most, got %v", tokens)
+	}
+}
+
+// TestPauseResume tests that a paused bucket rejects everything and doesn't build up tokens
+func TestPauseResume(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 100)
+	tb.AllowN(100)
+	tb.Pause()
+
+	if !tb.Paused() {
+		t.Error("Expected bucket to be paused")
+	}
+	if tb.Allow() {
+		t.Error("Expected Allow to be rejected while paused")
+	}
+	if err := tb.Wait(context.Background()); err != ErrPaused {
+		t.Errorf("Expected ErrPaused error, got: %v", err)
+	}
+
+	// 100ms paused would normally earn 10 tokens
+	time.Sleep(100 * time.Millisecond)
+	tb.Resume()
+
+	if tb.Allow() {
+		t.Error("Expected no tokens to have built up while paused")
+	}
+}
+
+// TestPauseQueueing tests that with queueing on, Wait blocks until the bucket is resumed
+func TestPauseQueueing(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 10, WithPauseQueueing())
+	tb.Pause()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tb.Resume()
+	}()
+
+	start := time.Now()
+	if err := tb.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected Wait to block until resumed, took %v", elapsed)
+	}
+}
+
+// TestTokens tests that the remaining budget can be read for a decision
+func TestTokens(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 5)
+	tb.AllowN(2)
+
+	if remaining := tb.Tokens(); remaining < 3 || remaining > 3.01 {
+		t.Errorf("Expected 3 tokens remaining, got %v", remaining)
+	}
+}
+
+// TestWithBorrowing tests that a slightly short request can borrow, but only up to the limit
+func TestWithBorrowing(t *testing.T) {
+	tb := NewTokenBucket(1, time.Hour, 10, WithBorrowing(2))
+	tb.AllowN(9)
+
+	// 1 token left, a cost of 3 fits by borrowing 2
+	if !tb.AllowN(3) {
+		t.Error("Expected request to be allowed by borrowing")
+	}
+	if borrowed := tb.Borrowed(); borrowed < 1.99 || borrowed > 2 {
+		t.Errorf("Expected 2 tokens borrowed, got %v", borrowed)
+	}
+
+	// Already 2 below zero, so nothing more can be borrowed
+	if tb.Allow() {
+		t.Error("Expected request to be denied past the borrowing limit")
+	}
+}
+
+// TestWithBorrowing_PaidBack tests that refill pays back borrowed tokens
+func TestWithBorrowing_PaidBack(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 1, WithBorrowing(1))
+	tb.AllowN(1)
+	tb.AllowN(1) // borrows 1
+
+	time.Sleep(50 * time.Millisecond) // 5 tokens worth of refill
+	if borrowed := tb.Borrowed(); borrowed != 0 {
+		t.Errorf("Expected borrowed tokens to be paid back, got %v", borrowed)
+	}
+}
+
+// TestClose_RejectsNewWork tests that nothing new gets in once the bucket is closed
+func TestClose_RejectsNewWork(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 10)
+	if err := tb.Close(context.Background()); err != nil {
+		t.Fatalf("Expected Close with no waiters to return nil, got: %v", err)
+	}
+
+	if tb.Allow() {
+		t.Error("Expected Allow to be denied once closed")
+	}
+	if err := tb.Wait(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got: %v", err)
+	}
+}
+
+// TestClose_DrainsWaiters tests that waiters already queued still get served before Close returns
+func TestClose_DrainsWaiters(t *testing.T) {
+	for _, opts := range [][]TokenBucketOption{nil, {WithWaitDispatcher()}} {
+		tb := NewTokenBucket(20, time.Second, 1, opts...)
+		tb.Allow()
+
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() { errs <- tb.Wait(context.Background()) }()
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		if err := tb.Close(context.Background()); err != nil {
+			t.Fatalf("Expected Close to drain, got: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := <-errs; err != nil {
+				t.Errorf("Expected queued waiter to be served, got: %v", err)
+			}
+		}
+	}
+}
+
+// TestClose_FailsLeftoverWaiters tests that waiters still queued when Close gives up fail with ErrClosed
+func TestClose_FailsLeftoverWaiters(t *testing.T) {
+	for _, opts := range [][]TokenBucketOption{nil, {WithWaitDispatcher()}} {
+		tb := NewTokenBucket(1, time.Minute, 1, opts...)
+		tb.Allow()
+
+		errs := make(chan error, 1)
+		go func() { errs <- tb.Wait(context.Background()) }()
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := tb.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected Close to return DeadlineExceeded, got: %v", err)
+		}
+		if err := <-errs; !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected leftover waiter to fail with ErrClosed, got: %v", err)
+		}
+		if waiters := tb.Waiters(); waiters != 0 {
+			t.Errorf("Expected no waiters left, got %d", waiters)
+		}
+	}
+}
+
+// TestMeterOnly tests that a metering bucket never denies, but counts what it would have denied
+func TestMeterOnly(t *testing.T) {
+	tb := NewTokenBucket(1, time.Minute, 3, WithMeterOnly())
+
+	for i := 0; i < 5; i++ {
+		if !tb.Allow() {
+			t.Fatalf("Expected request %d to be allowed in meter only mode", i+1)
+		}
+	}
+
+	start := time.Now()
+	if err := tb.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected Wait to succeed in meter only mode, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("Expected Wait not to block, took %v", elapsed)
+	}
+
+	if allowed, denied := tb.Meter(); allowed != 3 || denied != 3 {
+		t.Errorf("Expected 3 allowed and 3 denied, got %d and %d", allowed, denied)
+	}
+}
+
+// TestWarmup_StartsCold tests that a warming bucket starts with a reduced burst and rate
+func TestWarmup_StartsCold(t *testing.T) {
+	tb := NewTokenBucket(30, time.Second, 30, WithWarmup(time.Minute))
+
+	allowed := 0
+	for tb.Allow() {
+		allowed++
+	}
+	if allowed != 10 {
+		t.Errorf("Expected a cold burst of a third of 30, got %d", allowed)
+	}
+
+	// Barely into the warm-up, the rate is ~10/s rather than 30/s, so ~2 tokens in 200ms
+	time.Sleep(200 * time.Millisecond)
+	if tokens := tb.Tokens(); tokens < 1.5 || tokens > 3 {
+		t.Errorf("Expected ~2 tokens after 200ms at the cold rate, got %v", tokens)
+	}
+}
+
+// TestWarmup_Ramps tests that the rate and burst reach the full values once warmed up, and go cold again after idling
+func TestWarmup_Ramps(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 10, WithWarmup(200*time.Millisecond))
+
+	// Keep the bucket busy through the warm-up
+	deadline := time.Now().Add(250 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		tb.Allow()
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(90 * time.Millisecond) // enough to refill at the full rate, but not a whole idle period
+
+	if tokens := tb.Tokens(); tokens < 9.9 {
+		t.Errorf("Expected the full burst of 10 once warmed up, got %v", tokens)
+	}
+
+	// Idle for a whole period; cold again
+	time.Sleep(250 * time.Millisecond)
+	if tokens := tb.Tokens(); tokens > 3.4 {
+		t.Errorf("Expected the burst back down to a third after idling, got %v", tokens)
+	}
+}
+
+// TestWarmup_WithSlack tests that slack limiting the catch-up refill doesn't hide how long the bucket sat idle
+func TestWarmup_WithSlack(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 10, WithSlack(50*time.Millisecond), WithWarmup(200*time.Millisecond))
+
+	// Keep the bucket busy through the warm-up
+	deadline := time.Now().Add(250 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		tb.Allow()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Only 50ms of the idle time gets refilled, but all of it counts towards going cold
+	time.Sleep(250 * time.Millisecond)
+	if tokens := tb.Tokens(); tokens > 3.4 {
+		t.Errorf("Expected the burst back down to a third after idling, got %v", tokens)
+	}
+}
+
+// TestWaitN_CapacityLowered tests that a waiter whose cost no longer fits after the capacity drops gives up
+func TestWaitN_CapacityLowered(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 5)
+	tb.AllowN(5)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tb.setRate(10, 2)
+	}()
+	if err := tb.WaitN(context.Background(), 5); err != ErrBurstExceeded {
+		t.Errorf("Expected ErrBurstExceeded once the capacity dropped below the cost, got: %v", err)
+	}
+}
+
+// TestTryTakeMulti tests that taking from several buckets is all or nothing, and follows each bucket's options
+func TestTryTakeMulti(t *testing.T) {
+	a := NewTokenBucket(1, time.Hour, 2)
+	b := NewTokenBucket(1, time.Hour, 2, WithBorrowing(1))
+	buckets := []*TokenBucket{a, b}
+
+	if r := tryTakeMulti(buckets, []float64{1, 2}); !r.ok {
+		t.Fatal("Expected 1 and 2 tokens to be taken")
+	}
+
+	// b is empty, but can borrow a token
+	if r := tryTakeMulti(buckets, []float64{0, 1}); !r.ok {
+		t.Fatal("Expected b to borrow a token")
+	}
+
+	// a can't cover 2 any more, so nothing is taken from either
+	if r := tryTakeMulti(buckets, []float64{2, 0}); r.ok || r.wait <= 0 {
+		t.Errorf("Expected a short bucket to fail with a wait, got %+v", r)
+	}
+	if tokens := a.Tokens(); tokens < 1 || tokens > 1.01 {
+		t.Errorf("Expected nothing taken from a after the failed attempt, got %v tokens", tokens)
+	}
+
+	// Paused and closed buckets fail the whole thing
+	a.Pause()
+	if r := tryTakeMulti(buckets, []float64{0, 0}); r.err != ErrPaused {
+		t.Errorf("Expected ErrPaused, got %+v", r)
+	}
+	a.Resume()
+	b.Close(context.Background())
+	if r := tryTakeMulti(buckets, []float64{0, 0}); r.err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %+v", r)
+	}
+
+	// Meter only buckets never hold anything up
+	m := NewTokenBucket(1, time.Hour, 1, WithMeterOnly())
+	if r := tryTakeMulti([]*TokenBucket{m}, []float64{1}); !r.ok {
+		t.Error("Expected a meter only bucket to let it through")
+	}
+	if r := tryTakeMulti([]*TokenBucket{m}, []float64{1}); !r.ok {
+		t.Error("Expected a meter only bucket to let it through")
+	}
+	if allowed, denied := m.Meter(); allowed != 1 || denied != 1 {
+		t.Errorf("Expected 1 allowed and 1 denied, got %d and %d", allowed, denied)
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimiter
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Most per key window counts a TrafficLearner keeps; once full, the oldest are overwritten
+const maxLearnerSamples = 100_000
+
+// TrafficLearner watches real traffic in shadow mode (nothing is ever rejected) and records how many
+// requests each key makes per window, so limits can be set from what clients actually do instead of
+// guessed. Suggest turns the recorded distribution into a limit, e.g. the 99.9th percentile of
+// per key request counts, which lets nearly every client through while catching the outliers
+type TrafficLearner struct {
+	mtx        sync.Mutex
+	window     time.Duration  // how long each count covers; this is the `per` of suggested limits
+	windowFrom time.Time      // start of the current window
+	counts     map[string]int // requests per key in the current window
+	samples    []int          // per key counts from finished windows
+	next       int            // where the next sample goes once samples is full
+}
+
+// TrafficLearner constructor
+func NewTrafficLearner(window time.Duration) *TrafficLearner {
+	if window <= 0 {
+		panic("invalid traffic learner parameters")
+	}
+	return &TrafficLearner{
+		window:     window,
+		windowFrom: time.Now(),
+		counts:     make(map[string]int),
+	}
+}
+
+// Record counts one request from key
+func (tl *TrafficLearner) Record(key string) {
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	tl.roll(time.Now())
+	tl.counts[key]++
+}
+
+// Suggest returns a limit of maxOps per `per` that the given percentile (between 0 and 1, e.g. 0.999)
+// of per key windows stayed within. Returns 0 for maxOps if no window has finished yet.
+// Keys that made no requests in a window don't count towards it
+func (tl *TrafficLearner) Suggest(percentile float64) (maxOps int, per time.Duration) {
+	if percentile <= 0 || percentile > 1 {
+		panic("invalid traffic learner parameters")
+	}
+
+	tl.mtx.Lock()
+	tl.roll(time.Now())
+	samples := slices.Clone(tl.samples)
+	tl.mtx.Unlock()
+
+	if len(samples) == 0 {
+		return 0, tl.window
+	}
+
+	// Nearest rank percentile
+	slices.Sort(samples)
+	rank := int(math.Ceil(percentile*float64(len(samples)))) - 1
+	return samples[max(rank, 0)], tl.window
+}
+
+// Internal helper that closes out the current window if it's over, adding its counts to the samples
+// Caller must hold the lock
+func (tl *TrafficLearner) roll(now time.Time) {
+	if now.Sub(tl.windowFrom) < tl.window {
+		return
+	}
+
+	for _, count := range tl.counts {
+		if len(tl.samples) < maxLearnerSamples {
+			tl.samples = append(tl.samples, count)
+		} else {
+			tl.samples[tl.next] = count
+			tl.next = (tl.next + 1) % maxLearnerSamples
+		}
+	}
+	clear(tl.counts)
+	tl.windowFrom = now
+}
+
+// Learn is middleware that records every request in the learner under its key and passes it straight
+// through, for finding out what limits to set before enforcing any
+func Learn(next http.Handler, learner *TrafficLearner, key KeyFunc) http.Handler {
+	if learner == nil {
+		panic("invalid traffic learner parameters")
+	}
+	if key == nil {
+		key = ClientIP
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		learner.Record(key(r))
+		next.ServeHTTP(w, r)
+	})
+}
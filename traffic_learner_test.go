@@ -0,0 +1,53 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTrafficLearner_Suggest tests that suggestions come from per key counts in finished windows
+func TestTrafficLearner_Suggest(t *testing.T) {
+	tl := NewTrafficLearner(50 * time.Millisecond)
+
+	if maxOps, _ := tl.Suggest(0.99); maxOps != 0 {
+		t.Errorf("Expected no suggestion before a window finishes, got %d", maxOps)
+	}
+
+	// 9 quiet keys and one noisy one
+	for i := 0; i < 9; i++ {
+		tl.Record(string(rune('a' + i)))
+		tl.Record(string(rune('a' + i)))
+	}
+	for i := 0; i < 50; i++ {
+		tl.Record("noisy")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	if maxOps, per := tl.Suggest(0.9); maxOps != 2 || per != 50*time.Millisecond {
+		t.Errorf("Expected p90 to be 2 per 50ms, got %d per %v", maxOps, per)
+	}
+	if maxOps, _ := tl.Suggest(1); maxOps != 50 {
+		t.Errorf("Expected p100 to be 50, got %d", maxOps)
+	}
+}
+
+// TestLearn tests that the middleware records requests without rejecting any
+func TestLearn(t *testing.T) {
+	tl := NewTrafficLearner(20 * time.Millisecond)
+	handler := Learn(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tl, nil)
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected request to pass through, got %d", rec.Code)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if maxOps, _ := tl.Suggest(1); maxOps != 5 {
+		t.Errorf("Expected 5 requests recorded for the client, got %d", maxOps)
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimiter
+
+// TxStep reserves capacity from one limiter as part of a Transaction. It returns ok false if the
+// limiter doesn't have room, and otherwise a commit func that makes the reservation stick and a
+// rollback func that gives it back. Use TokenStep and AdmissionStep for the limiters in this package,
+// or write one for anything else (e.g. a quota held in another service)
+type TxStep func() (commit func(), rollback func(), ok bool)
+
+// Transaction reserves from every step in order and commits them all only if every one of them had
+// room. If any step comes up short, the ones already reserved are rolled back (in reverse order), so
+// a request billed against several limiters is either charged by all of them or by none
+// NON-BLOCKING! Returns immediately
+func Transaction(steps ...TxStep) bool {
+	commits := make([]func(), 0, len(steps))
+	rollbacks := make([]func(), 0, len(steps))
+
+	for _, step := range steps {
+		commit, rollback, ok := step()
+		if !ok {
+			for i := len(rollbacks) - 1; i >= 0; i-- {
+				rollbacks[i]()
+			}
+			return false
+		}
+		commits = append(commits, commit)
+		rollbacks = append(rollbacks, rollback)
+	}
+
+	for _, commit := range commits {
+		commit()
+	}
+	return true
+}
+
+// TokenStep is a TxStep that takes n tokens from a bucket
+func TokenStep(tb *TokenBucket, n float64) TxStep {
+	return func() (func(), func(), bool) {
+		id, ok := tb.Reserve(n)
+		if !ok {
+			return nil, nil, false
+		}
+		commit := func() { tb.Commit(id, n) }
+		rollback := func() { tb.Commit(id, 0) }
+		return commit, rollback, true
+	}
+}
+
+// AdmissionStep is a TxStep that admits work using the given memory through an AdmissionController.
+// Once the transaction commits, the admission is stored in *admission, and the caller has to Release
+// it when the work is done as usual
+func AdmissionStep(ac *AdmissionController, memory float64, admission **Admission) TxStep {
+	return func() (func(), func(), bool) {
+		a, ok := ac.TryAdmit(memory)
+		if !ok {
+			return nil, nil, false
+		}
+		commit := func() { *admission = a }
+		return commit, a.Release, true
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTransaction_AllOrNothing tests that a short step rolls back the ones before it
+func TestTransaction_AllOrNothing(t *testing.T) {
+	user := NewTokenBucket(1, time.Hour, 10)
+	org := NewTokenBucket(1, time.Hour, 3)
+
+	if !Transaction(TokenStep(user, 2), TokenStep(org, 2)) {
+		t.Fatal("Expected transaction to succeed while both have room")
+	}
+
+	// Org only has 1 token left, so the user's 2 shouldn't be charged either
+	if Transaction(TokenStep(user, 2), TokenStep(org, 2)) {
+		t.Fatal("Expected transaction to fail when one limiter is short")
+	}
+	if tokens := user.Tokens(); tokens < 8 || tokens > 8.01 {
+		t.Errorf("Expected the user's reservation to be rolled back to 8 tokens, got %v", tokens)
+	}
+	if tokens := org.Tokens(); tokens < 1 || tokens > 1.01 {
+		t.Errorf("Expected org to still have 1 token, got %v", tokens)
+	}
+}
+
+// TestTransaction_Admission tests mixing a token bucket with an admission controller
+func TestTransaction_Admission(t *testing.T) {
+	quota := NewTokenBucket(1, time.Hour, 1)
+	ac := NewAdmissionController(nil, 1, 0)
+
+	var admission *Admission
+	if !Transaction(AdmissionStep(ac, 0, &admission), TokenStep(quota, 1)) {
+		t.Fatal("Expected transaction to succeed")
+	}
+	if admission == nil || ac.InFlight() != 1 {
+		t.Fatal("Expected the admission to be handed over")
+	}
+	admission.Release()
+
+	// Quota is used up, so the admission should be rolled back
+	var second *Admission
+	if Transaction(AdmissionStep(ac, 0, &second), TokenStep(quota, 1)) {
+		t.Fatal("Expected transaction to fail without quota")
+	}
+	if second != nil || ac.InFlight() != 0 {
+		t.Errorf("Expected the admission to be released, %d in flight", ac.InFlight())
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Tier says which tier of a TwoRatePolicer a request fit in
+type Tier int
+
+const (
+	TierCommitted Tier = iota // within the committed rate
+	TierPeak                  // over the committed rate, but within the peak rate
+	TierExceeded              // over the peak rate; not allowed
+)
+
+// String returns the tier's name
+func (t Tier) String() string {
+	switch t {
+	case TierCommitted:
+		return "committed"
+	case TierPeak:
+		return "peak"
+	default:
+		return "exceeded"
+	}
+}
+
+// TwoRatePolicer is a two rate, three color policer (like RFC 2698's trTCM): traffic within the
+// committed rate and burst is fine, short overshoots above it are let through as long as they stay
+// under the peak rate and burst, and anything over the peak is denied. Check reports which tier each
+// request landed in, e.g. to mark or deprioritize the overshoot
+type TwoRatePolicer struct {
+	mtx       sync.Mutex   // held while a request tries both tiers, so the attempts don't interleave
+	committed *TokenBucket // committed rate and burst
+	peak      *TokenBucket // peak rate and burst
+}
+
+// TwoRatePolicer constructor; committedOps per `per` with bursts up to committedBurst is the committed
+// tier, and peakOps per `per` with bursts up to peakBurst is the hard cap
+func NewTwoRatePolicer(committedOps int, committedBurst int, peakOps int, peakBurst int, per time.Duration) *TwoRatePolicer {
+	if peakOps < committedOps || peakBurst < committedBurst {
+		panic("invalid two rate policer parameters")
+	}
+
+	return &TwoRatePolicer{
+		committed: NewTokenBucket(committedOps, per, committedBurst),
+		peak:      NewTokenBucket(peakOps, per, peakBurst),
+	}
+}
+
+// Check lets the request through if it fits the peak tier, and reports which tier it fit in.
+// A request in the committed tier counts against both tiers; one in the peak tier only against the peak
+// NON-BLOCKING! Returns immediately
+func (p *TwoRatePolicer) Check() Tier {
+	tier, _ := p.take()
+	return tier
+}
+
+// Implements Allow RateLimiter method; allows the request if it fits the peak tier
+// NON-BLOCKING! Returns immediately
+func (p *TwoRatePolicer) Allow() bool {
+	return p.Check() != TierExceeded
+}
+
+// Implements Wait RateLimiter method; blocks until the request fits the peak tier
+// BLOCKING!! Blocks current goroutine
+func (p *TwoRatePolicer) Wait(ctx context.Context) error {
+	return waitMulti(ctx, func() takeResult {
+		_, r := p.take()
+		return r
+	})
+}
+
+// Internal helper that takes from whichever tier the request fits in. If it doesn't fit in the peak
+// tier, also returns how long until it would
+func (p *TwoRatePolicer) take() (Tier, takeResult) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if r := tryTakeMulti([]*TokenBucket{p.peak, p.committed}, []float64{1, 1}); r.ok {
+		return TierCommitted, r
+	}
+	r := tryTakeMulti([]*TokenBucket{p.peak}, []float64{1})
+	if r.ok {
+		return TierPeak, r
+	}
+	return TierExceeded, r
+}
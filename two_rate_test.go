@@ -0,0 +1,50 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestTwoRatePolicer_Tiers tests that requests land in the committed tier, then the peak tier, then are denied
+func TestTwoRatePolicer_Tiers(t *testing.T) {
+	p := NewTwoRatePolicer(10, 2, 20, 5, time.Hour)
+
+	want := []Tier{TierCommitted, TierCommitted, TierPeak, TierPeak, TierPeak, TierExceeded}
+	for i, tier := range want {
+		if got := p.Check(); got != tier {
+			t.Errorf("Request %d: expected %v, got %v", i+1, tier, got)
+		}
+	}
+}
+
+// TestTwoRatePolicer_ExceededTakesNothing tests that a denied request doesn't use up the committed tier
+func TestTwoRatePolicer_ExceededTakesNothing(t *testing.T) {
+	p := NewTwoRatePolicer(10, 5, 20, 5, time.Hour)
+
+	for range 5 {
+		p.Check()
+	}
+	p.committed.tokens = 3 // committed refilled more than the peak somehow
+
+	if p.Allow() {
+		t.Fatal("Expected request over the peak to be denied")
+	}
+	if p.committed.tokens < 3 || p.committed.tokens > 3.01 {
+		t.Errorf("Expected committed tier untouched, has %v", p.committed.tokens)
+	}
+}
+
+// TestTwoRatePolicer_Wait tests that Wait blocks until the peak tier refills
+func TestTwoRatePolicer_Wait(t *testing.T) {
+	p := NewTwoRatePolicer(1, 1, 10, 1, time.Second)
+	p.Allow()
+
+	start := time.Now()
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > 250*time.Millisecond {
+		t.Errorf("Expected to wait ~100ms for the peak tier, took %v", elapsed)
+	}
+}
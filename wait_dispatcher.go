@@ -0,0 +1,252 @@
+package ratelimiter
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// WithWaitDispatcher makes Wait queue its callers in FIFO order (see WaitPriority for jumping the
+// queue) and hand them tokens from a single dispatcher goroutine with a single timer, instead of every
+// blocked goroutine running its own timer and waking up to compete for the lock. With tens of thousands
+// of goroutines blocked on one bucket, this cuts timer and scheduler pressure down to one timer per
+// bucket. The dispatcher only runs while there are waiters. Allow isn't affected, apart from not
+// jumping the queue while anyone is waiting
+func WithWaitDispatcher() TokenBucketOption {
+	return func(tb *TokenBucket) {
+		tb.dispatch = newWaitDispatch()
+	}
+}
+
+// WithPriorityAging makes waiters queued by WaitPriority gain one priority level for every `every` they've
+// been waiting, so under sustained high priority load, lower priority waiters still get served eventually
+// instead of starving. Waiters with the same effective priority are still served in queue order
+func WithPriorityAging(every time.Duration) TokenBucketOption {
+	if every <= 0 {
+		panic("invalid rate limiter parameters")
+	}
+	return func(tb *TokenBucket) {
+		tb.aging = every
+	}
+}
+
+// Internal state for WithWaitDispatcher
+type waitDispatch struct {
+	queue   []*bucketWaiter // waiters by priority, then arrival order
+	running bool            // whether the dispatcher goroutine is running
+	wake    chan struct{}   // nudges the dispatcher to look at the queue again
+}
+
+// Internal helper that creates an idle dispatcher
+func newWaitDispatch() *waitDispatch {
+	return &waitDispatch{wake: make(chan struct{}, 1)}
+}
+
+// A single waiter in the dispatcher's queue
+type bucketWaiter struct {
+	cost      float64
+	priority  int // higher is served first
+	enqueued  time.Time
+	ready     chan struct{} // closed once the waiter has been granted its tokens (or shed)
+	err       error         // set before ready is closed; ErrWaitShed if CoDel shed the waiter
+	cancelled bool
+}
+
+// Internal helper implementing WaitN for buckets with a wait dispatcher; joins the queue behind everyone
+// with the same or a higher priority, and blocks until the dispatcher gets to us
+func (tb *TokenBucket) waitDispatched(ctx context.Context, n float64, priority int) error {
+	tb.mtx.Lock()
+	tb.refillBucket()
+
+	if tb.closing {
+		tb.mtx.Unlock()
+		return ErrClosed
+	}
+	if tb.paused != nil && !tb.pauseQueue {
+		tb.mtx.Unlock()
+		return ErrPaused
+	}
+
+	// Nobody ahead of us and enough tokens; no need to queue
+	if tb.waiters == 0 && tb.paused == nil && tb.fits(n) {
+		defer tb.mtx.Unlock()
+		if tb.codel != nil && tb.codel.shouldDrop(time.Now(), 0) {
+			return ErrWaitShed
+		}
+		tb.take(n)
+		return nil
+	}
+
+	// If we're never going to make it before the deadline, don't bother waiting
+	if deadline, ok := ctx.Deadline(); ok && tb.deadlineCheck {
+		tokensNeeded := tb.waitingCost + n - tb.tokens - tb.borrowLimit
+		if time.Until(deadline) < time.Duration(tokensNeeded/tb.rate*float64(time.Second)) {
+			tb.mtx.Unlock()
+			return ErrWouldExceedDeadline
+		}
+	}
+
+	w := &bucketWaiter{cost: n, priority: priority, enqueued: time.Now(), ready: make(chan struct{})}
+	d := tb.dispatch
+	i := len(d.queue)
+	for i > 0 && d.queue[i-1].priority < priority {
+		i--
+	}
+	d.queue = slices.Insert(d.queue, i, w)
+	tb.waiters++
+	tb.waitingCost += n
+
+	// Kick off the dispatcher if nobody is running it right now
+	if !d.running {
+		d.running = true
+		go tb.dispatchWaiters()
+	} else if i == 0 {
+		d.nudge() // we jumped to the head of the queue, so the dispatcher's timer is for someone else
+	}
+	tb.mtx.Unlock()
+
+	select {
+	case <-w.ready:
+		return w.err
+	case <-ctx.Done():
+		tb.mtx.Lock()
+		defer tb.mtx.Unlock()
+
+		// We might have been served right as the context ended; if so we got our tokens after all
+		select {
+		case <-w.ready:
+			return w.err
+		default:
+		}
+		w.cancelled = true
+		tb.dequeue(n)
+		tb.dispatch.nudge() // the dispatcher may be sleeping on our behalf
+		return waitError(ctx)
+	}
+}
+
+// Internal dispatcher loop; serves the queue in order, sleeping on one timer until the waiter at the
+// head can be served. Exits once the queue is empty
+func (tb *TokenBucket) dispatchWaiters() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	tb.mtx.Lock()
+	for {
+		// Drop waiters that gave up
+		d := tb.dispatch
+		for len(d.queue) > 0 && d.queue[0].cancelled {
+			d.queue = d.queue[1:]
+		}
+		if len(d.queue) == 0 {
+			d.running = false
+			tb.mtx.Unlock()
+			return
+		}
+
+		// Closed and done draining; fail everyone still queued
+		select {
+		case <-tb.abort:
+			for _, w := range d.queue {
+				if !w.cancelled {
+					w.err = ErrClosed
+					tb.dequeue(w.cost)
+					close(w.ready)
+				}
+			}
+			d.queue = nil
+			continue
+		default:
+		}
+
+		tb.refillBucket()
+
+		// While paused, sit tight until we're resumed (or the queue changes)
+		if paused := tb.paused; paused != nil {
+			tb.mtx.Unlock()
+			select {
+			case <-paused:
+			case <-d.wake:
+			}
+			tb.mtx.Lock()
+			continue
+		}
+
+		// The capacity may have been lowered since the next waiter joined the queue; it'd never get through
+		i := tb.nextWaiter(time.Now())
+		w := d.queue[i]
+		if w.cost > tb.max_tokens {
+			d.remove(i)
+			tb.dequeue(w.cost)
+			w.err = ErrBurstExceeded
+			close(w.ready)
+			continue
+		}
+		if tb.fits(w.cost) {
+			d.remove(i)
+			tb.dequeue(w.cost)
+
+			// With CoDel on, waiters that sat in the queue too long may get shed instead of served
+			if tb.codel != nil && tb.codel.shouldDrop(time.Now(), time.Since(w.enqueued)) {
+				w.err = ErrWaitShed
+			} else {
+				tb.take(w.cost)
+			}
+			close(w.ready)
+			continue
+		}
+
+		// Not enough tokens for the next waiter yet; sleep until there will be. With aging, check back
+		// at least once per level, since someone else may have aged past it by then
+		sleep := time.Duration((w.cost - tb.tokens - tb.borrowLimit) / tb.rate * float64(time.Second))
+		if tb.aging > 0 {
+			sleep = min(sleep, tb.aging)
+		}
+		timer.Reset(sleep)
+		tb.mtx.Unlock()
+
+		select {
+		case <-timer.C:
+		case <-d.wake:
+		}
+		tb.mtx.Lock()
+	}
+}
+
+// Internal helper that picks the index of the waiter to serve next: the head of the queue, or with
+// aging, the first waiter with the highest priority once their time spent waiting is counted in
+// Caller must hold the lock, and the head of the queue must not be cancelled
+func (tb *TokenBucket) nextWaiter(now time.Time) int {
+	queue := tb.dispatch.queue
+	if tb.aging <= 0 {
+		return 0
+	}
+
+	best, bestPriority := 0, queue[0].priority+int(now.Sub(queue[0].enqueued)/tb.aging)
+	for i, w := range queue[1:] {
+		if w.cancelled {
+			continue
+		}
+		if priority := w.priority + int(now.Sub(w.enqueued)/tb.aging); priority > bestPriority {
+			best, bestPriority = i+1, priority
+		}
+	}
+	return best
+}
+
+// Internal helper that takes the waiter at index i out of the queue
+func (d *waitDispatch) remove(i int) {
+	if i == 0 {
+		d.queue = d.queue[1:] // the common case; no need to shift everyone down
+		return
+	}
+	d.queue = slices.Delete(d.queue, i, i+1)
+}
+
+// Internal helper that wakes the dispatcher up to look at the queue again, if it's sleeping
+func (d *waitDispatch) nudge() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,182 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestWaitDispatcher_FIFO tests that waiters are served in the order they arrived
+func TestWaitDispatcher_FIFO(t *testing.T) {
+	tb := NewTokenBucket(20, time.Second, 1, WithWaitDispatcher())
+	tb.Allow()
+
+	var mtx sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tb.Wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+			mtx.Lock()
+			order = append(order, i)
+			mtx.Unlock()
+		}()
+		time.Sleep(5 * time.Millisecond) // make sure they queue up in order
+	}
+	wg.Wait()
+
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("Expected waiters served in arrival order, got %v", order)
+		}
+	}
+}
+
+// TestWaitDispatcher_Rate tests that the dispatcher still serves waiters at the bucket's rate
+func TestWaitDispatcher_Rate(t *testing.T) {
+	tb := NewTokenBucket(100, time.Second, 1, WithWaitDispatcher())
+	tb.Allow()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tb.Wait(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	// 20 tokens at 100/s is ~200ms
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("Expected ~200ms for 20 waiters, took %v", elapsed)
+	}
+	if waiters := tb.Waiters(); waiters != 0 {
+		t.Errorf("Expected no waiters left, got %d", waiters)
+	}
+}
+
+// TestWaitDispatcher_Cancel tests that a cancelled waiter leaves the queue without taking tokens
+func TestWaitDispatcher_Cancel(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 1, WithWaitDispatcher())
+	tb.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tb.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded error, got: %v", err)
+	}
+	if waiters := tb.Waiters(); waiters != 0 {
+		t.Errorf("Expected the cancelled waiter to leave the queue, got %d waiters", waiters)
+	}
+
+	// The token that refills should still be there for the next caller
+	time.Sleep(100 * time.Millisecond)
+	if !tb.Allow() {
+		t.Error("Expected the refilled token to be available")
+	}
+}
+
+// TestWaitDispatcher_AllowDoesNotJumpQueue tests that Allow doesn't take tokens a waiter is queued for
+func TestWaitDispatcher_AllowDoesNotJumpQueue(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 5, WithWaitDispatcher())
+	tb.AllowN(5)
+
+	done := make(chan error)
+	go func() { done <- tb.WaitN(context.Background(), 3) }()
+	time.Sleep(150 * time.Millisecond) // 1.5 tokens refilled, not enough for the waiter
+
+	if tb.Allow() {
+		t.Error("Expected Allow to be denied while a waiter is queued")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWaitPriority tests that higher priority waiters get refilled tokens before lower priority ones
+// that were queued first
+func TestWaitPriority(t *testing.T) {
+	tb := NewTokenBucket(20, time.Second, 1)
+	tb.Allow()
+
+	var mtx sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for _, priority := range []int{0, 0, 0, 10, 5} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tb.WaitPriority(context.Background(), priority); err != nil {
+				t.Error(err)
+			}
+			mtx.Lock()
+			order = append(order, priority)
+			mtx.Unlock()
+		}()
+		time.Sleep(5 * time.Millisecond) // make sure they queue up in order
+	}
+	wg.Wait()
+
+	// The first waiter may already have been served by the time the others showed up
+	want := []int{10, 5, 0, 0, 0}
+	if order[0] == 0 {
+		want = []int{0, 10, 5, 0, 0}
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected waiters served as %v, got %v", want, order)
+		}
+	}
+}
+
+// TestWaitPriority_Aging tests that with aging, a low priority waiter gets served under sustained higher
+// priority load instead of going last
+func TestWaitPriority_Aging(t *testing.T) {
+	for _, aging := range []bool{false, true} {
+		opts := []TokenBucketOption{WithWaitDispatcher()}
+		if aging {
+			opts = append(opts, WithPriorityAging(5*time.Millisecond))
+		}
+		tb := NewTokenBucket(50, time.Second, 1, opts...)
+		tb.Allow()
+
+		var mtx sync.Mutex
+		var order []int
+		var wg sync.WaitGroup
+		wait := func(priority int) {
+			defer wg.Done()
+			if err := tb.WaitPriority(context.Background(), priority); err != nil {
+				t.Error(err)
+			}
+			mtx.Lock()
+			order = append(order, priority)
+			mtx.Unlock()
+		}
+
+		// High priority waiters keep arriving twice as fast as they can be served; once the low priority
+		// waiter has waited 10 levels' worth longer than the one at the head of the queue, it goes first
+		wg.Add(21)
+		go wait(0)
+		for range 20 {
+			time.Sleep(10 * time.Millisecond)
+			go wait(10)
+		}
+		wg.Wait()
+
+		last := order[len(order)-1] == 0
+		if aging && last {
+			t.Errorf("Expected the aged low priority waiter to be served before the rest, got %v", order)
+		}
+		if !aging && !last {
+			t.Errorf("Expected the low priority waiter to go last without aging, got %v", order)
+		}
+	}
+}